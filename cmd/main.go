@@ -2,10 +2,17 @@ package main
 
 import (
 	"log"
-	"os"
+	"time"
 	"yt-converter-api/config"
 	"yt-converter-api/db"
+	"yt-converter-api/jobs"
 	"yt-converter-api/middleware"
+	"yt-converter-api/pkg/cache"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/metadata"
+	"yt-converter-api/pkg/sessions"
+	"yt-converter-api/pkg/sources"
+	"yt-converter-api/pkg/transcode"
 	"yt-converter-api/routes"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,16 +21,15 @@ import (
 
 func main() {
 	cfg := config.LoadConfig()
-	// Si no se ha establecido la API Key de Google Cloud, se muestra un error y la aplicación se cierra
+	// Sin API Key de Google Cloud los metadatos se obtienen con yt-dlp u oEmbed
 	if cfg.GoogleCloudApiKey == "" {
-		log.Fatal("Google Cloud API Key not set")
-		os.Exit(1)
+		log.Println("Google Cloud API Key not set, using the remaining metadata providers")
 	}
 
 	// Iniciar la aplicación y configurar CORS
 	app := fiber.New()
 	app.Use(cors.New(cors.Config{
-		AllowHeaders: "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin,Authorization",
+		AllowHeaders: "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin,Authorization,X-API-Key",
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
 	}))
@@ -31,6 +37,51 @@ func main() {
 	// Iniciar la base de datos
 	db.InitDB()
 
+	// Configurar la duración de las sesiones y borrar periódicamente las caducadas
+	sessions.Init(cfg)
+	sessions.StartPurger()
+
+	// Seleccionar el backend de conversión configurado
+	if err := converter.Init(cfg); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Usando el backend de conversión %s", converter.Current.Name())
+
+	// Habilitar los sitios de los que se pueden agregar videos
+	if err := sources.Init(cfg); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Sitios de videos habilitados: %s", sources.Current.Name())
+
+	// Configurar los proveedores de metadatos de los videos
+	if err := metadata.Init(cfg); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Usando los proveedores de metadatos %s", metadata.Current.Name())
+
+	// Guardar en caché los formatos y metadatos para compartirlos entre el endpoint de formatos y los trabajos
+	if cfg.CacheTTLMinutes > 0 {
+		ttl := time.Duration(cfg.CacheTTLMinutes) * time.Minute
+		converter.Current = cache.NewConverter(converter.Current, ttl)
+		metadata.Current = cache.NewProvider(metadata.Current, ttl)
+		if purged, err := cache.Purge(); err != nil {
+			log.Println("Error borrando las entradas caducadas de la caché:", err)
+		} else if purged > 0 {
+			log.Printf("Borradas %d entradas caducadas de la caché", purged)
+		}
+	}
+
+	// Cargar los perfiles de transcodificación, los de TRANSCODE_PROFILES se añaden a los incluidos
+	if err := transcode.Init(cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	// Iniciar la cola de trabajos de procesamiento
+	jobs.Start(cfg.WorkerCount)
+
+	// Comprobar periódicamente las suscripciones a canales y listas de reproducción
+	jobs.StartScheduler()
+
 	api := app.Group("/api")
 
 	// Status
@@ -42,21 +93,66 @@ func main() {
 	|                             VIDEOS                                |
 	|                                                                   |
 	------------------------------------------------------------------- */
+	// EventSource no permite cabeceras, así que esta ruta también acepta el token en ?access_token=. Se registra
+	// antes que el grupo para que no se ejecute su middleware, que solo lo lee de la cabecera Authorization
+	api.Get("/videos/:video_id/events", middleware.JWTProtectedWithQuery(), middleware.ValidUserAndActive, routes.GetVideoEvents) // Envía por Server-Sent Events el progreso del procesamiento de un video
 	videos := api.Group("/videos")
 	videos.Use(middleware.JWTProtected())
 	videos.Use(middleware.ValidUserAndActive)
 
 	// ADMIN
-	videos.Get("/", middleware.IsAdmin, routes.GetVideos)               // Obtiene todos los videos
-	videos.Delete("/:video_id", middleware.IsAdmin, routes.DeleteVideo) // Elimina un video
+	videos.Get("/", middleware.IsAdmin, routes.GetVideos)                                       // Obtiene todos los videos
+	videos.Delete("/:video_id", middleware.IsAdmin, routes.DeleteVideo)                         // Elimina un video
+	videos.Post("/:video_id/refresh-metadata", middleware.IsAdmin, routes.RefreshVideoMetadata) // Vuelve a obtener los metadatos de un video
+	videos.Delete("/:video_id/cache", middleware.IsAdmin, routes.InvalidateVideoCache)          // Borra los formatos y metadatos guardados en caché de un video
 	// Usuarios
-	videos.Post("/", routes.AddVideo)                         // Inserta un video
-	videos.Get("/:video_id", routes.GetVideo)                 // Obtiene un video de la BBDD
-	videos.Get("/:video_id/formats", routes.GetVideoFormats)  // Obtiene los formatos disponibles de un video (resoluciones)
-	videos.Post("/:video_id/formats", routes.GetVideoFormats) // Obtiene los formatos disponibles de un video (resoluciones) Utilizando un archivo cookies
-	videos.Post("/:video_id/process", routes.ProcessVideo)    // Procesa un video con el formato (resolución) indicado por POST, es decir, descarga el video y lo almacena en su correspondiente carpeta
-	videos.Get("/:video_id/download", routes.DownloadVideo)   // Descarga un video
-	videos.Get("/:video_id/status", routes.GetVideoStatus)    // Obtiene el estado de procesamiento de un video
+	videos.Get("/profiles", routes.GetTranscodeProfiles)           // Obtiene los perfiles de transcodificación disponibles
+	videos.Post("/", routes.AddVideo)                              // Inserta un video
+	videos.Get("/:video_id", routes.GetVideo)                      // Obtiene un video de la BBDD
+	videos.Get("/:video_id/formats", routes.GetVideoFormats)       // Obtiene los formatos disponibles de un video (resoluciones)
+	videos.Post("/:video_id/formats", routes.GetVideoFormats)      // Obtiene los formatos disponibles de un video (resoluciones) Utilizando un archivo cookies
+	videos.Get("/:video_id/subtitles", routes.GetVideoSubtitles)   // Obtiene los subtítulos disponibles de un video por idioma
+	videos.Get("/:video_id/thumbnail", routes.GetVideoThumbnail)   // Obtiene la miniatura, la hoja de contactos o la vista previa de un video
+	videos.Post("/:video_id/process", routes.ProcessVideo)         // Encola el procesamiento de un video con el formato (resolución) indicado por POST, es decir, descarga el video y lo almacena en su correspondiente carpeta
+	videos.Delete("/:video_id/process", routes.CancelVideoProcess) // Cancela el procesamiento pendiente de un video (?resolution=)
+	videos.Get("/:video_id/download", routes.DownloadVideo)        // Descarga un video
+	videos.Get("/:video_id/status", routes.GetVideoStatus)         // Obtiene el estado de procesamiento de un video
+
+	/* -----------------------------------------------------------------
+	|                                                                   |
+	|                             PLAYLISTS                             |
+	|                                                                   |
+	------------------------------------------------------------------- */
+	playlists := api.Group("/playlists")
+	playlists.Use(middleware.JWTProtected())
+	playlists.Use(middleware.ValidUserAndActive)
+
+	// ADMIN
+	playlists.Get("/", middleware.IsAdmin, routes.GetPlaylists)                  // Obtiene todas las listas de reproducción
+	playlists.Delete("/:playlist_id", middleware.IsAdmin, routes.DeletePlaylist) // Elimina una lista de reproducción (sus videos se conservan)
+	// Usuarios (las listas se agregan con POST /api/videos)
+	playlists.Get("/:playlist_id", routes.GetPlaylist)              // Obtiene una lista de reproducción con sus videos en orden
+	playlists.Post("/:playlist_id/process", routes.ProcessPlaylist) // Encola el procesamiento de todos los videos de la lista con el mismo formato
+	playlists.Get("/:playlist_id/status", routes.GetPlaylistStatus) // Obtiene el estado de procesamiento de la lista (?resolution=)
+
+	/* -----------------------------------------------------------------
+	|                                                                   |
+	|                           SUBSCRIPTIONS                           |
+	|                                                                   |
+	------------------------------------------------------------------- */
+	subscriptions := api.Group("/subscriptions")
+	subscriptions.Use(middleware.JWTProtected())
+	subscriptions.Use(middleware.ValidUserAndActive)
+
+	// Usuarios (los administradores ven y gestionan las de todos)
+	subscriptions.Get("/", routes.GetSubscriptions)                               // Obtiene las suscripciones del usuario
+	subscriptions.Post("/", routes.CreateSubscription)                            // Suscribe a un canal o a una lista de reproducción con el formato indicado por POST
+	subscriptions.Get("/:subscription_id", routes.GetSubscription)                // Obtiene una suscripción
+	subscriptions.Get("/:subscription_id/history", routes.GetSubscriptionHistory) // Obtiene las últimas comprobaciones y los videos encontrados (?limit=)
+	subscriptions.Post("/:subscription_id/pause", routes.PauseSubscription)       // Pausa las comprobaciones periódicas
+	subscriptions.Post("/:subscription_id/resume", routes.ResumeSubscription)     // Reanuda las comprobaciones periódicas
+	subscriptions.Post("/:subscription_id/check", routes.CheckSubscription)       // Comprueba en el momento si hay videos nuevos
+	subscriptions.Delete("/:subscription_id", routes.DeleteSubscription)          // Elimina una suscripción (sus videos se conservan)
 
 	/* -----------------------------------------------------------------
 	|                                                                   |
@@ -68,14 +164,20 @@ func main() {
 	users.Use(middleware.ValidUserAndActive)
 
 	// Usuarios
-	users.Get("/me", routes.GetCurrentUser) // Obtiene el usuario autenticado y sus videos convertidos
+	users.Get("/me", routes.GetCurrentUser)                                                        // Obtiene el usuario autenticado y sus videos convertidos
+	users.Get("/me/sessions", middleware.NoAPIKey, routes.GetCurrentUserSessions)                  // Obtiene las sesiones abiertas del usuario autenticado
+	users.Delete("/me/sessions/:session_id", middleware.NoAPIKey, routes.DeleteCurrentUserSession) // Cierra una sesión del usuario autenticado
+	users.Get("/me/api-keys", middleware.NoAPIKey, routes.GetCurrentUserAPIKeys)                   // Obtiene las API keys del usuario autenticado
+	users.Post("/me/api-keys", middleware.NoAPIKey, routes.CreateCurrentUserAPIKey)                // Crea una API key del usuario autenticado
+	users.Delete("/me/api-keys/:key_id", middleware.NoAPIKey, routes.DeleteCurrentUserAPIKey)      // Borra una API key del usuario autenticado
 	// ADMIN
-	users.Post("/", middleware.IsAdmin, routes.CreateUser)                   // Crea un usuario
-	users.Put("/:user_id", middleware.IsAdmin, routes.UpdateUser)            // Actualiza un usuario
-	users.Get("/", middleware.IsAdmin, routes.GetUsers)                      // Obtiene todos los usuarios
-	users.Delete("/:user_id", middleware.IsAdmin, routes.DeleteUser)         // Elimina un usuario
-	users.Get("/:user_id", middleware.IsAdmin, routes.GetUser)               // Obtiene un usuario
-	users.Get("/:user_id/videos", middleware.IsAdmin, routes.GetVideoByUser) // Obtiene los videos de un usuario
+	users.Post("/", middleware.IsAdmin, routes.CreateUser)                            // Crea un usuario
+	users.Put("/:user_id", middleware.IsAdmin, routes.UpdateUser)                     // Actualiza un usuario
+	users.Get("/", middleware.IsAdmin, routes.GetUsers)                               // Obtiene todos los usuarios
+	users.Delete("/:user_id", middleware.IsAdmin, routes.DeleteUser)                  // Elimina un usuario
+	users.Get("/:user_id", middleware.IsAdmin, routes.GetUser)                        // Obtiene un usuario
+	users.Get("/:user_id/videos", middleware.IsAdmin, routes.GetVideoByUser)          // Obtiene los videos de un usuario
+	users.Delete("/:user_id/sessions", middleware.IsAdmin, routes.RevokeUserSessions) // Cierra todas las sesiones de un usuario
 
 	/* -----------------------------------------------------------------
 	|                                                                   |
@@ -91,6 +193,19 @@ func main() {
 	cookies.Get("/", middleware.IsAdmin, routes.GetCookiesInfo)       // Comprobar si existe ya un archivo cookies.txt
 	cookies.Delete("/", middleware.IsAdmin, routes.DeleteCookiesFile) // Borrar el archivo de cookies si ya existe
 
+	/* -----------------------------------------------------------------
+	|                                                                   |
+	|                             JOBS                                  |
+	|                                                                   |
+	------------------------------------------------------------------- */
+	jobsGroup := api.Group("/jobs")
+	jobsGroup.Use(middleware.JWTProtected())
+	jobsGroup.Use(middleware.ValidUserAndActive)
+
+	// ADMIN
+	jobsGroup.Get("/", middleware.IsAdmin, routes.GetJobs)             // Obtiene los trabajos de la cola de procesamiento
+	jobsGroup.Delete("/:job_id", middleware.IsAdmin, routes.CancelJob) // Cancela cualquier trabajo en cola o en proceso
+
 	/* -----------------------------------------------------------------
 	|                                                                   |
 	|                             AUTH                                  |
@@ -98,7 +213,8 @@ func main() {
 	------------------------------------------------------------------- */
 	auth := api.Group("/auth")
 	auth.Post("/login", routes.Login)
-	auth.Get("/logout", routes.Logout)
+	auth.Post("/refresh", routes.Refresh)                          // Cambia el token de refresco por tokens nuevos
+	auth.Post("/logout", middleware.JWTProtected(), routes.Logout) // Cierra la sesión del token
 
 	port := cfg.Port
 	log.Printf("Server is running on port %s", port)
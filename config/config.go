@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +17,21 @@ type Config struct {
 	GoogleCloudApiKey    string
 	PyConverterPath      string
 	StoragePath          string
+	WorkerCount          int
+	JobMaxAttempts       int
+	Converter            string
+	ConverterFallback    string
+	FFmpegPath           string
+	MetadataProviders    string
+	YtDlpPath            string
+	CacheTTLMinutes      int
+	TranscodeProfiles    string
+	LoudnessTarget       float64
+	PlaylistMaxEntries   int
+	SubscriptionInterval int
+	SourceProviders      string
+	AccessTokenMinutes   int
+	RefreshTokenDays     int
 }
 
 func LoadConfig() Config {
@@ -33,6 +49,21 @@ func LoadConfig() Config {
 		GoogleCloudApiKey:    getEnv("GOOGLE_CLOUD_API_KEY", ""),
 		PyConverterPath:      getEnv("PYCONVERTER_PATH", "/home/andres/Desktop/Proyectos/yt-converter-api/pkg/pyConverter/main.py"),
 		StoragePath:          getEnv("STORAGE_PATH", "/home/andres/Desktop/Proyectos/yt-converter-api/storage"),
+		WorkerCount:          getEnvInt("WORKER_COUNT", 2),
+		JobMaxAttempts:       getEnvInt("JOB_MAX_ATTEMPTS", 3),
+		Converter:            getEnv("CONVERTER", "python"),
+		ConverterFallback:    getEnv("CONVERTER_FALLBACK", "python"),
+		FFmpegPath:           getEnv("FFMPEG_PATH", "ffmpeg"),
+		MetadataProviders:    getEnv("METADATA_PROVIDERS", "youtube-api,yt-dlp,oembed"),
+		YtDlpPath:            getEnv("YTDLP_PATH", "yt-dlp"),
+		CacheTTLMinutes:      getEnvInt("CACHE_TTL_MINUTES", 360),
+		TranscodeProfiles:    getEnv("TRANSCODE_PROFILES", ""),
+		LoudnessTarget:       getEnvFloat("LOUDNESS_TARGET", -16), // LUFS, el habitual en podcasts y música en streaming
+		PlaylistMaxEntries:   getEnvInt("PLAYLIST_MAX_ENTRIES", 200),
+		SubscriptionInterval: getEnvInt("SUBSCRIPTION_INTERVAL_MINUTES", 60),         // Intervalo por defecto de las suscripciones
+		SourceProviders:      getEnv("SOURCE_PROVIDERS", "youtube,vimeo,soundcloud"), // Sitios de los que se pueden agregar videos, generic acepta cualquier URL
+		AccessTokenMinutes:   getEnvInt("ACCESS_TOKEN_MINUTES", 15),                  // Duración de los tokens de acceso
+		RefreshTokenDays:     getEnvInt("REFRESH_TOKEN_DAYS", 30),                    // Días que se puede pasar una sesión sin refrescarse
 	}
 }
 
@@ -44,3 +75,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt obtiene una variable de entorno numérica o usa un valor por defecto si no existe o no es válida
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvFloat obtiene una variable de entorno decimal o usa un valor por defecto si no existe o no es válida
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
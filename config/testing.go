@@ -0,0 +1,20 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// SetTestEnv permite usar LoadConfig en las pruebas de otros paquetes: cambia a una carpeta temporal con un
+// .env vacío y establece las variables indicadas. Todo se restaura al terminar la prueba
+func SetTestEnv(t testing.TB, env map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile(".env", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
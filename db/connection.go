@@ -21,6 +21,7 @@ func InitDB() {
 		log.Println("Modo desarrollo activado, eliminando tablas y creando nuevas")
 		deleteTables()
 	}
+	migrate()
 	createTables()
 	log.Println("Creando administrador por defecto, credenciales: ", config.LoadConfig().DefaultAdminUsername, config.LoadConfig().DefaultAdminPassword)
 	createDefaultAdmin()
@@ -31,6 +32,17 @@ func deleteTables() {
 	DROP TABLE IF EXISTS users;
 	DROP TABLE IF EXISTS videos;
 	DROP TABLE IF EXISTS video_status;
+	DROP TABLE IF EXISTS video_status_files;
+	DROP TABLE IF EXISTS jobs;
+	DROP TABLE IF EXISTS lookup_cache;
+	DROP TABLE IF EXISTS playlist_videos;
+	DROP TABLE IF EXISTS playlists;
+	DROP TABLE IF EXISTS subscription_runs;
+	DROP TABLE IF EXISTS subscription_videos;
+	DROP TABLE IF EXISTS subscriptions;
+	DROP TABLE IF EXISTS sessions;
+	DROP TABLE IF EXISTS revoked_tokens;
+	DROP TABLE IF EXISTS api_keys;
 	`
 	_, err := DB.Exec(query)
 	if err != nil {
@@ -58,20 +70,169 @@ func createTables() {
 		requested_by_ip TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		duration INTEGER,
+		channel_name TEXT,
+		channel_id TEXT,
+		upload_date TEXT,
+		description TEXT,
+		view_count INTEGER,
+		thumbnail_url TEXT,
+		is_live BOOLEAN DEFAULT FALSE,
+		is_short BOOLEAN DEFAULT FALSE,
+		age_restricted BOOLEAN DEFAULT FALSE,
+		metadata_provider TEXT,
+		metadata_updated_at DATETIME,
+		provider TEXT NOT NULL DEFAULT 'youtube',
+		external_id TEXT,
 		FOREIGN KEY(user_id) REFERENCES users(id),
 		UNIQUE(video_id)
 	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_videos_source ON videos(provider, external_id);
 	CREATE TABLE IF NOT EXISTS video_status (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		video_id TEXT NOT NULL,
 		resolution TEXT NOT NULL,
 		path TEXT,
-		status TEXT CHECK(status IN ('processing', 'completed', 'failed')) NOT NULL,
+		status TEXT CHECK(status IN ('processing', 'completed', 'failed', 'cancelled')) NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		progress TEXT,
+		format TEXT,
+		profile TEXT,
+		loudness TEXT,
 		FOREIGN KEY(video_id) REFERENCES videos(video_id),
 		UNIQUE(video_id, resolution)
 	);
+	CREATE TABLE IF NOT EXISTS video_status_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		video_id TEXT NOT NULL,
+		resolution TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		path TEXT NOT NULL,
+		start_time REAL NOT NULL,
+		end_time REAL NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(video_id),
+		UNIQUE(video_id, resolution, position)
+	);
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		video_id TEXT NOT NULL,
+		resolution TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '{}',
+		status TEXT CHECK(status IN ('queued', 'processing', 'completed', 'failed', 'cancelled')) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		started_at DATETIME,
+		finished_at DATETIME,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(video_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, id);
+	-- Solo puede haber un trabajo pendiente por video y resolución
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_pending ON jobs(video_id, resolution) WHERE status IN ('queued', 'processing');
+	CREATE TABLE IF NOT EXISTS lookup_cache (
+		kind TEXT CHECK(kind IN ('formats', 'metadata')) NOT NULL,
+		video_id TEXT NOT NULL,
+		cookie_profile TEXT NOT NULL,
+		data TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		PRIMARY KEY(kind, video_id, cookie_profile)
+	);
+	CREATE TABLE IF NOT EXISTS playlists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		playlist_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		channel_name TEXT,
+		requested_by_ip TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		UNIQUE(playlist_id)
+	);
+	CREATE TABLE IF NOT EXISTS playlist_videos (
+		playlist_id INTEGER NOT NULL,
+		video_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		FOREIGN KEY(playlist_id) REFERENCES playlists(id),
+		FOREIGN KEY(video_id) REFERENCES videos(video_id),
+		PRIMARY KEY(playlist_id, position)
+	);
+	CREATE TABLE IF NOT EXISTS subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		kind TEXT CHECK(kind IN ('channel', 'playlist')) NOT NULL,
+		source_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		resolution TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '{}',
+		interval_minutes INTEGER NOT NULL,
+		active BOOLEAN DEFAULT TRUE,
+		requested_by_ip TEXT NOT NULL,
+		last_checked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		UNIQUE(user_id, source_id, resolution)
+	);
+	CREATE TABLE IF NOT EXISTS subscription_videos (
+		subscription_id INTEGER NOT NULL,
+		video_id TEXT NOT NULL,
+		job_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(subscription_id) REFERENCES subscriptions(id),
+		PRIMARY KEY(subscription_id, video_id)
+	);
+	CREATE TABLE IF NOT EXISTS subscription_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		subscription_id INTEGER NOT NULL,
+		status TEXT CHECK(status IN ('processing', 'completed', 'failed')) NOT NULL,
+		found INTEGER NOT NULL DEFAULT 0,
+		new_videos INTEGER NOT NULL DEFAULT 0,
+		queued INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME,
+		FOREIGN KEY(subscription_id) REFERENCES subscriptions(id)
+	);
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		refresh_token_hash TEXT NOT NULL UNIQUE,
+		previous_token_hash TEXT,
+		access_jti TEXT NOT NULL,
+		access_expires_at DATETIME NOT NULL,
+		ip TEXT NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_sessions_previous ON sessions(previous_token_hash);
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		expires_at DATETIME,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
 	`
 
 	_, err := DB.Exec(query)
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// migrate actualiza el esquema de las bases de datos creadas con versiones anteriores.
+// Todas las migraciones deben poder ejecutarse varias veces y no hacer nada si la tabla no existe todavía
+func migrate() {
+	migrations := []struct {
+		name string
+		run  func() error
+	}{
+		{"video_status admite el estado cancelled", func() error {
+			return replaceInTableSchema("video_status",
+				"CHECK(status IN ('processing', 'completed', 'failed'))",
+				"CHECK(status IN ('processing', 'completed', 'failed', 'cancelled'))")
+		}},
+		{"jobs admite el estado cancelled", func() error {
+			return replaceInTableSchema("jobs",
+				"CHECK(status IN ('queued', 'processing', 'completed', 'failed'))",
+				"CHECK(status IN ('queued', 'processing', 'completed', 'failed', 'cancelled'))")
+		}},
+		{"video_status guarda el progreso", func() error {
+			return addColumn("video_status", "progress", "TEXT")
+		}},
+		{"videos guarda los metadatos", func() error {
+			columns := [][2]string{
+				{"duration", "INTEGER"},
+				{"channel_name", "TEXT"},
+				{"channel_id", "TEXT"},
+				{"upload_date", "TEXT"},
+				{"description", "TEXT"},
+				{"view_count", "INTEGER"},
+				{"thumbnail_url", "TEXT"},
+				{"is_live", "BOOLEAN DEFAULT FALSE"},
+				{"is_short", "BOOLEAN DEFAULT FALSE"},
+				{"age_restricted", "BOOLEAN DEFAULT FALSE"},
+				{"metadata_provider", "TEXT"},
+				{"metadata_updated_at", "DATETIME"},
+			}
+			for _, column := range columns {
+				if err := addColumn("videos", column[0], column[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"video_status guarda el formato de salida", func() error {
+			return addColumn("video_status", "format", "TEXT")
+		}},
+		{"video_status guarda el perfil de transcodificación", func() error {
+			return addColumn("video_status", "profile", "TEXT")
+		}},
+		{"video_status guarda la sonoridad del audio normalizado", func() error {
+			return addColumn("video_status", "loudness", "TEXT")
+		}},
+		{"videos guarda el proveedor y el ID externo", func() error {
+			if err := addColumn("videos", "provider", "TEXT NOT NULL DEFAULT 'youtube'"); err != nil {
+				return err
+			}
+			if err := addColumn("videos", "external_id", "TEXT"); err != nil {
+				return err
+			}
+			// Los videos anteriores son todos de YouTube y su video_id es el ID de YouTube
+			if exists, err := tableExists("videos"); err != nil || !exists {
+				return err
+			}
+			_, err := DB.Exec("UPDATE videos SET external_id = video_id WHERE external_id IS NULL")
+			return err
+		}},
+	}
+
+	for _, m := range migrations {
+		if err := m.run(); err != nil {
+			log.Fatalf("Error aplicando la migración \"%s\": %v", m.name, err)
+		}
+	}
+}
+
+// replaceInTableSchema reconstruye una tabla cambiando un fragmento de su definición, SQLite no permite modificar
+// restricciones CHECK con ALTER TABLE así que se crea la tabla nueva y se copian los datos
+func replaceInTableSchema(table string, oldFragment string, newFragment string) error {
+	var schema string
+	err := DB.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&schema)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(schema, oldFragment) {
+		return nil
+	}
+
+	log.Printf("Migrando la tabla %s", table)
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s_old", table, table),
+		strings.Replace(schema, oldFragment, newFragment, 1),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s_old", table, table),
+		fmt.Sprintf("DROP TABLE %s_old", table),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// tableExists indica si la tabla ya está creada
+func tableExists(table string) (bool, error) {
+	var exists int
+	err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", table).Scan(&exists)
+	return exists == 1, err
+}
+
+// addColumn añade una columna a una tabla existente si todavía no la tiene
+func addColumn(table string, column string, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := false
+	exists := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		found = true
+		if name == column {
+			exists = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// Si la tabla no existe se creará más adelante con la columna incluida
+	if !found || exists {
+		return nil
+	}
+
+	log.Printf("Añadiendo la columna %s.%s", table, column)
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
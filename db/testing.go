@@ -0,0 +1,26 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// OpenTestDB sustituye DB por una base de datos vacía con el mismo esquema que crea InitDB, para las pruebas
+// de otros paquetes. Se crea en un archivo temporal y no en :memory: para que, como en producción, se puedan
+// usar varias conexiones a la vez. No crea el administrador por defecto y al terminar la prueba restaura DB
+func OpenTestDB(t testing.TB) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "database.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB
+	DB = conn
+	t.Cleanup(func() {
+		DB = previous
+		conn.Close()
+	})
+	createTables()
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/chapters"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/tags"
+)
+
+// loadChapters obtiene los capítulos del backend y, si no los da, de la descripción guardada del video
+func loadChapters(ctx context.Context, videoID string, cookiesPath string) ([]chapters.Chapter, error) {
+	info, err := converter.Current.Probe(ctx, VideoSource(videoID).Ref(), cookiesPath)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los capítulos del video: %v", err)
+	}
+	list := info.Chapters
+
+	if len(list) == 0 {
+		var description string
+		var duration float64
+		_ = db.DB.QueryRow("SELECT COALESCE(description, ''), COALESCE(duration, 0) FROM videos WHERE video_id = ?", videoID).Scan(&description, &duration)
+		if duration == 0 {
+			duration = info.Duration
+		}
+		list = chapters.FromDescription(description, duration)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("el video no tiene capítulos")
+	}
+	return list, nil
+}
+
+// splitChapters divide el audio descargado en una pista por capítulo y las mueve a la carpeta de la variante
+// en StoragePath (<video_id>-<variante>/), guarda cada pista en video_status_files y devuelve la carpeta.
+// Si audio no es nil cada pista se etiqueta con el título del capítulo y su número
+func splitChapters(ctx context.Context, videoID string, resolution string, list []chapters.Chapter, workPath string, audio *tags.Tags, cover []byte, reporter *progressReporter) (string, error) {
+	tracksDir := filepath.Join(filepath.Dir(workPath), "chapters")
+	tracks, err := chapters.Split(ctx, config.LoadConfig().FFmpegPath, workPath, tracksDir, list, reporter.report)
+	if err != nil {
+		return "", err
+	}
+	os.Remove(workPath)
+
+	if audio != nil {
+		for _, track := range tracks {
+			trackTags := *audio
+			if track.Title != "" {
+				trackTags.Title = track.Title
+			}
+			trackTags.Track = fmt.Sprintf("%d/%d", track.Position, len(tracks))
+			if err := tags.Embed(ctx, config.LoadConfig().FFmpegPath, track.Path, trackTags, cover); err != nil {
+				os.RemoveAll(tracksDir)
+				return "", err
+			}
+		}
+	}
+
+	files := make([]models.File, 0, len(tracks))
+	for _, track := range tracks {
+		files = append(files, models.File{Position: track.Position, Title: track.Title, Path: track.Path, Start: track.Start, End: track.End})
+	}
+	return storeFiles(videoID, resolution, tracksDir, files)
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"sync"
+	"yt-converter-api/models"
+)
+
+// Event es un cambio en el procesamiento de un video que se envía a los clientes suscritos
+type Event struct {
+	Type       string           `json:"type"` // status o progress
+	VideoID    string           `json:"video_id"`
+	Resolution string           `json:"resolution"`
+	JobID      int64            `json:"job_id,omitempty"`
+	Status     string           `json:"status,omitempty"`
+	Progress   *models.Progress `json:"progress,omitempty"`
+}
+
+const (
+	EventStatus   = "status"
+	EventProgress = "progress"
+)
+
+var (
+	subscribers   = map[string]map[chan Event]struct{}{}
+	subscribersMu sync.Mutex
+)
+
+// Subscribe devuelve un canal con los eventos de un video y la función para dejar de recibirlos
+func Subscribe(videoID string) (<-chan Event, func()) {
+	ch := make(chan Event, 32)
+
+	subscribersMu.Lock()
+	if subscribers[videoID] == nil {
+		subscribers[videoID] = map[chan Event]struct{}{}
+	}
+	subscribers[videoID][ch] = struct{}{}
+	subscribersMu.Unlock()
+
+	unsubscribe := func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+		if _, ok := subscribers[videoID][ch]; !ok {
+			return
+		}
+		delete(subscribers[videoID], ch)
+		if len(subscribers[videoID]) == 0 {
+			delete(subscribers, videoID)
+		}
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// publish envía un evento a los suscriptores del video, si alguno va atrasado se descarta el evento para él
+func publish(event Event) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	for ch := range subscribers[event.VideoID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
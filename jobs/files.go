@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+)
+
+// storeFiles mueve la carpeta srcDir con los archivos de una variante de varias pistas (capítulos o
+// subtítulos) a StoragePath como <video_id>-<variante>/, guarda cada archivo en video_status_files y
+// devuelve la carpeta final. Las rutas de files deben estar dentro de srcDir
+func storeFiles(videoID string, resolution string, srcDir string, files []models.File) (string, error) {
+	// Si quedó una carpeta de un procesamiento anterior se reemplaza
+	dir := filepath.Join(config.LoadConfig().StoragePath, fmt.Sprintf("%s-%s", videoID, resolution))
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("error al borrar los archivos anteriores: %v", err)
+	}
+	if err := os.Rename(srcDir, dir); err != nil {
+		return "", fmt.Errorf("error al mover los archivos procesados: %v", err)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error al guardar los archivos procesados: %v", err)
+	}
+	_, _ = tx.Exec("DELETE FROM video_status_files WHERE video_id = ? AND resolution = ?", videoID, resolution)
+	for _, file := range files {
+		_, err = tx.Exec("INSERT INTO video_status_files (video_id, resolution, position, title, path, start_time, end_time) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			videoID, resolution, file.Position, file.Title, filepath.Join(dir, filepath.Base(file.Path)), file.Start, file.End)
+		if err != nil {
+			tx.Rollback()
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("error al guardar los archivos procesados: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("error al guardar los archivos procesados: %v", err)
+	}
+	return dir, nil
+}
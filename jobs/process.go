@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/chapters"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/loudness"
+	"yt-converter-api/pkg/sources"
+	"yt-converter-api/pkg/subtitles"
+	"yt-converter-api/pkg/tags"
+	"yt-converter-api/pkg/transcode"
+)
+
+// Procesa un video de Youtube de forma asíncrona, workDir es la carpeta temporal del trabajo dentro de StoragePath
+func ProcessYoutubeVideo(ctx context.Context, job *models.Job, payload Payload, workDir string) (string, error) {
+	videoID, resolution, isAudio, cookiesPath := job.VideoID, job.Resolution, payload.IsAudio, payload.CookiesPath
+
+	// Las resoluciones se traducen a un formato concreto con la lista de formatos (normalmente ya en caché
+	// por el endpoint de formatos), así el backend descarga directamente sin volver a extraer la lista.
+	// Los formatos concretos ya se validaron al encolar el trabajo
+	// La variante puede incluir el fragmento y el perfil de transcodificación: <resolución>~<inicio>-<fin>@<perfil>,
+	// la resolución es la parte que se descarga
+	selector, _, _ := strings.Cut(resolution, "@")
+	selector, _, _ = strings.Cut(selector, "~")
+	ref := VideoSource(videoID).Ref()
+	formatID := payload.FormatID
+	if !isAudio && !payload.SubtitlesOnly && formatID == "" {
+		formats, err := converter.Current.ListFormats(ctx, ref, cookiesPath)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", fmt.Errorf("error al obtener las resoluciones del video: %v", err)
+		}
+		format, err := converter.SelectFormat(formats, selector)
+		if err != nil {
+			return "", fmt.Errorf("la resolución %s no está disponible", selector)
+		}
+		formatID = format.ID
+	}
+
+	// El audio se guarda con la variante de sus opciones (mp3, opus-128k, flac-48000hz...), ya incluida en la
+	// resolución del trabajo
+	var audio converter.AudioOptions
+	outputFormat := "mp4"
+	if isAudio {
+		if payload.Audio != nil {
+			audio = *payload.Audio
+		}
+		outputFormat = strings.TrimPrefix(audio.Extension(), ".")
+	} else if payload.SubtitlesOnly {
+		outputFormat = payload.SubtitleFormat
+	} else if profile, ok := transcode.Get(payload.Profile); ok {
+		outputFormat = profile.Container
+	}
+
+	// Comprobar si ya está procesado con esa resolución
+	var exists int
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM video_status WHERE video_id = ? AND resolution = ? and status = ?)", videoID, resolution, "completed").Scan(&exists)
+	if err != nil {
+		return "", fmt.Errorf("error al verificar si el video ya está procesado: %v", err)
+	}
+	if exists == 1 {
+		_, _ = db.DB.Exec("UPDATE video_status SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ? and resolution = ? and status = ?", videoID, resolution, "completed")
+		return "", fmt.Errorf("el video con id %v y resolución %v ya está procesado", videoID, resolution)
+	}
+
+	// Borrar estado fallido o cancelado previo
+	_, _ = db.DB.Exec("DELETE FROM video_status WHERE video_id = ? AND resolution = ? and status IN (?, ?)", videoID, resolution, models.Failed, models.Cancelled)
+	_, _ = db.DB.Exec("DELETE FROM video_status_files WHERE video_id = ? AND resolution = ?", videoID, resolution)
+
+	// Insertar nuevo estado: procesando
+	_, err = db.DB.Exec("INSERT INTO video_status (video_id, resolution, status, format, profile) VALUES (?, ?, ?, ?, ?)",
+		videoID, resolution, "processing", outputFormat, payload.Profile)
+	if err != nil {
+		return "", fmt.Errorf("error al insertar el estado del video: %v", err)
+	}
+	publish(Event{Type: EventStatus, VideoID: videoID, Resolution: resolution, JobID: job.ID, Status: models.Processing})
+
+	// El script descarga en la carpeta del trabajo, así los archivos parciales no se mezclan con los ya procesados
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		setStatus(job.ID, videoID, resolution, models.Failed)
+		return "", fmt.Errorf("error al crear la carpeta de trabajo: %v", err)
+	}
+
+	// Solo subtítulos: la variante es una carpeta con un archivo por pista y no se descarga el video
+	subtitlesDir := filepath.Join(workDir, "subtitles")
+	if payload.SubtitlesOnly {
+		files, _, err := fetchSubtitles(ctx, videoID, cookiesPath, payload.Subtitles, payload.SubtitleFormat, payload.Clip, subtitlesDir)
+		if err == nil {
+			var dir string
+			if dir, err = storeFiles(videoID, resolution, subtitlesDir, files); err == nil {
+				return dir, complete(job.ID, videoID, resolution, dir, payload.SubtitleFormat)
+			}
+		}
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		setStatus(job.ID, videoID, resolution, models.Failed)
+		return "", err
+	}
+
+	// Los subtítulos que se incrustan en el video se descargan antes para no descargar en balde el video si
+	// no están disponibles
+	var subtitleTracks []subtitles.Track
+	if len(payload.Subtitles) > 0 {
+		files, selected, err := fetchSubtitles(ctx, videoID, cookiesPath, payload.Subtitles, subtitles.FormatSRT, payload.Clip, subtitlesDir)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+		for i, file := range files {
+			subtitleTracks = append(subtitleTracks, subtitles.Track{Path: file.Path, Language: selected[i].Language, Title: file.Title})
+		}
+	}
+
+	// Los capítulos se leen antes de descargar para no descargar en balde un video que no los tiene
+	var chapterList []chapters.Chapter
+	if payload.Chapters {
+		chapterList, err = loadChapters(ctx, videoID, cookiesPath)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+	}
+
+	// Convertir con el backend configurado, si se cancela el trabajo el backend detiene la descarga
+	reporter := &progressReporter{jobID: job.ID, videoID: videoID, resolution: resolution}
+	workPath, err := converter.Current.Convert(ctx, converter.Request{
+		VideoID:     ref,
+		IsAudio:     isAudio,
+		Audio:       audio,
+		Resolution:  selector,
+		FormatID:    formatID,
+		Clip:        payload.Clip,
+		CookiesPath: cookiesPath,
+		OutputDir:   workDir,
+	}, reporter.report)
+	if ctx.Err() != nil {
+		setStatus(job.ID, videoID, resolution, models.Cancelled)
+		return "", ctx.Err()
+	}
+	if err != nil {
+		// Fallo: marcar en base de datos
+		setStatus(job.ID, videoID, resolution, models.Failed)
+		return "", err
+	}
+
+	// Recodificar con el perfil elegido, el archivo descargado se sustituye por el recodificado
+	if payload.Profile != "" {
+		profile, ok := transcode.Get(payload.Profile)
+		if !ok {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", fmt.Errorf("el perfil de transcodificación %s no existe", payload.Profile)
+		}
+		workPath, err = transcode.Run(ctx, config.LoadConfig().FFmpegPath, profile, workPath, outputDuration(videoID, payload.Clip), reporter.report)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+	}
+
+	// Normalizar la sonoridad del audio en dos pasadas, antes de dividir por capítulos para que todas las
+	// pistas conserven el volumen relativo entre ellas
+	if isAudio && audio.Loudness != 0 {
+		result, err := loudness.Normalize(ctx, config.LoadConfig().FFmpegPath, workPath, audio.Loudness, audio.EncodeArgs(), outputDuration(videoID, payload.Clip), func(percent float64) {
+			reporter.report(models.Progress{Phase: "normalize", Percent: &percent})
+		})
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+		saveLoudness(videoID, resolution, result)
+	}
+
+	// Incrustar los subtítulos como pistas seleccionables, sin recodificar
+	if len(subtitleTracks) > 0 {
+		err = subtitles.Embed(ctx, config.LoadConfig().FFmpegPath, workPath, subtitleTracks)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+	}
+
+	// Etiquetar el audio con los metadatos del video y su miniatura como carátula
+	var audioTagsValue *tags.Tags
+	var cover []byte
+	if isAudio && !payload.SkipTags && tags.Supported(filepath.Ext(workPath)) {
+		value, image := audioTags(ctx, videoID, payload.Tags)
+		audioTagsValue, cover = &value, image
+	}
+
+	// Separar los capítulos, la variante se guarda como una carpeta con una pista por capítulo
+	if payload.Chapters {
+		dir, err := splitChapters(ctx, videoID, resolution, chapterList, workPath, audioTagsValue, cover, reporter)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+		return dir, complete(job.ID, videoID, resolution, dir, strings.TrimPrefix(filepath.Ext(workPath), "."))
+	}
+
+	if audioTagsValue != nil {
+		err = tags.Embed(ctx, config.LoadConfig().FFmpegPath, workPath, *audioTagsValue, cover)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+		if err != nil {
+			setStatus(job.ID, videoID, resolution, models.Failed)
+			return "", err
+		}
+	}
+
+	// Hoja de contactos y vista previa animada del video, reemplazan a las de otras variantes
+	if payload.Previews {
+		generatePreviews(ctx, videoID, workPath, payload.Clip)
+		if ctx.Err() != nil {
+			setStatus(job.ID, videoID, resolution, models.Cancelled)
+			return "", ctx.Err()
+		}
+	}
+
+	// Mover el archivo final desde la carpeta del trabajo a StoragePath, el nombre incluye la variante
+	// para que dos formatos con la misma resolución no se sobrescriban
+	videoPath := filepath.Join(config.LoadConfig().StoragePath, fmt.Sprintf("%s-%s%s", videoID, resolution, filepath.Ext(workPath)))
+	if err := os.Rename(workPath, videoPath); err != nil {
+		setStatus(job.ID, videoID, resolution, models.Failed)
+		return "", fmt.Errorf("error al mover el archivo procesado: %v", err)
+	}
+
+	// Guardar estado exitoso con la ruta del archivo
+	return videoPath, complete(job.ID, videoID, resolution, videoPath, strings.TrimPrefix(filepath.Ext(videoPath), "."))
+}
+
+// complete marca el video procesado como completado con la ruta y el formato del resultado
+func complete(jobID int64, videoID string, resolution string, path string, format string) error {
+	_, err := db.DB.Exec("UPDATE video_status SET status = ?, path = ?, format = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?",
+		"completed", path, format, videoID, resolution)
+	if err != nil {
+		return fmt.Errorf("error al actualizar el estado del video: %v", err)
+	}
+	publish(Event{Type: EventStatus, VideoID: videoID, Resolution: resolution, JobID: jobID, Status: models.Completed})
+	return nil
+}
+
+// outputDuration devuelve la duración del resultado, la del fragmento o la del video, para calcular el
+// progreso de ffmpeg. Es cero si no se conoce
+func outputDuration(videoID string, clip *converter.Clip) time.Duration {
+	var duration float64
+	if clip != nil {
+		duration = clip.Duration()
+	} else {
+		_ = db.DB.QueryRow("SELECT COALESCE(duration, 0) FROM videos WHERE video_id = ?", videoID).Scan(&duration)
+	}
+	return time.Duration(duration * float64(time.Second))
+}
+
+// saveLoudness guarda las medidas de la normalización en la fila de video_status de la variante
+func saveLoudness(videoID string, resolution string, result models.Loudness) {
+	data, err := json.Marshal(result)
+	if err == nil {
+		_, err = db.DB.Exec("UPDATE video_status SET loudness = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?", string(data), videoID, resolution)
+	}
+	if err != nil {
+		fmt.Printf("Error guardando la sonoridad del video %s: %v\n", videoID, err)
+	}
+}
+
+// setStatus actualiza el estado de un video procesado y avisa a los clientes suscritos
+func setStatus(jobID int64, videoID string, resolution string, status string) {
+	_, err := db.DB.Exec("UPDATE video_status SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?", status, videoID, resolution)
+	if err != nil {
+		fmt.Printf("Error actualizando estado a %s: %v\n", status, err)
+	}
+	publish(Event{Type: EventStatus, VideoID: videoID, Resolution: resolution, JobID: jobID, Status: status})
+}
+
+// VideoSource devuelve el sitio de origen de un video guardado. Los videos que no están en la base de datos
+// se tratan como videos de YouTube
+func VideoSource(videoID string) sources.Source {
+	source := sources.Source{Provider: sources.ProviderYoutube, ExternalID: videoID}
+	_ = db.DB.QueryRow("SELECT provider, COALESCE(external_id, video_id) FROM videos WHERE video_id = ?", videoID).Scan(&source.Provider, &source.ExternalID)
+	return source
+}
+
+// workDirFor devuelve la carpeta temporal donde se descarga un trabajo
+func workDirFor(jobID int64) string {
+	return filepath.Join(config.LoadConfig().StoragePath, ".work", fmt.Sprintf("job-%d", jobID))
+}
@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/converter"
+)
+
+// setupProcessing prepara la base de datos, el backend fake y una carpeta de almacenamiento con un video
+// agregado, devuelve la carpeta
+func setupProcessing(t *testing.T) string {
+	t.Helper()
+	storage := t.TempDir()
+	config.SetTestEnv(t, map[string]string{"STORAGE_PATH": storage})
+	db.OpenTestDB(t)
+
+	previous := converter.Current
+	converter.Current = converter.NewFake()
+	t.Cleanup(func() { converter.Current = previous })
+
+	_, err := db.DB.Exec("INSERT INTO videos (user_id, video_id, external_id, title, requested_by_ip) VALUES (1, 'dQw4w9WgXcQ', 'dQw4w9WgXcQ', 'Video', '127.0.0.1')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+// runNext reclama el siguiente trabajo y lo ejecuta como lo haría un worker
+func runNext(t *testing.T) *models.Job {
+	t.Helper()
+	job, err := claimNext()
+	if err != nil || job == nil {
+		t.Fatalf("claimNext() = %v, %v, se esperaba un trabajo", job, err)
+	}
+	run(1, job)
+	job, err = GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	return job
+}
+
+func TestRunCompletesJob(t *testing.T) {
+	storage := setupProcessing(t)
+
+	if _, err := Enqueue(1, "dQw4w9WgXcQ", "720p", Payload{}); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	job := runNext(t)
+	if job.Status != models.Completed {
+		t.Fatalf("se esperaba el trabajo completado, se obtuvo %s (%s)", job.Status, job.Error)
+	}
+
+	var status, path string
+	err := db.DB.QueryRow("SELECT status, path FROM video_status WHERE video_id = 'dQw4w9WgXcQ' AND resolution = '720p'").Scan(&status, &path)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if status != models.Completed || path != filepath.Join(storage, "dQw4w9WgXcQ-720p.mp4") {
+		t.Errorf("estado = %s, %s, se esperaba completed en dQw4w9WgXcQ-720p.mp4", status, path)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "fake:dQw4w9WgXcQ:720p:audio=false\n" {
+		t.Errorf("contenido = %q, %v", content, err)
+	}
+	if _, err := os.Stat(workDirFor(job.ID)); !os.IsNotExist(err) {
+		t.Error("se esperaba borrada la carpeta del trabajo")
+	}
+}
+
+func TestRunFailsUnavailableVideo(t *testing.T) {
+	setupProcessing(t)
+	converter.Current.(*converter.Fake).Unavailable["dQw4w9WgXcQ"] = true
+
+	if _, err := Enqueue(1, "dQw4w9WgXcQ", "720p", Payload{IsAudio: true}); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if job := runNext(t); job.Status != models.Failed || job.Error == "" {
+		t.Errorf("se esperaba el trabajo fallido con su error, se obtuvo %s (%s)", job.Status, job.Error)
+	}
+}
+
+func TestRunCancelledBeforeStart(t *testing.T) {
+	setupProcessing(t)
+
+	if _, err := Enqueue(1, "dQw4w9WgXcQ", "720p", Payload{}); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	job, err := claimNext()
+	if err != nil || job == nil {
+		t.Fatalf("claimNext() = %v, %v, se esperaba un trabajo", job, err)
+	}
+	// Se cancela entre que el worker lo reclama y lo ejecuta
+	if err := Cancel(job.ID); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	run(1, job)
+
+	if job, _ = GetJob(job.ID); job.Status != models.Cancelled {
+		t.Errorf("se esperaba el trabajo cancelado, se obtuvo %s", job.Status)
+	}
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if len(running) != 0 || len(cancelRequested) != 0 {
+		t.Errorf("se esperaba sin trabajos en ejecución ni cancelaciones pendientes, quedan %d y %d", len(running), len(cancelRequested))
+	}
+}
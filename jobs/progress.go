@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+)
+
+// Cada cuánto se guarda como mucho el progreso en la base de datos
+const progressSaveInterval = time.Second
+
+// progressReporter publica el progreso de un trabajo y lo guarda en su fila de video_status
+type progressReporter struct {
+	jobID      int64
+	videoID    string
+	resolution string
+	lastSave   time.Time
+	lastPhase  string
+}
+
+func (r *progressReporter) report(progress models.Progress) {
+	publish(Event{Type: EventProgress, VideoID: r.videoID, Resolution: r.resolution, JobID: r.jobID, Progress: &progress})
+
+	// No hace falta escribir en la base de datos cada actualización, salvo los cambios de fase y los finales
+	finished := progress.Percent != nil && *progress.Percent >= 100
+	if progress.Phase == r.lastPhase && !finished && time.Since(r.lastSave) < progressSaveInterval {
+		return
+	}
+	r.lastPhase = progress.Phase
+	r.lastSave = time.Now()
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+	_, err = db.DB.Exec("UPDATE video_status SET progress = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?", string(data), r.videoID, r.resolution)
+	if err != nil {
+		fmt.Printf("Error guardando el progreso del video %s: %v\n", r.videoID, err)
+	}
+}
@@ -0,0 +1,371 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/tags"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Payload contiene las opciones de procesamiento que se guardan junto al trabajo
+type Payload struct {
+	IsAudio     bool   `json:"is_audio"`
+	CookiesPath string `json:"cookies_path,omitempty"`
+	FormatID    string `json:"format_id,omitempty"` // Formato de video concreto elegido en POST /process
+	Profile     string `json:"profile,omitempty"`   // Perfil de transcodificación que se aplica tras la descarga
+
+	// Fragmento del video que se descarga, nil para el video completo
+	Clip *converter.Clip `json:"clip,omitempty"`
+
+	// Divide el audio en una pista por capítulo
+	Chapters bool `json:"chapters,omitempty"`
+
+	// Pistas de subtítulos (IDs de GET /subtitles) que se incrustan en el video o, con SubtitlesOnly, se
+	// guardan como archivos en SubtitleFormat sin descargar el video
+	Subtitles      []string `json:"subtitles,omitempty"`
+	SubtitleFormat string   `json:"subtitle_format,omitempty"`
+	SubtitlesOnly  bool     `json:"subtitles_only,omitempty"`
+
+	// Generar la hoja de contactos y la vista previa animada del video al terminar
+	Previews bool `json:"previews,omitempty"`
+
+	// Etiquetas del audio que reemplazan a las obtenidas de los metadatos del video, SkipTags deja el audio
+	// sin etiquetas ni carátula
+	Tags     *tags.Tags `json:"tags,omitempty"`
+	SkipTags bool       `json:"skip_tags,omitempty"`
+
+	// Formato, bitrate y frecuencia del audio, los trabajos anteriores no lo tienen y generan MP3
+	Audio *converter.AudioOptions `json:"audio,omitempty"`
+}
+
+// ErrAlreadyQueued se devuelve cuando ya existe un trabajo pendiente para el mismo video y resolución
+var ErrAlreadyQueued = errors.New("ya existe un trabajo pendiente para este video y resolución")
+
+// ErrNotCancellable se devuelve cuando el trabajo ya ha terminado y no se puede cancelar
+var ErrNotCancellable = errors.New("el trabajo ya ha terminado")
+
+// Intervalo con el que los workers revisan la cola aunque no reciban aviso
+const pollInterval = 5 * time.Second
+
+var (
+	// notify despierta a un worker cuando se encola un trabajo nuevo
+	notify = make(chan struct{}, 1)
+	// claimMu evita que dos workers reclamen el mismo trabajo
+	claimMu sync.Mutex
+	// running guarda la función de cancelación de los trabajos que se están ejecutando
+	running         = map[int64]context.CancelFunc{}
+	cancelRequested = map[int64]bool{}
+	runningMu       sync.Mutex
+)
+
+// Start recupera los trabajos interrumpidos y lanza el número de workers indicado
+func Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	recoverInterrupted(config.LoadConfig().JobMaxAttempts)
+	// Borrar los archivos parciales que hayan quedado de trabajos interrumpidos
+	if err := os.RemoveAll(filepath.Join(config.LoadConfig().StoragePath, ".work")); err != nil {
+		log.Println("Error borrando las carpetas de trabajo antiguas:", err)
+	}
+	for i := 1; i <= workers; i++ {
+		go worker(i)
+	}
+	log.Printf("Cola de trabajos iniciada con %d workers", workers)
+}
+
+// Enqueue guarda un trabajo nuevo en la base de datos y avisa a los workers
+func Enqueue(userID int, videoID string, resolution string, payload Payload) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("error al serializar el trabajo: %v", err)
+	}
+
+	// El índice único idx_jobs_pending impide que dos peticiones simultáneas encolen el mismo video y resolución
+	res, err := db.DB.Exec("INSERT INTO jobs (user_id, video_id, resolution, payload, status) VALUES (?, ?, ?, ?, ?)", userID, videoID, resolution, string(data), models.Queued)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return 0, ErrAlreadyQueued
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error al insertar el trabajo: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error al obtener el ID del trabajo: %v", err)
+	}
+
+	publish(Event{Type: EventStatus, VideoID: videoID, Resolution: resolution, JobID: id, Status: models.Queued})
+	wake()
+	return id, nil
+}
+
+// GetJobs devuelve los trabajos, opcionalmente filtrados por estado
+func GetJobs(status string) ([]models.Job, error) {
+	query := "SELECT id, user_id, video_id, resolution, payload, status, attempts, error, created_at, updated_at, started_at, finished_at FROM jobs"
+	var args []any
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetJob devuelve un trabajo por su ID
+func GetJob(id int64) (*models.Job, error) {
+	row := db.DB.QueryRow("SELECT id, user_id, video_id, resolution, payload, status, attempts, error, created_at, updated_at, started_at, finished_at FROM jobs WHERE id = ?", id)
+	return scanJob(row)
+}
+
+// FindPending devuelve el trabajo en cola o en proceso de un video y resolución
+func FindPending(videoID string, resolution string) (*models.Job, error) {
+	row := db.DB.QueryRow("SELECT id, user_id, video_id, resolution, payload, status, attempts, error, created_at, updated_at, started_at, finished_at FROM jobs WHERE video_id = ? AND resolution = ? AND status IN (?, ?) ORDER BY id DESC LIMIT 1", videoID, resolution, models.Queued, models.Processing)
+	return scanJob(row)
+}
+
+// Cancel cancela un trabajo: si está en cola no llega a ejecutarse y si está en proceso se mata el proceso de conversión
+func Cancel(id int64) error {
+	// Si todavía está en cola basta con marcarlo como cancelado
+	res, err := db.DB.Exec("UPDATE jobs SET status = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", models.Cancelled, id, models.Queued)
+	if err != nil {
+		return fmt.Errorf("error al cancelar el trabajo: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if job, err := GetJob(id); err == nil {
+			publish(Event{Type: EventStatus, VideoID: job.VideoID, Resolution: job.Resolution, JobID: id, Status: models.Cancelled})
+		}
+		return nil
+	}
+
+	// El estado se lee con runningMu bloqueado para que el worker no pueda terminar el trabajo entre la
+	// comprobación y la cancelación, finish borra la cancelación pendiente con el mismo mutex
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	job, err := GetJob(id)
+	if err != nil {
+		return fmt.Errorf("error al obtener el trabajo: %v", err)
+	}
+	if job.Status != models.Processing {
+		return ErrNotCancellable
+	}
+
+	// El worker se encarga de limpiar y guardar el estado cancelado
+	if cancel, ok := running[id]; ok {
+		cancel()
+	} else {
+		// El worker acaba de reclamarlo y todavía no ha empezado, se cancelará nada más registrarse
+		cancelRequested[id] = true
+	}
+	return nil
+}
+
+// CancelVideo cancela todos los trabajos pendientes de un video
+func CancelVideo(videoID string) {
+	rows, err := db.DB.Query("SELECT id FROM jobs WHERE video_id = ? AND status IN (?, ?)", videoID, models.Queued, models.Processing)
+	if err != nil {
+		fmt.Printf("Error obteniendo los trabajos del video %s: %v\n", videoID, err)
+		return
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := Cancel(id); err != nil && !errors.Is(err, ErrNotCancellable) {
+			fmt.Printf("Error cancelando el trabajo %d: %v\n", id, err)
+		}
+	}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (*models.Job, error) {
+	var job models.Job
+	// Las columnas opcionales pueden ser NULL
+	var userID sql.NullInt64
+	var errMsg, startedAt, finishedAt sql.NullString
+	err := row.Scan(&job.ID, &userID, &job.VideoID, &job.Resolution, &job.Payload, &job.Status, &job.Attempts, &errMsg, &job.CreatedAt, &job.UpdatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.UserID = int(userID.Int64)
+	job.Error = errMsg.String
+	job.StartedAt = startedAt.String
+	job.FinishedAt = finishedAt.String
+	return &job, nil
+}
+
+// wake avisa a un worker sin bloquear si ya hay un aviso pendiente
+func wake() {
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+// recoverInterrupted reencola o marca como fallidos los trabajos que quedaron a medias en el último arranque
+func recoverInterrupted(maxAttempts int) {
+	// Ningún worker está en marcha todavía, así que cualquier estado "processing" es de una ejecución anterior
+	_, err := db.DB.Exec("UPDATE video_status SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE status = ?", models.Failed, models.Processing)
+	if err != nil {
+		log.Println("Error marcando como fallidos los estados interrumpidos:", err)
+	}
+
+	requeued, err := db.DB.Exec("UPDATE jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE status = ? AND attempts < ?", models.Queued, models.Processing, maxAttempts)
+	if err != nil {
+		log.Println("Error reencolando trabajos interrumpidos:", err)
+	} else if n, _ := requeued.RowsAffected(); n > 0 {
+		log.Printf("Reencolados %d trabajos interrumpidos", n)
+	}
+
+	failed, err := db.DB.Exec("UPDATE jobs SET status = ?, error = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE status = ?", models.Failed, "Trabajo interrumpido demasiadas veces", models.Processing)
+	if err != nil {
+		log.Println("Error marcando como fallidos los trabajos interrumpidos:", err)
+	} else if n, _ := failed.RowsAffected(); n > 0 {
+		log.Printf("Marcados como fallidos %d trabajos interrumpidos", n)
+	}
+}
+
+// claimNext reclama el trabajo en cola más antiguo, devuelve nil si no hay ninguno
+func claimNext() (*models.Job, error) {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+
+	row := db.DB.QueryRow(`
+	UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE id = (SELECT id FROM jobs WHERE status = ? ORDER BY id LIMIT 1)
+	RETURNING id, user_id, video_id, resolution, payload, status, attempts, error, created_at, updated_at, started_at, finished_at`, models.Processing, models.Queued)
+
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// finish guarda el estado final de un trabajo
+func finish(id int64, status string, jobErr error) {
+	var errMsg any
+	if jobErr != nil {
+		errMsg = jobErr.Error()
+	}
+	_, err := db.DB.Exec("UPDATE jobs SET status = ?, error = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?", status, errMsg, id)
+	if err != nil {
+		fmt.Printf("Error actualizando el trabajo %d: %v\n", id, err)
+	}
+
+	// Una cancelación pedida antes de que el worker registrara el trabajo ya no hace falta
+	runningMu.Lock()
+	delete(cancelRequested, id)
+	runningMu.Unlock()
+}
+
+func worker(n int) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := claimNext()
+		if err != nil {
+			fmt.Printf("Worker %d: error reclamando trabajo: %v\n", n, err)
+		}
+		if job == nil {
+			select {
+			case <-notify:
+			case <-ticker.C:
+			}
+			continue
+		}
+		run(n, job)
+	}
+}
+
+// run ejecuta un trabajo ya reclamado y guarda su resultado
+func run(n int, job *models.Job) {
+	var payload Payload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		finish(job.ID, models.Failed, fmt.Errorf("payload inválido: %v", err))
+		return
+	}
+
+	// Si el trabajo viene de un arranque anterior puede que el archivo temporal de cookies ya no exista
+	if payload.CookiesPath != "" {
+		if _, err := os.Stat(payload.CookiesPath); err != nil {
+			payload.CookiesPath = ""
+		}
+		defer os.Remove(payload.CookiesPath)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runningMu.Lock()
+	running[job.ID] = cancel
+	if cancelRequested[job.ID] {
+		delete(cancelRequested, job.ID)
+		cancel()
+	}
+	runningMu.Unlock()
+	defer func() {
+		runningMu.Lock()
+		delete(running, job.ID)
+		runningMu.Unlock()
+		cancel()
+	}()
+
+	// Los archivos parciales de la carpeta del trabajo se borran siempre al terminar
+	workDir := workDirFor(job.ID)
+	defer os.RemoveAll(workDir)
+
+	fmt.Printf("Worker %d: procesando trabajo %d (%s, %s)\n", n, job.ID, job.VideoID, job.Resolution)
+	_, err := ProcessYoutubeVideo(ctx, job, payload, workDir)
+	switch {
+	case ctx.Err() != nil:
+		fmt.Printf("Trabajo %d cancelado\n", job.ID)
+		finish(job.ID, models.Cancelled, nil)
+	case err != nil:
+		fmt.Printf("Error procesando video: %v\n", err)
+		finish(job.ID, models.Failed, err)
+	default:
+		finish(job.ID, models.Completed, nil)
+	}
+
+	_, err = db.DB.Exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ?", job.VideoID)
+	if err != nil {
+		fmt.Printf("Error actualizando el video: %v\n", err)
+	}
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+)
+
+func TestEnqueueRejectsDuplicates(t *testing.T) {
+	db.OpenTestDB(t)
+
+	// Varias peticiones simultáneas para el mismo video y resolución solo encolan un trabajo
+	var wg sync.WaitGroup
+	results := make([]error, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, results[i] = Enqueue(1, "dQw4w9WgXcQ", "720", Payload{})
+		}()
+	}
+	wg.Wait()
+
+	queued := 0
+	for _, err := range results {
+		switch {
+		case err == nil:
+			queued++
+		case !errors.Is(err, ErrAlreadyQueued):
+			t.Fatalf("error inesperado: %v", err)
+		}
+	}
+	if queued != 1 {
+		t.Fatalf("se esperaba 1 trabajo encolado, se encolaron %d", queued)
+	}
+
+	// Otra resolución sí se encola y, una vez terminado, se puede volver a encolar el mismo
+	if _, err := Enqueue(1, "dQw4w9WgXcQ", "1080", Payload{}); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	job, err := claimNext()
+	if err != nil || job == nil {
+		t.Fatalf("claimNext() = %v, %v, se esperaba un trabajo", job, err)
+	}
+	finish(job.ID, models.Completed, nil)
+	if _, err := Enqueue(1, "dQw4w9WgXcQ", "720", Payload{}); err != nil {
+		t.Errorf("se esperaba poder encolar de nuevo al terminar, se obtuvo %v", err)
+	}
+}
+
+func TestCancelClaimedJob(t *testing.T) {
+	db.OpenTestDB(t)
+
+	if _, err := Enqueue(1, "dQw4w9WgXcQ", "720", Payload{}); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	job, err := claimNext()
+	if err != nil || job == nil {
+		t.Fatalf("claimNext() = %v, %v, se esperaba un trabajo", job, err)
+	}
+
+	// Reclamado pero sin registrar todavía, la cancelación queda pendiente para el worker
+	if err := Cancel(job.ID); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	runningMu.Lock()
+	requested := cancelRequested[job.ID]
+	runningMu.Unlock()
+	if !requested {
+		t.Fatal("se esperaba una cancelación pendiente")
+	}
+
+	// Si el trabajo termina antes de que el worker lo registre no debe quedar la cancelación pendiente
+	finish(job.ID, models.Failed, errors.New("error de prueba"))
+	runningMu.Lock()
+	_, requested = cancelRequested[job.ID]
+	runningMu.Unlock()
+	if requested {
+		t.Error("no se esperaba una cancelación pendiente al terminar el trabajo")
+	}
+	if err := Cancel(job.ID); !errors.Is(err, ErrNotCancellable) {
+		t.Errorf("se esperaba ErrNotCancellable, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/sources"
+)
+
+// Cada cuánto se buscan suscripciones pendientes de comprobar, cada una se comprueba según su intervalo
+const schedulerInterval = time.Minute
+
+// Tiempo máximo para listar los videos de una suscripción
+const subscriptionTimeout = 5 * time.Minute
+
+// subscriptionLocks evita que el planificador y una comprobación manual revisen a la vez la misma suscripción,
+// cada una tiene su mutex para que un listado lento no retrase las demás
+var (
+	subscriptionLocks   = map[int64]*sync.Mutex{}
+	subscriptionLocksMu sync.Mutex
+)
+
+// Columnas de subscriptions en el orden que espera scanSubscription, con el número de videos encolados
+const subscriptionColumns = `id, user_id, kind, source_id, title, resolution, payload, interval_minutes, active, requested_by_ip,
+	last_checked_at, created_at, updated_at,
+	(SELECT COUNT(*) FROM subscription_videos WHERE subscription_videos.subscription_id = subscriptions.id AND job_id IS NOT NULL)`
+
+func scanSubscription(row scanner) (*models.Subscription, error) {
+	var subscription models.Subscription
+	var lastCheckedAt sql.NullString
+	err := row.Scan(&subscription.ID, &subscription.UserID, &subscription.Kind, &subscription.SourceID, &subscription.Title,
+		&subscription.Resolution, &subscription.Payload, &subscription.IntervalMinutes, &subscription.Active, &subscription.RequestedByIP,
+		&lastCheckedAt, &subscription.CreatedAt, &subscription.UpdatedAt, &subscription.VideoCount)
+	if err != nil {
+		return nil, err
+	}
+	if lastCheckedAt.Valid {
+		subscription.LastCheckedAt = &lastCheckedAt.String
+	}
+	return &subscription, nil
+}
+
+// StartScheduler comprueba periódicamente las suscripciones activas cuyo intervalo ha vencido
+func StartScheduler() {
+	// Las comprobaciones que quedaron a medias en el último arranque ya no van a terminar
+	_, err := db.DB.Exec("UPDATE subscription_runs SET status = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE status = ?",
+		models.Failed, "Comprobación interrumpida", models.Processing)
+	if err != nil {
+		log.Println("Error marcando como fallidas las comprobaciones interrumpidas:", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for {
+			checkDueSubscriptions()
+			<-ticker.C
+		}
+	}()
+	log.Printf("Planificador de suscripciones iniciado")
+}
+
+// checkDueSubscriptions comprueba de una en una las suscripciones pendientes, las de usuarios desactivados
+// no se comprueban
+func checkDueSubscriptions() {
+	rows, err := db.DB.Query(`SELECT id FROM subscriptions WHERE active = TRUE AND user_id IN (SELECT id FROM users WHERE active = TRUE)
+		AND (last_checked_at IS NULL OR datetime(last_checked_at, '+' || interval_minutes || ' minutes') <= CURRENT_TIMESTAMP) ORDER BY id`)
+	if err != nil {
+		fmt.Println("Error obteniendo las suscripciones pendientes:", err)
+		return
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		run, err := CheckSubscription(context.Background(), id)
+		if err != nil {
+			fmt.Printf("Error comprobando la suscripción %d: %v\n", id, err)
+		} else if run.Queued > 0 {
+			fmt.Printf("Suscripción %d: %d videos nuevos encolados\n", id, run.Queued)
+		}
+	}
+}
+
+// GetSubscription devuelve una suscripción por su ID
+func GetSubscription(id int64) (*models.Subscription, error) {
+	return scanSubscription(db.DB.QueryRow("SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = ?", id))
+}
+
+// GetSubscriptions devuelve las suscripciones de un usuario, o las de todos si userID es 0
+func GetSubscriptions(userID int) ([]models.Subscription, error) {
+	query := "SELECT " + subscriptionColumns + " FROM subscriptions"
+	var args []any
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.DB.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.Subscription{}
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// GetSubscriptionRuns devuelve las últimas comprobaciones de una suscripción, de la más reciente a la más antigua
+func GetSubscriptionRuns(id int64, limit int) ([]models.SubscriptionRun, error) {
+	rows, err := db.DB.Query(`SELECT id, subscription_id, status, found, new_videos, queued, COALESCE(error, ''), started_at, finished_at
+		FROM subscription_runs WHERE subscription_id = ? ORDER BY id DESC LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.SubscriptionRun{}
+	for rows.Next() {
+		var run models.SubscriptionRun
+		var finishedAt sql.NullString
+		if err := rows.Scan(&run.ID, &run.SubscriptionID, &run.Status, &run.Found, &run.NewVideos, &run.Queued, &run.Error, &run.StartedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.String
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// GetSubscriptionVideos devuelve los videos que ha encontrado una suscripción, del más reciente al más antiguo
+func GetSubscriptionVideos(id int64, limit int) ([]models.SubscriptionVideo, error) {
+	rows, err := db.DB.Query(`SELECT subscription_videos.video_id, COALESCE(videos.title, ''), subscription_videos.job_id, subscription_videos.created_at
+		FROM subscription_videos LEFT JOIN videos ON videos.video_id = subscription_videos.video_id
+		WHERE subscription_videos.subscription_id = ? ORDER BY subscription_videos.rowid DESC LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []models.SubscriptionVideo{}
+	for rows.Next() {
+		var video models.SubscriptionVideo
+		if err := rows.Scan(&video.VideoID, &video.Title, &video.JobID, &video.CreatedAt); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// ListSubscriptionSource lista los videos de un canal (su lista de subidas) o de una lista de reproducción
+func ListSubscriptionSource(ctx context.Context, kind string, sourceID string) (*converter.Playlist, error) {
+	playlistID := sourceID
+	if kind == models.SubscriptionChannel {
+		playlistID = pkg.GetChannelUploadsPlaylistID(sourceID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, subscriptionTimeout)
+	defer cancel()
+	return converter.Current.ListPlaylist(ctx, playlistID, "")
+}
+
+// CheckSubscription lista la fuente de la suscripción, agrega los videos que no había visto antes y encola
+// su procesamiento. El resultado, correcto o no, se guarda en el historial de la suscripción
+func CheckSubscription(ctx context.Context, id int64) (*models.SubscriptionRun, error) {
+	defer lockSubscription(id)()
+
+	subscription, err := GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	run, err := startRun(id)
+	if err != nil {
+		return nil, err
+	}
+	playlist, err := ListSubscriptionSource(ctx, subscription.Kind, subscription.SourceID)
+	if err != nil {
+		return finishRun(run, fmt.Errorf("error al listar los videos: %w", err))
+	}
+	return finishRun(run, syncSubscription(subscription, playlist, true, run))
+}
+
+// StartSubscription guarda los videos que ya tiene la fuente de una suscripción recién creada. Solo se
+// encolan si backfill es true, si no se marcan como vistos y se procesan únicamente los que se suban después
+func StartSubscription(id int64, playlist *converter.Playlist, backfill bool) (*models.SubscriptionRun, error) {
+	defer lockSubscription(id)()
+
+	subscription, err := GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	run, err := startRun(id)
+	if err != nil {
+		return nil, err
+	}
+	return finishRun(run, syncSubscription(subscription, playlist, backfill, run))
+}
+
+// lockSubscription bloquea la suscripción y devuelve la función que la desbloquea
+func lockSubscription(id int64) func() {
+	subscriptionLocksMu.Lock()
+	mu, ok := subscriptionLocks[id]
+	if !ok {
+		mu = &sync.Mutex{}
+		subscriptionLocks[id] = mu
+	}
+	subscriptionLocksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// ForgetSubscription borra el mutex de una suscripción eliminada para que no se acumulen. Una comprobación que
+// siga en curso termina con el suyo sin problema, ya no puede empezar otra de la misma suscripción
+func ForgetSubscription(id int64) {
+	subscriptionLocksMu.Lock()
+	delete(subscriptionLocks, id)
+	subscriptionLocksMu.Unlock()
+}
+
+// syncSubscription agrega los videos de la fuente que la suscripción no había visto y, si enqueue es true,
+// encola su procesamiento del más antiguo al más reciente. Los contadores se van guardando en run
+func syncSubscription(subscription *models.Subscription, playlist *converter.Playlist, enqueue bool, run *models.SubscriptionRun) error {
+	var payload Payload
+	if err := json.Unmarshal([]byte(subscription.Payload), &payload); err != nil {
+		return fmt.Errorf("opciones de procesamiento inválidas: %v", err)
+	}
+
+	// Solo se revisan los PLAYLIST_MAX_ENTRIES primeros, en los canales son los más recientes
+	entries := playlist.Entries
+	if maxEntries := config.LoadConfig().PlaylistMaxEntries; maxEntries > 0 && len(entries) > maxEntries {
+		entries = entries[:maxEntries]
+	}
+	if subscription.Kind == models.SubscriptionChannel {
+		entries = slices.Clone(entries)
+		slices.Reverse(entries)
+	}
+
+	run.Found = len(playlist.Entries)
+	for _, entry := range entries {
+		var seen int
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM subscription_videos WHERE subscription_id = ? AND video_id = ?)", subscription.ID, entry.ID).Scan(&seen); err != nil {
+			return err
+		}
+		if seen == 1 {
+			continue
+		}
+		run.NewVideos++
+
+		_, err := db.DB.Exec(`INSERT INTO videos (user_id, video_id, provider, external_id, title, requested_by_ip, duration, channel_name)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+			subscription.UserID, entry.ID, sources.ProviderYoutube, entry.ID, entry.Title, subscription.RequestedByIP, int(math.Round(entry.Duration)), entry.Channel)
+		if err != nil {
+			return fmt.Errorf("error al insertar el video %s: %v", entry.ID, err)
+		}
+
+		// Si no se puede encolar no se marca como visto y se vuelve a intentar en la siguiente comprobación
+		var jobID *int64
+		if enqueue && !IsCompleted(entry.ID, subscription.Resolution) {
+			id, err := Enqueue(subscription.UserID, entry.ID, subscription.Resolution, payload)
+			if err != nil && !errors.Is(err, ErrAlreadyQueued) {
+				return fmt.Errorf("error al encolar el video %s: %v", entry.ID, err)
+			}
+			if err == nil {
+				jobID = &id
+				run.Queued++
+			}
+		}
+		if _, err := db.DB.Exec("INSERT INTO subscription_videos (subscription_id, video_id, job_id) VALUES (?, ?, ?)", subscription.ID, entry.ID, jobID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startRun guarda en el historial el inicio de una comprobación
+func startRun(id int64) (*models.SubscriptionRun, error) {
+	run := &models.SubscriptionRun{SubscriptionID: id, Status: models.Processing}
+	err := db.DB.QueryRow("INSERT INTO subscription_runs (subscription_id, status) VALUES (?, ?) RETURNING id, started_at", id, run.Status).
+		Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error al guardar la comprobación de la suscripción: %v", err)
+	}
+	return run, nil
+}
+
+// finishRun guarda el resultado de la comprobación y la fecha de la última comprobación de la suscripción,
+// aunque haya fallado, así se vuelve a intentar en el siguiente intervalo
+func finishRun(run *models.SubscriptionRun, runErr error) (*models.SubscriptionRun, error) {
+	run.Status = models.Completed
+	var errMsg any
+	if runErr != nil {
+		run.Status = models.Failed
+		run.Error = runErr.Error()
+		errMsg = run.Error
+	}
+
+	err := db.DB.QueryRow(`UPDATE subscription_runs SET status = ?, found = ?, new_videos = ?, queued = ?, error = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ? RETURNING finished_at`, run.Status, run.Found, run.NewVideos, run.Queued, errMsg, run.ID).Scan(&run.FinishedAt)
+	if err == nil {
+		_, err = db.DB.Exec("UPDATE subscriptions SET last_checked_at = CURRENT_TIMESTAMP WHERE id = ?", run.SubscriptionID)
+	}
+	if err != nil {
+		return run, fmt.Errorf("error al guardar la comprobación de la suscripción: %v", err)
+	}
+	return run, runErr
+}
+
+// IsCompleted indica si el video ya está procesado con la variante indicada
+func IsCompleted(videoID string, resolution string) bool {
+	var completed int
+	_ = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM video_status WHERE video_id = ? AND resolution = ? AND status = ?)",
+		videoID, resolution, models.Completed).Scan(&completed)
+	return completed == 1
+}
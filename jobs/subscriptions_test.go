@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockSubscription(t *testing.T) {
+	unlock := lockSubscription(1)
+
+	// Otra suscripción no espera a que termine la primera
+	done := make(chan struct{})
+	go func() {
+		lockSubscription(2)()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("se esperaba poder bloquear la suscripción 2 mientras la 1 está bloqueada")
+	}
+
+	// La misma suscripción espera hasta que se desbloquea
+	locked := make(chan struct{})
+	go func() {
+		lockSubscription(1)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("no se esperaba poder bloquear la suscripción 1 dos veces")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("se esperaba poder bloquear la suscripción 1 tras desbloquearla")
+	}
+}
+
+func TestForgetSubscription(t *testing.T) {
+	lockSubscription(3)()
+	ForgetSubscription(3)
+
+	subscriptionLocksMu.Lock()
+	defer subscriptionLocksMu.Unlock()
+	if _, ok := subscriptionLocks[3]; ok {
+		t.Error("se esperaba borrado el mutex de la suscripción eliminada")
+	}
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/subtitles"
+)
+
+// fetchSubtitles descarga las pistas de subtítulos pedidas, las convierte al formato indicado (recortadas
+// al fragmento si se indica) y las escribe en dir como <id>.<formato>. Devuelve los archivos en el orden
+// pedido y las pistas correspondientes
+func fetchSubtitles(ctx context.Context, videoID string, cookiesPath string, ids []string, format string, clip *converter.Clip, dir string) ([]models.File, []converter.Subtitle, error) {
+	info, err := converter.Current.Probe(ctx, VideoSource(videoID).Ref(), cookiesPath)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error al obtener los subtítulos del video: %v", err)
+	}
+	selected, err := converter.SelectSubtitles(info.Subtitles, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("error al crear la carpeta de los subtítulos: %v", err)
+	}
+
+	files := make([]models.File, 0, len(selected))
+	for i, subtitle := range selected {
+		data, err := converter.Current.FetchSubtitle(ctx, subtitle, cookiesPath)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		cues, err := subtitles.ParseVTT(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error al leer los subtítulos %s: %v", subtitle.ID, err)
+		}
+		if clip != nil {
+			cues = subtitles.Shift(cues, seconds(clip.Start), seconds(clip.End))
+		}
+		content, err := subtitles.Convert(cues, format)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		path := filepath.Join(dir, subtitle.ID+"."+format)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return nil, nil, fmt.Errorf("error al guardar los subtítulos %s: %v", subtitle.ID, err)
+		}
+		title := subtitle.Name
+		if title == "" {
+			title = subtitle.ID
+		}
+		files = append(files, models.File{Position: i + 1, Title: title, Path: path})
+	}
+	return files, selected, nil
+}
+
+// seconds convierte segundos en time.Duration
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/tags"
+	"yt-converter-api/pkg/thumbnails"
+)
+
+// audioTags devuelve las etiquetas del audio a partir de los metadatos guardados del video con los cambios
+// pedidos en overrides, y la miniatura guardada del video en tamaño medio como carátula (nil si no se pudo
+// obtener)
+func audioTags(ctx context.Context, videoID string, overrides *tags.Tags) (tags.Tags, []byte) {
+	video := models.Video{VideoID: videoID}
+	_ = db.DB.QueryRow(`SELECT title, COALESCE(channel_name, ''), COALESCE(upload_date, ''), COALESCE(thumbnail_url, ''), provider, COALESCE(external_id, video_id)
+		FROM videos WHERE video_id = ?`, videoID).
+		Scan(&video.Title, &video.ChannelName, &video.UploadDate, &video.ThumbnailURL, &video.Provider, &video.ExternalID)
+
+	audio := tags.FromVideo(video)
+	if overrides != nil {
+		audio = audio.Merge(*overrides)
+	}
+
+	cover, err := thumbnailCover(ctx, videoID, video.ThumbnailURL)
+	if err != nil {
+		fmt.Printf("No se pudo obtener la carátula de %s: %v\n", videoID, err)
+	}
+	return audio, cover
+}
+
+// thumbnailCover lee la miniatura del video en tamaño medio, suficiente para una carátula y por debajo del
+// límite de las carátulas de Opus
+func thumbnailCover(ctx context.Context, videoID string, thumbnailURL string) ([]byte, error) {
+	path, err := EnsureThumbnail(ctx, videoID, thumbnailURL)
+	if err != nil {
+		return nil, err
+	}
+	if path, err = thumbnails.Path(filepath.Dir(path), thumbnails.KindThumbnail, thumbnails.SizeMedium); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/sources"
+	"yt-converter-api/pkg/thumbnails"
+)
+
+// Tiempo máximo para descargar la miniatura de un video
+const thumbnailTimeout = 15 * time.Second
+
+// EnsureThumbnail devuelve la miniatura del video guardada en StoragePath, descargándola si todavía no se
+// ha guardado. Si thumbnailURL está vacía se usa la de los metadatos guardados del video
+func EnsureThumbnail(ctx context.Context, videoID string, thumbnailURL string) (string, error) {
+	if thumbnailURL == "" {
+		_ = db.DB.QueryRow("SELECT COALESCE(thumbnail_url, '') FROM videos WHERE video_id = ?", videoID).Scan(&thumbnailURL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+	youtubeID := ""
+	if source := VideoSource(videoID); source.Provider == sources.ProviderYoutube {
+		youtubeID = source.ExternalID
+	}
+	return thumbnails.Ensure(ctx, http.DefaultClient, config.LoadConfig().StoragePath, videoID, thumbnails.Candidates(youtubeID, thumbnailURL))
+}
+
+// generatePreviews genera la hoja de contactos y la vista previa animada a partir del video procesado, si
+// falla solo se registra el error porque el video ya está convertido
+func generatePreviews(ctx context.Context, videoID string, path string, clip *converter.Clip) {
+	cfg := config.LoadConfig()
+	duration := outputDuration(videoID, clip).Seconds()
+	if err := thumbnails.Generate(ctx, cfg.FFmpegPath, path, duration, thumbnails.Dir(cfg.StoragePath, videoID)); err != nil {
+		fmt.Printf("No se pudo generar la vista previa de %s: %v\n", videoID, err)
+	}
+}
@@ -1,28 +1,36 @@
 package middleware
 
 import (
-	"yt-converter-api/pkg"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/apikeys"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 func IsAdmin(c *fiber.Ctx) error {
-	jwt := c.Locals("jwt").(*jwt.Token)
+	token := c.Locals("jwt").(*jwt.Token)
 
-	// Obtener el usuario del token
-	_, role, err := pkg.GetUserFromToken(jwt.Raw)
-	if err != nil {
+	// Obtener el usuario del token, ya comprobado por JWTProtected
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "No tienes permisos para acceder a esta ruta",
 		})
 	}
 
-	if role != "admin" {
+	if role, _ := claims["role"].(string); role != "admin" {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Solo los administradores pueden acceder a esta ruta",
 		})
 	}
 
+	// Con una API key también hace falta el permiso admin
+	if apiKey, ok := c.Locals("api_key").(models.APIKey); ok && !apikeys.HasScope(apiKey, apikeys.ScopeAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "La API key no tiene el permiso " + apikeys.ScopeAdmin,
+		})
+	}
+
 	return c.Next()
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/apikeys"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APIKeyHeader es la cabecera con la que se envían las API keys
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyProtected comprueba la API key y su permiso para el método de la petición: videos:read en las
+// peticiones GET y videos:process en el resto. Las rutas de administrador además requieren admin (IsAdmin).
+// El resto de la aplicación lee el usuario de c.Locals("jwt"), así que se guarda un token con los mismos
+// claims que uno de sesión
+func apiKeyProtected(c *fiber.Ctx, key string) error {
+	apiKey, role, err := apikeys.Authenticate(key)
+	if err != nil {
+		if errors.Is(err, apikeys.ErrInvalidKey) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "La API key no es válida o ha caducado",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al comprobar la API key",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	scope := apikeys.ScopeVideosProcess
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		scope = apikeys.ScopeVideosRead
+	}
+	if !apikeys.HasScope(apiKey, scope) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "La API key no tiene el permiso " + scope,
+		})
+	}
+
+	c.Locals("jwt", &jwt.Token{
+		Valid: true,
+		Claims: jwt.MapClaims{
+			"user_id":    strconv.Itoa(apiKey.UserID),
+			"role":       role,
+			"api_key_id": apiKey.ID,
+		},
+	})
+	c.Locals("api_key", apiKey)
+	return c.Next()
+}
+
+// NoAPIKey rechaza las peticiones autenticadas con una API key, para que con ellas no se puedan gestionar
+// las sesiones ni crear otras claves
+func NoAPIKey(c *fiber.Ctx) error {
+	if _, ok := c.Locals("api_key").(models.APIKey); ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Esta ruta requiere iniciar sesión, no se puede usar con una API key",
+		})
+	}
+	return c.Next()
+}
@@ -2,18 +2,35 @@ package middleware
 
 import (
 	"errors"
+	"fmt"
 
 	"yt-converter-api/config"
+	"yt-converter-api/pkg/sessions"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// JWTProtected comprueba el token JWT de la cabecera Authorization o, si se envía la cabecera X-API-Key,
+// la API key
 func JWTProtected() fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(config.LoadConfig().JwtSecret)},
-		ContextKey: "jwt",
+	return jwtProtected("header:Authorization")
+}
+
+// JWTProtectedWithQuery acepta además el token en ?access_token=, solo para las rutas de Server-Sent Events
+// porque EventSource no permite cabeceras. En el resto no se acepta para que los tokens no acaben en los
+// logs de los proxies ni en el historial del navegador
+func JWTProtectedWithQuery() fiber.Handler {
+	return jwtProtected("header:Authorization,query:access_token")
+}
+
+func jwtProtected(tokenLookup string) fiber.Handler {
+	jwtHandler := jwtware.New(jwtware.Config{
+		SigningKey:  jwtware.SigningKey{Key: []byte(config.LoadConfig().JwtSecret)},
+		ContextKey:  "jwt",
+		TokenLookup: tokenLookup,
+		AuthScheme:  "Bearer",
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			// Comprobar si el error es por token expirado
 			if errors.Is(err, jwt.ErrTokenExpired) {
@@ -25,5 +42,43 @@ func JWTProtected() fiber.Handler {
 				"error": "No estás autorizado para acceder a este recurso",
 			})
 		},
+		// Los tokens de las sesiones cerradas o refrescadas siguen siendo válidos hasta que caducan, se
+		// rechazan por su jti
+		SuccessHandler: func(c *fiber.Ctx) error {
+			token := c.Locals("jwt").(*jwt.Token)
+			claims, _ := token.Claims.(jwt.MapClaims)
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Tu sesión ha expirado, por favor inicia sesión nuevamente",
+				})
+			}
+			revoked, err := sessions.IsRevoked(jti)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":      "Error al comprobar si la sesión sigue activa",
+					"errorTrace": err.Error(),
+				})
+			}
+			if revoked {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "La sesión se ha cerrado, por favor inicia sesión nuevamente",
+				})
+			}
+			// Si falla solo se registra, el token es válido
+			if sid, ok := claims["sid"].(float64); ok {
+				if err := sessions.Touch(int64(sid)); err != nil {
+					fmt.Printf("Error actualizando el último uso de la sesión %d: %v\n", int64(sid), err)
+				}
+			}
+			return c.Next()
+		},
 	})
+
+	return func(c *fiber.Ctx) error {
+		if key := c.Get(APIKeyHeader); key != "" {
+			return apiKeyProtected(c, key)
+		}
+		return jwtHandler(c)
+	}
 }
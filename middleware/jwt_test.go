@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/pkg/apikeys"
+	"yt-converter-api/pkg/sessions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestApp prepara la base de datos con el administrador 1 y el invitado 2 y una aplicación con una ruta
+// protegida normal, una de Server-Sent Events y una de administrador
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	config.SetTestEnv(t, map[string]string{"JWT_SECRET": "secreto de prueba"})
+	db.OpenTestDB(t)
+	sessions.Init(config.LoadConfig())
+
+	_, err := db.DB.Exec("INSERT INTO users (username, password, role) VALUES ('admin', 'x', 'admin'), ('guest', 'x', 'guest')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app := fiber.New()
+	app.Get("/videos", JWTProtected(), ValidUserAndActive, ok)
+	app.Post("/videos", JWTProtected(), ValidUserAndActive, ok)
+	app.Get("/events", JWTProtectedWithQuery(), ValidUserAndActive, ok)
+	app.Get("/admin", JWTProtected(), ValidUserAndActive, IsAdmin, ok)
+	return app
+}
+
+// login inicia una sesión del usuario y devuelve su token de acceso
+func login(t *testing.T, userID string, role string) string {
+	t.Helper()
+	tokens, err := sessions.Create(userID, role, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	return tokens.Token
+}
+
+// status hace la petición con las cabeceras indicadas y devuelve el código de la respuesta
+func status(t *testing.T, app *fiber.App, method string, target string, headers map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestJWTProtectedTokenLookup(t *testing.T) {
+	app := newTestApp(t)
+	token := login(t, "2", "guest")
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+
+	tests := []struct {
+		target  string
+		headers map[string]string
+		want    int
+	}{
+		{"/videos", bearer, http.StatusOK},
+		{"/videos", nil, http.StatusUnauthorized},
+		// El token en la URL solo se acepta en la ruta de eventos
+		{"/videos?access_token=" + token, nil, http.StatusUnauthorized},
+		{"/events?access_token=" + token, nil, http.StatusOK},
+		{"/events", bearer, http.StatusOK},
+		{"/events?access_token=invalido", nil, http.StatusUnauthorized},
+		{"/admin", bearer, http.StatusForbidden},
+		{"/admin", map[string]string{"Authorization": "Bearer " + login(t, "1", "admin")}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := status(t, app, http.MethodGet, tt.target, tt.headers); got != tt.want {
+			t.Errorf("GET %s = %d, se esperaba %d", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestJWTProtectedRevokedAndInactive(t *testing.T) {
+	app := newTestApp(t)
+
+	// Es la primera sesión que se crea, la 1
+	revoked := map[string]string{"Authorization": "Bearer " + login(t, "2", "guest")}
+	if err := sessions.Revoke(1); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if got := status(t, app, http.MethodGet, "/videos", revoked); got != http.StatusUnauthorized {
+		t.Errorf("se esperaba 401 con la sesión cerrada, se obtuvo %d", got)
+	}
+
+	inactive := map[string]string{"Authorization": "Bearer " + login(t, "2", "guest")}
+	db.DB.Exec("UPDATE users SET active = 0 WHERE id = 2")
+	if got := status(t, app, http.MethodGet, "/videos", inactive); got != http.StatusBadRequest {
+		t.Errorf("se esperaba 400 con el usuario desactivado, se obtuvo %d", got)
+	}
+}
+
+func TestJWTProtectedAPIKey(t *testing.T) {
+	app := newTestApp(t)
+
+	_, read, err := apikeys.Create(2, "lectura", []string{apikeys.ScopeVideosRead}, 0)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	headers := map[string]string{APIKeyHeader: read}
+	if got := status(t, app, http.MethodGet, "/videos", headers); got != http.StatusOK {
+		t.Errorf("GET con videos:read = %d, se esperaba 200", got)
+	}
+	if got := status(t, app, http.MethodPost, "/videos", headers); got != http.StatusForbidden {
+		t.Errorf("POST con videos:read = %d, se esperaba 403", got)
+	}
+	if got := status(t, app, http.MethodGet, "/videos", map[string]string{APIKeyHeader: apikeys.KeyPrefix + "invalida"}); got != http.StatusUnauthorized {
+		t.Errorf("GET con una clave inválida = %d, se esperaba 401", got)
+	}
+}
@@ -3,7 +3,6 @@ package middleware
 import (
 	"net/http"
 	"yt-converter-api/db"
-	"yt-converter-api/pkg"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -11,18 +10,19 @@ import (
 
 // Middleware para comprobar que el usuario existe (puede que un administrador haya borrado el usuario) y que además esté activo
 func ValidUserAndActive(c *fiber.Ctx) error {
-	jwt := c.Locals("jwt").(*jwt.Token)
+	token := c.Locals("jwt").(*jwt.Token)
 
-	// Obtener el usuario del token
-	userID, _, err := pkg.GetUserFromToken(jwt.Raw)
-	if err != nil {
+	// Obtener el usuario del token, ya comprobado por JWTProtected
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "No tienes permisos para acceder a esta ruta",
 		})
 	}
+	userID, _ := claims["user_id"].(string)
 
 	userExists := false
-	err = db.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND active = 1", userID).Scan(&userExists)
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND active = 1", userID).Scan(&userExists)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al comprobar si el usuario existe",
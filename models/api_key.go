@@ -0,0 +1,13 @@
+package models
+
+// APIKey es una clave de un usuario para usar la API desde scripts e integraciones sin iniciar sesión
+type APIKey struct {
+	ID         int64    `json:"id"`
+	UserID     int      `json:"user_id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"` // Comienzo de la clave para reconocerla, la clave solo se muestra al crearla
+	Scopes     []string `json:"scopes"` // videos:read, videos:process o admin
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	ExpiresAt  *string  `json:"expires_at"` // Nunca caduca si es null
+}
@@ -0,0 +1,21 @@
+package models
+
+type Job struct {
+	ID         int64  `json:"id"`
+	UserID     int    `json:"user_id"`
+	VideoID    string `json:"video_id"`
+	Resolution string `json:"resolution"`
+	Payload    string `json:"payload"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+}
+
+// Estado adicional de los trabajos, el resto se comparte con VideoStatus
+const (
+	Queued = "queued"
+)
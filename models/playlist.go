@@ -0,0 +1,48 @@
+package models
+
+type Playlist struct {
+	ID            int             `json:"id"`
+	UserID        int             `json:"user_id"`
+	PlaylistID    string          `json:"playlist_id"`
+	Title         string          `json:"title"`
+	ChannelName   string          `json:"channel_name"`
+	RequestedByIP string          `json:"requested_by_ip"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+	VideoCount    int             `json:"video_count"`
+	Videos        []PlaylistVideo `json:"videos,omitempty"` // Solo al obtener una lista concreta
+}
+
+// PlaylistVideo es un video de una lista en su posición
+type PlaylistVideo struct {
+	Position int    `json:"position"`
+	VideoID  string `json:"video_id"`
+	Title    string `json:"title"`
+	Duration int    `json:"duration"` // Segundos
+}
+
+// PlaylistStatus es el estado de una variante en todos los videos de una lista
+type PlaylistStatus struct {
+	PlaylistID string                `json:"playlist_id"`
+	Resolution string                `json:"resolution"`
+	Total      int                   `json:"total"`
+	Counts     map[string]int        `json:"counts"`  // Videos en cada estado
+	Percent    float64               `json:"percent"` // Avance de toda la lista, los videos completados cuentan como 100
+	Finished   bool                  `json:"finished"`
+	Videos     []PlaylistVideoStatus `json:"videos"`
+}
+
+// PlaylistVideoStatus es el estado de la variante en uno de los videos de la lista
+type PlaylistVideoStatus struct {
+	Position int       `json:"position"`
+	VideoID  string    `json:"video_id"`
+	Title    string    `json:"title"`
+	Status   string    `json:"status"`
+	Progress *Progress `json:"progress,omitempty"`
+	Error    string    `json:"error,omitempty"` // Error del último trabajo si ha fallado
+}
+
+// Estado de los videos de una lista en los que todavía no se ha pedido la variante
+const (
+	NotRequested = "not_requested"
+)
@@ -0,0 +1,13 @@
+package models
+
+// Session es una sesión iniciada con POST /api/auth/login
+type Session struct {
+	ID         int64  `json:"id"`
+	UserID     int    `json:"user_id"`
+	IP         string `json:"ip"`         // IP desde la que se inició o se refrescó por última vez
+	UserAgent  string `json:"user_agent"` // User-Agent de la última petición de inicio o refresco
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"` // Última petición o refresco, se guarda como mucho una vez por minuto
+	ExpiresAt  string `json:"expires_at"`   // Caduca si no se refresca antes
+	Current    bool   `json:"current"`      // Sesión del token con el que se ha hecho la petición
+}
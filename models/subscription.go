@@ -0,0 +1,45 @@
+package models
+
+type Subscription struct {
+	ID              int64   `json:"id"`
+	UserID          int     `json:"user_id"`
+	Kind            string  `json:"kind"`      // channel o playlist
+	SourceID        string  `json:"source_id"` // ID del canal (UC...) o de la lista de reproducción
+	Title           string  `json:"title"`
+	Resolution      string  `json:"resolution"` // Variante con la que se procesan los videos nuevos
+	Payload         string  `json:"payload"`    // Opciones de procesamiento de los trabajos que se encolan
+	IntervalMinutes int     `json:"interval_minutes"`
+	Active          bool    `json:"active"`
+	RequestedByIP   string  `json:"requested_by_ip"`
+	LastCheckedAt   *string `json:"last_checked_at"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+	VideoCount      int     `json:"video_count"` // Videos encolados por la suscripción
+}
+
+// SubscriptionRun es una comprobación de una suscripción
+type SubscriptionRun struct {
+	ID             int64   `json:"id"`
+	SubscriptionID int64   `json:"subscription_id"`
+	Status         string  `json:"status"`     // completed o failed
+	Found          int     `json:"found"`      // Videos que tenía la fuente
+	NewVideos      int     `json:"new_videos"` // Videos que no se habían visto en comprobaciones anteriores
+	Queued         int     `json:"queued"`     // Trabajos encolados
+	Error          string  `json:"error,omitempty"`
+	StartedAt      string  `json:"started_at"`
+	FinishedAt     *string `json:"finished_at"`
+}
+
+// SubscriptionVideo es un video que ha encontrado una suscripción
+type SubscriptionVideo struct {
+	VideoID   string `json:"video_id"`
+	Title     string `json:"title"`
+	JobID     *int64 `json:"job_id"` // nil si ya existía al crear la suscripción o ya estaba procesado
+	CreatedAt string `json:"created_at"`
+}
+
+// Tipos de fuentes de las suscripciones
+const (
+	SubscriptionChannel  = "channel"
+	SubscriptionPlaylist = "playlist"
+)
@@ -4,8 +4,24 @@ type Video struct {
 	ID            int    `json:"id"`
 	UserID        int    `json:"user_id"`
 	VideoID       string `json:"video_id"`
+	Provider      string `json:"provider"`    // Sitio de origen: youtube, vimeo, soundcloud o generic
+	ExternalID    string `json:"external_id"` // ID del video en su sitio, la URL en el proveedor genérico
 	Title         string `json:"title"`
 	RequestedByIP string `json:"requested_by_ip"`
 	CreatedAt     string `json:"created_at"`
 	UpdatedAt     string `json:"updated_at"`
+
+	// Metadatos obtenidos al agregar el video o al refrescarlos
+	Duration          int     `json:"duration"` // Segundos
+	ChannelName       string  `json:"channel_name"`
+	ChannelID         string  `json:"channel_id"`
+	UploadDate        string  `json:"upload_date"` // YYYY-MM-DD
+	Description       string  `json:"description"`
+	ViewCount         *int64  `json:"view_count"`
+	ThumbnailURL      string  `json:"thumbnail_url"`
+	IsLive            bool    `json:"is_live"`
+	IsShort           bool    `json:"is_short"`
+	AgeRestricted     bool    `json:"age_restricted"`
+	MetadataProvider  string  `json:"metadata_provider"`
+	MetadataUpdatedAt *string `json:"metadata_updated_at"`
 }
@@ -1,17 +1,55 @@
 package models
 
 type VideoStatus struct {
-	ID         int    `json:"id"`
-	VideoID    string `json:"video_id"`
-	Resolution string `json:"resolution"`
-	Path       string `json:"path"`
-	Status     string `json:"status"`
-	CreatedAt  string `json:"created_at"`
-	UpdatedAt  string `json:"updated_at"`
+	ID         int       `json:"id"`
+	VideoID    string    `json:"video_id"`
+	Resolution string    `json:"resolution"`
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	Format     string    `json:"format"`  // Formato del archivo generado: mp4, mp3, opus, flac...
+	Profile    string    `json:"profile"` // Perfil de transcodificación aplicado, vacío si no se recodificó
+	Progress   *Progress `json:"progress,omitempty"`
+	Files      []File    `json:"files,omitempty"`    // Archivos de las variantes con varias pistas, por ejemplo por capítulos
+	Loudness   *Loudness `json:"loudness,omitempty"` // Medidas de la normalización del audio, si se normalizó
+	CreatedAt  string    `json:"created_at"`
+	UpdatedAt  string    `json:"updated_at"`
+}
+
+// File es uno de los archivos de una variante con varias pistas
+type File struct {
+	Position int     `json:"position"`
+	Title    string  `json:"title"`
+	Path     string  `json:"path"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+}
+
+// Loudness son las medidas EBU R128 del audio antes y después de normalizarlo con loudnorm
+type Loudness struct {
+	Target            float64 `json:"target"`             // Sonoridad integrada objetivo, LUFS
+	InputI            float64 `json:"input_i"`            // Sonoridad integrada del original, LUFS
+	InputTP           float64 `json:"input_tp"`           // Pico verdadero del original, dBTP
+	InputLRA          float64 `json:"input_lra"`          // Rango de sonoridad del original, LU
+	InputThresh       float64 `json:"input_thresh"`       // Umbral de la medida, LUFS
+	OutputI           float64 `json:"output_i"`           // Sonoridad integrada del resultado, LUFS
+	OutputTP          float64 `json:"output_tp"`          // Pico verdadero del resultado, dBTP
+	OutputLRA         float64 `json:"output_lra"`         // Rango de sonoridad del resultado, LU
+	NormalizationType string  `json:"normalization_type"` // linear si bastó con cambiar el volumen, dynamic si se comprimió
+}
+
+// Progress es el último avance conocido de una conversión
+type Progress struct {
+	Phase           string   `json:"phase"` // download, merge, transcode, normalize o split
+	Percent         *float64 `json:"percent"`
+	DownloadedBytes *int64   `json:"downloaded_bytes"`
+	TotalBytes      *int64   `json:"total_bytes"`
+	Speed           *float64 `json:"speed"` // bytes por segundo
+	ETA             *int64   `json:"eta"`   // segundos
 }
 
 const (
 	Processing = "processing"
 	Completed  = "completed"
 	Failed     = "failed"
+	Cancelled  = "cancelled"
 )
@@ -0,0 +1,176 @@
+// Package apikeys gestiona las API keys de los usuarios, que permiten usar la API desde scripts e
+// integraciones con la cabecera X-API-Key en lugar de un token JWT.
+//
+// De cada clave solo se guarda el hash SHA-256 y el prefijo, para que el usuario la pueda reconocer. Los
+// permisos (scopes) limitan lo que se puede hacer con ella, además del rol del usuario.
+package apikeys
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg"
+)
+
+// Permisos que se pueden dar a una clave
+const (
+	ScopeVideosRead    = "videos:read"    // Peticiones GET
+	ScopeVideosProcess = "videos:process" // Agregar, procesar y borrar
+	ScopeAdmin         = "admin"          // Rutas de administrador, incluye los anteriores
+)
+
+// Scopes son todos los permisos válidos
+var Scopes = []string{ScopeVideosRead, ScopeVideosProcess, ScopeAdmin}
+
+// KeyPrefix es el comienzo de todas las claves, permite reconocerlas por ejemplo en un escáner de secretos
+const KeyPrefix = "ytk_"
+
+// Caracteres de la clave que se guardan y se muestran además de KeyPrefix
+const visiblePrefixLength = 8
+
+var (
+	// ErrInvalidKey se devuelve cuando la clave no existe, ha caducado o su usuario está desactivado
+	ErrInvalidKey = errors.New("la API key no es válida o ha caducado")
+	// ErrNotFound se devuelve al borrar una clave que no existe o es de otro usuario
+	ErrNotFound = errors.New("la API key no existe")
+)
+
+// ParseScopes comprueba los permisos indicados y los devuelve sin repetir en el orden de Scopes
+func ParseScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("se debe indicar al menos un permiso (%s)", strings.Join(Scopes, ", "))
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, strings.TrimSpace(scope)) {
+			return nil, fmt.Errorf("permiso desconocido: %s (válidos: %s)", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	var parsed []string
+	for _, scope := range Scopes {
+		if slices.ContainsFunc(scopes, func(s string) bool { return strings.TrimSpace(s) == scope }) {
+			parsed = append(parsed, scope)
+		}
+	}
+	return parsed, nil
+}
+
+// HasScope indica si la clave tiene el permiso, admin los incluye todos
+func HasScope(key models.APIKey, scope string) bool {
+	return slices.Contains(key.Scopes, scope) || slices.Contains(key.Scopes, ScopeAdmin)
+}
+
+// Create crea una clave del usuario que caduca en expiresInDays días (0 para que no caduque) y devuelve la
+// clave, que no se vuelve a poder consultar
+func Create(userID int, name string, scopes []string, expiresInDays int) (models.APIKey, string, error) {
+	random, err := pkg.RandomToken(32)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	key := KeyPrefix + random
+	prefix := key[:len(KeyPrefix)+visiblePrefixLength]
+
+	var expiresAt any
+	if expiresInDays > 0 {
+		expiresAt = fmt.Sprintf("+%d days", expiresInDays)
+	}
+	result, err := db.DB.Exec(`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?, datetime('now', ?))`,
+		userID, name, prefix, pkg.HashToken(key), strings.Join(scopes, ","), expiresAt)
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("error guardando la API key: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	created, err := get(id)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	return created, key, nil
+}
+
+// Columnas de api_keys en el orden que espera scanKey
+const keyColumns = "id, user_id, name, prefix, scopes, created_at, last_used_at, expires_at"
+
+// scanKey lee una fila seleccionada con keyColumns
+func scanKey(row interface{ Scan(...any) error }) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	return key, nil
+}
+
+// get obtiene una clave por su ID
+func get(id int64) (models.APIKey, error) {
+	return scanKey(db.DB.QueryRow("SELECT "+keyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+// List obtiene las claves del usuario, también las caducadas, de la más reciente a la más antigua
+func List(userID int) ([]models.APIKey, error) {
+	rows, err := db.DB.Query("SELECT "+keyColumns+" FROM api_keys WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Delete borra una clave del usuario, deja de valer inmediatamente
+func Delete(userID int, id int64) error {
+	result, err := db.DB.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate busca la clave y devuelve sus datos y el rol actual de su usuario, que debe estar activo
+func Authenticate(key string) (models.APIKey, string, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return models.APIKey{}, "", ErrInvalidKey
+	}
+
+	var id int64
+	var role string
+	err := db.DB.QueryRow(`SELECT k.id, u.role FROM api_keys k JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND u.active = 1 AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP)`, pkg.HashToken(key)).
+		Scan(&id, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, "", ErrInvalidKey
+	}
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	// Si falla solo se registra, la clave es válida
+	if _, err := db.DB.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		fmt.Printf("Error actualizando el último uso de la API key %d: %v\n", id, err)
+	}
+	found, err := get(id)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	return found, role, nil
+}
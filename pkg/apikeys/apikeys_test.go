@@ -0,0 +1,142 @@
+package apikeys
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+)
+
+// createUsers crea el administrador 1 y el invitado 2
+func createUsers(t *testing.T) {
+	t.Helper()
+	_, err := db.DB.Exec("INSERT INTO users (username, password, role) VALUES ('admin', 'x', 'admin'), ('guest', 'x', 'guest')")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		want   []string
+	}{
+		{[]string{"videos:read"}, []string{"videos:read"}},
+		{[]string{"admin", " videos:read", "videos:read"}, []string{"videos:read", "admin"}},
+		{[]string{"videos:process", "videos:read"}, []string{"videos:read", "videos:process"}},
+		{[]string{"videos:write"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseScopes(tt.scopes)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseScopes(%q): se esperaba un error", tt.scopes)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseScopes(%q) = %q, %v, se esperaba %q", tt.scopes, got, err, tt.want)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	read := models.APIKey{Scopes: []string{ScopeVideosRead}}
+	if !HasScope(read, ScopeVideosRead) || HasScope(read, ScopeVideosProcess) || HasScope(read, ScopeAdmin) {
+		t.Error("se esperaba solo el permiso videos:read")
+	}
+	admin := models.APIKey{Scopes: []string{ScopeAdmin}}
+	if !HasScope(admin, ScopeVideosRead) || !HasScope(admin, ScopeVideosProcess) {
+		t.Error("se esperaba que admin incluyera el resto de permisos")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	db.OpenTestDB(t)
+	createUsers(t)
+
+	created, key, err := Create(2, "script", []string{ScopeVideosRead, ScopeVideosProcess}, 0)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if !strings.HasPrefix(key, created.Prefix) || len(created.Prefix) != len(KeyPrefix)+visiblePrefixLength {
+		t.Errorf("prefijo %q de la clave %q inesperado", created.Prefix, key)
+	}
+	if created.ExpiresAt != nil {
+		t.Errorf("no se esperaba caducidad, se obtuvo %s", *created.ExpiresAt)
+	}
+	var stored string
+	db.DB.QueryRow("SELECT key_hash FROM api_keys WHERE id = ?", created.ID).Scan(&stored)
+	if strings.Contains(stored, key) {
+		t.Error("no se esperaba la clave guardada en claro")
+	}
+
+	found, role, err := Authenticate(key)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if found.ID != created.ID || found.UserID != 2 || role != "guest" || found.LastUsedAt == nil {
+		t.Errorf("Authenticate = %+v, %s", found, role)
+	}
+	if !reflect.DeepEqual(found.Scopes, []string{ScopeVideosRead, ScopeVideosProcess}) {
+		t.Errorf("permisos %q inesperados", found.Scopes)
+	}
+
+	for _, invalid := range []string{"", key + "x", strings.TrimPrefix(key, KeyPrefix)} {
+		if _, _, err := Authenticate(invalid); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q): se esperaba ErrInvalidKey, se obtuvo %v", invalid, err)
+		}
+	}
+
+	// Las claves de los usuarios desactivados no valen
+	db.DB.Exec("UPDATE users SET active = 0 WHERE id = 2")
+	if _, _, err := Authenticate(key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("se esperaba ErrInvalidKey con el usuario desactivado, se obtuvo %v", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	db.OpenTestDB(t)
+	createUsers(t)
+
+	created, key, err := Create(1, "temporal", []string{ScopeAdmin}, 7)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if created.ExpiresAt == nil {
+		t.Fatal("se esperaba una fecha de caducidad")
+	}
+	if _, _, err := Authenticate(key); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	db.DB.Exec("UPDATE api_keys SET expires_at = datetime('now', '-1 seconds')")
+	if _, _, err := Authenticate(key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("se esperaba ErrInvalidKey con la clave caducada, se obtuvo %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db.OpenTestDB(t)
+	createUsers(t)
+
+	created, key, err := Create(2, "script", []string{ScopeVideosRead}, 0)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	// Solo la puede borrar su usuario
+	if err := Delete(1, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("se esperaba ErrNotFound, se obtuvo %v", err)
+	}
+	if err := Delete(2, created.ID); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if _, _, err := Authenticate(key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("se esperaba ErrInvalidKey con la clave borrada, se obtuvo %v", err)
+	}
+	if keys, err := List(2); err != nil || len(keys) != 0 {
+		t.Errorf("List(2) = %d claves, %v, no se esperaba ninguna", len(keys), err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package cache guarda en SQLite los formatos y metadatos de los videos para no lanzar una extracción de
+// yt-dlp (o una llamada a la API) cada vez que se consultan.
+//
+// Las entradas se identifican por tipo, ID del video y perfil de cookies, ya que los formatos disponibles
+// cambian según la sesión con la que se consulten, y caducan tras el TTL configurado en CACHE_TTL_MINUTES.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	"yt-converter-api/db"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/metadata"
+)
+
+// Tipos de entrada de la caché
+const (
+	KindFormats  = "formats"
+	KindMetadata = "metadata"
+)
+
+// DefaultProfile es el perfil de las consultas sin archivo cookies propio, que usan el cookies.txt global
+const DefaultProfile = "default"
+
+// CookieProfile devuelve el perfil de cookies de una consulta: el perfil por defecto si no hay archivo o
+// un hash de su contenido, así dos subidas del mismo archivo comparten las entradas. Devuelve una cadena
+// vacía si el archivo no se puede leer, en ese caso no se usa la caché
+func CookieProfile(cookiesPath string) string {
+	if cookiesPath == "" {
+		return DefaultProfile
+	}
+	content, err := os.ReadFile(cookiesPath)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return "cookies-" + hex.EncodeToString(sum[:8])
+}
+
+// Converter envuelve un backend de conversión y guarda en caché el resultado de ListFormats, el resto de
+// métodos se delegan sin cambios
+type Converter struct {
+	converter.Converter
+	TTL time.Duration
+}
+
+// NewConverter crea la caché de formatos sobre el backend indicado
+func NewConverter(backend converter.Converter, ttl time.Duration) *Converter {
+	return &Converter{Converter: backend, TTL: ttl}
+}
+
+func (c *Converter) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]converter.Format, error) {
+	profile := CookieProfile(cookiesPath)
+	if profile == "" {
+		return c.Converter.ListFormats(ctx, videoID, cookiesPath)
+	}
+
+	var formats []converter.Format
+	if get(KindFormats, videoID, profile, &formats) {
+		return formats, nil
+	}
+
+	formats, err := c.Converter.ListFormats(ctx, videoID, cookiesPath)
+	if err != nil {
+		return nil, err
+	}
+	set(KindFormats, videoID, profile, formats, c.TTL)
+	return formats, nil
+}
+
+// Provider envuelve un proveedor de metadatos y guarda en caché el resultado de Fetch
+type Provider struct {
+	metadata.Provider
+	TTL time.Duration
+}
+
+// NewProvider crea la caché de metadatos sobre el proveedor indicado
+func NewProvider(provider metadata.Provider, ttl time.Duration) *Provider {
+	return &Provider{Provider: provider, TTL: ttl}
+}
+
+func (p *Provider) Fetch(ctx context.Context, videoID string) (*metadata.Metadata, error) {
+	var info metadata.Metadata
+	if get(KindMetadata, videoID, DefaultProfile, &info) {
+		return &info, nil
+	}
+
+	result, err := p.Provider.Fetch(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	set(KindMetadata, videoID, DefaultProfile, result, p.TTL)
+	return result, nil
+}
+
+// get carga en dest una entrada vigente, los errores de la base de datos se tratan como un fallo de caché
+func get(kind string, videoID string, profile string, dest any) bool {
+	var data string
+	err := db.DB.QueryRow("SELECT data FROM lookup_cache WHERE kind = ? AND video_id = ? AND cookie_profile = ? AND expires_at > CURRENT_TIMESTAMP",
+		kind, videoID, profile).Scan(&data)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error leyendo la caché de %s del video %s: %v\n", kind, videoID, err)
+		}
+		return false
+	}
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		fmt.Printf("Entrada de caché de %s del video %s no válida: %v\n", kind, videoID, err)
+		return false
+	}
+	return true
+}
+
+// set guarda o reemplaza una entrada, si falla solo se registra porque el valor ya se ha obtenido
+func set(kind string, videoID string, profile string, value any, ttl time.Duration) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		fmt.Printf("Error serializando la caché de %s del video %s: %v\n", kind, videoID, err)
+		return
+	}
+	_, err = db.DB.Exec(`INSERT OR REPLACE INTO lookup_cache (kind, video_id, cookie_profile, data, created_at, expires_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, datetime('now', ?))`,
+		kind, videoID, profile, string(data), fmt.Sprintf("+%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		fmt.Printf("Error guardando la caché de %s del video %s: %v\n", kind, videoID, err)
+	}
+}
+
+// Invalidate borra las entradas de un video de todos los perfiles, solo de los tipos indicados si se pasan.
+// Devuelve el número de entradas borradas
+func Invalidate(videoID string, kinds ...string) (int64, error) {
+	if len(kinds) == 0 {
+		kinds = []string{KindFormats, KindMetadata}
+	}
+	var deleted int64
+	for _, kind := range kinds {
+		result, err := db.DB.Exec("DELETE FROM lookup_cache WHERE video_id = ? AND kind = ?", videoID, kind)
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// InvalidateProfile borra los formatos guardados con un perfil de cookies, por ejemplo al cambiar el
+// cookies.txt global. Los metadatos no dependen de las cookies y se conservan
+func InvalidateProfile(profile string) (int64, error) {
+	result, err := db.DB.Exec("DELETE FROM lookup_cache WHERE kind = ? AND cookie_profile = ?", KindFormats, profile)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Purge borra las entradas caducadas
+func Purge() (int64, error) {
+	result, err := db.DB.Exec("DELETE FROM lookup_cache WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
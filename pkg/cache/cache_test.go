@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"yt-converter-api/db"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/metadata"
+)
+
+// counting cuenta las extracciones que llegan al backend
+type counting struct {
+	*converter.Fake
+	calls int
+}
+
+func (c *counting) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]converter.Format, error) {
+	c.calls++
+	return c.Fake.ListFormats(ctx, videoID, cookiesPath)
+}
+
+func TestConverterCachesFormats(t *testing.T) {
+	db.OpenTestDB(t)
+	backend := &counting{Fake: converter.NewFake()}
+	cached := NewConverter(backend, time.Hour)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	cookiesA := filepath.Join(dir, "a.txt")
+	cookiesB := filepath.Join(dir, "b.txt")
+	cookiesACopy := filepath.Join(dir, "a-copy.txt")
+	os.WriteFile(cookiesA, []byte("# cookies A"), 0644)
+	os.WriteFile(cookiesB, []byte("# cookies B"), 0644)
+	os.WriteFile(cookiesACopy, []byte("# cookies A"), 0644)
+
+	steps := []struct {
+		name        string
+		videoID     string
+		cookiesPath string
+		calls       int
+	}{
+		{"primera consulta", "abc", "", 1},
+		{"misma consulta", "abc", "", 1},
+		{"otro video", "def", "", 2},
+		{"con cookies", "abc", cookiesA, 3},
+		{"otras cookies", "abc", cookiesB, 4},
+		{"mismo contenido de cookies", "abc", cookiesACopy, 4},
+		{"cookies ilegibles no usan la caché", "abc", filepath.Join(dir, "missing.txt"), 5},
+		{"cookies ilegibles otra vez", "abc", filepath.Join(dir, "missing.txt"), 6},
+	}
+	for _, step := range steps {
+		formats, err := cached.ListFormats(ctx, step.videoID, step.cookiesPath)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if len(formats) != len(backend.Formats) {
+			t.Errorf("%s: formats = %d, se esperaba %d", step.name, len(formats), len(backend.Formats))
+		}
+		if backend.calls != step.calls {
+			t.Errorf("%s: calls = %d, se esperaba %d", step.name, backend.calls, step.calls)
+		}
+	}
+
+	// Los formatos guardados conservan los campos derivados
+	formats, _ := cached.ListFormats(ctx, "abc", "")
+	if format, err := converter.SelectFormat(formats, "1080p60"); err != nil || format.ID != "399" {
+		t.Errorf("SelectFormat on cached formats = %v, %v", format, err)
+	}
+}
+
+func TestConverterDoesNotCacheErrors(t *testing.T) {
+	db.OpenTestDB(t)
+	backend := &counting{Fake: converter.NewFake()}
+	backend.Unavailable["gone"] = true
+	cached := NewConverter(backend, time.Hour)
+
+	for range 2 {
+		if _, err := cached.ListFormats(context.Background(), "gone", ""); err == nil {
+			t.Fatal("se esperaba un error")
+		}
+	}
+	if backend.calls != 2 {
+		t.Errorf("calls = %d, se esperaba 2", backend.calls)
+	}
+}
+
+func TestExpirationAndInvalidation(t *testing.T) {
+	db.OpenTestDB(t)
+	backend := &counting{Fake: converter.NewFake()}
+	cached := NewConverter(backend, time.Hour)
+	provider := NewProvider(&metadata.Stub{Videos: map[string]*metadata.Metadata{
+		"abc": {VideoID: "abc", Title: "Cached"},
+	}}, time.Hour)
+	ctx := context.Background()
+
+	cached.ListFormats(ctx, "abc", "")
+	if _, err := provider.Fetch(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Una entrada caducada se vuelve a pedir al backend y Purge la borra
+	db.DB.Exec("UPDATE lookup_cache SET expires_at = datetime('now', '-1 seconds') WHERE kind = ?", KindFormats)
+	if purged, err := Purge(); err != nil || purged != 1 {
+		t.Errorf("Purge() = %d, %v, se esperaba 1", purged, err)
+	}
+	cached.ListFormats(ctx, "abc", "")
+	if backend.calls != 2 {
+		t.Errorf("calls after expiration = %d, se esperaba 2", backend.calls)
+	}
+
+	// Cambiar el cookies.txt global solo descarta los formatos
+	if deleted, err := InvalidateProfile(DefaultProfile); err != nil || deleted != 1 {
+		t.Errorf("InvalidateProfile() = %d, %v, se esperaba 1", deleted, err)
+	}
+	cached.ListFormats(ctx, "abc", "")
+	if backend.calls != 3 {
+		t.Errorf("calls after InvalidateProfile = %d, se esperaba 3", backend.calls)
+	}
+
+	if deleted, err := Invalidate("abc", KindMetadata); err != nil || deleted != 1 {
+		t.Errorf("Invalidate(metadata) = %d, %v, se esperaba 1", deleted, err)
+	}
+	if deleted, err := Invalidate("abc"); err != nil || deleted != 1 {
+		t.Errorf("Invalidate() = %d, %v, se esperaba 1", deleted, err)
+	}
+	cached.ListFormats(ctx, "abc", "")
+	if backend.calls != 4 {
+		t.Errorf("calls after Invalidate = %d, se esperaba 4", backend.calls)
+	}
+}
+
+func TestProviderCachesMetadata(t *testing.T) {
+	db.OpenTestDB(t)
+	stub := &metadata.Stub{Videos: map[string]*metadata.Metadata{
+		"abc": {VideoID: "abc", Title: "Original", Provider: "stub"},
+	}}
+	provider := NewProvider(stub, time.Hour)
+	ctx := context.Background()
+
+	if _, err := provider.Fetch(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	stub.Videos["abc"] = &metadata.Metadata{VideoID: "abc", Title: "Changed"}
+	info, err := provider.Fetch(ctx, "abc")
+	if err != nil || info.Title != "Original" || info.Provider != "stub" {
+		t.Errorf("cached Fetch() = %+v, %v", info, err)
+	}
+
+	// Los videos que no existen no se guardan
+	if _, err := provider.Fetch(ctx, "missing"); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("Fetch(missing) error = %v, se esperaba ErrNotFound", err)
+	}
+	stub.Videos["missing"] = &metadata.Metadata{VideoID: "missing", Title: "Published"}
+	if info, err := provider.Fetch(ctx, "missing"); err != nil || info.Title != "Published" {
+		t.Errorf("Fetch(missing) after publishing = %+v, %v", info, err)
+	}
+}
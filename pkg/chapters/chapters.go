@@ -0,0 +1,178 @@
+// Package chapters lee los capítulos de un video y divide con ffmpeg un archivo de audio en una pista por
+// capítulo.
+//
+// Los capítulos vienen de los metadatos del backend (yt-dlp) o, si no los da, de las marcas de tiempo de la
+// descripción con las mismas reglas que usa YouTube: la primera en 0:00 y al menos tres capítulos.
+package chapters
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/ffmpeg"
+)
+
+// Chapter es un capítulo del video, en segundos desde el inicio
+type Chapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Track es el archivo generado para un capítulo
+type Track struct {
+	Position int     `json:"position"` // Número del capítulo, empieza en 1
+	Title    string  `json:"title"`
+	Path     string  `json:"path"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+}
+
+// Número mínimo de capítulos que YouTube exige en la descripción
+const minDescriptionChapters = 3
+
+// Longitud máxima del título en el nombre de archivo
+const maxTitleLength = 100
+
+// Marca de tiempo al principio de una línea de la descripción, opcionalmente entre paréntesis o corchetes:
+// "0:00 Intro", "(1:02:03) Final", "[12:30] - Parte 2"
+var timestampLine = regexp.MustCompile(`^[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*[-–—:|.]?\s*(.*)$`)
+
+// FromDescription lee los capítulos de las marcas de tiempo de la descripción. Devuelve nil si no hay
+// capítulos válidos: la primera marca debe ser 0:00, al menos tres, en orden y dentro de la duración
+func FromDescription(description string, duration float64) []Chapter {
+	if duration <= 0 {
+		return nil
+	}
+
+	var list []Chapter
+	for _, line := range strings.Split(description, "\n") {
+		match := timestampLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		start := parseTimestamp(match[1])
+		if start < 0 || start >= duration {
+			continue
+		}
+		if len(list) == 0 && start != 0 {
+			return nil
+		}
+		if len(list) > 0 && start <= list[len(list)-1].Start {
+			return nil
+		}
+		list = append(list, Chapter{Title: strings.TrimSpace(match[2]), Start: start})
+	}
+	if len(list) < minDescriptionChapters {
+		return nil
+	}
+
+	for i := range list {
+		if i+1 < len(list) {
+			list[i].End = list[i+1].Start
+		} else {
+			list[i].End = duration
+		}
+	}
+	return list
+}
+
+// parseTimestamp convierte MM:SS o HH:MM:SS en segundos, -1 si no es válida
+func parseTimestamp(value string) float64 {
+	var seconds float64
+	for i, part := range strings.Split(value, ":") {
+		number, err := strconv.Atoi(part)
+		if err != nil || (i > 0 && number >= 60) {
+			return -1
+		}
+		seconds = seconds*60 + float64(number)
+	}
+	return seconds
+}
+
+// Validate comprueba que los capítulos están en orden, no se solapan y no están vacíos
+func Validate(list []Chapter) error {
+	if len(list) == 0 {
+		return fmt.Errorf("el video no tiene capítulos")
+	}
+	for i, chapter := range list {
+		if chapter.End <= chapter.Start {
+			return fmt.Errorf("el capítulo %d termina antes de empezar", i+1)
+		}
+		if i > 0 && chapter.Start < list[i-1].End {
+			return fmt.Errorf("el capítulo %d se solapa con el anterior", i+1)
+		}
+	}
+	return nil
+}
+
+// FileName devuelve el nombre del archivo de un capítulo: número con dos cifras y título sin caracteres que no
+// se pueden usar en nombres de archivo, por ejemplo "03 - Parte 2.mp3"
+func FileName(position int, title string, extension string) string {
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	title = strings.Trim(strings.TrimSpace(title), ".")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength]))
+	}
+	if title == "" {
+		title = fmt.Sprintf("Capítulo %d", position)
+	}
+	return fmt.Sprintf("%02d - %s%s", position, title, extension)
+}
+
+// Args devuelve los argumentos de ffmpeg para copiar el capítulo de input en output sin recodificar
+func (c Chapter) Args(input string, output string) []string {
+	return []string{
+		"-ss", strconv.FormatFloat(c.Start, 'f', -1, 64),
+		"-to", strconv.FormatFloat(c.End, 'f', -1, 64),
+		"-i", input, "-map", "0:a", "-c", "copy", output,
+	}
+}
+
+// Split divide input en un archivo por capítulo dentro de outputDir, con la misma extensión que input. Si falla
+// un capítulo se borran los ya generados. El progreso se informa en la fase "split" según los capítulos
+// terminados
+func Split(ctx context.Context, binary string, input string, outputDir string, list []Chapter, onProgress func(models.Progress)) ([]Track, error) {
+	if err := Validate(list); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("error al crear la carpeta de los capítulos: %w", err)
+	}
+
+	report := func(done int, percent float64) {
+		if onProgress != nil {
+			total := (float64(done) + percent/100) * 100 / float64(len(list))
+			onProgress(models.Progress{Phase: "split", Percent: &total})
+		}
+	}
+
+	extension := filepath.Ext(input)
+	tracks := make([]Track, 0, len(list))
+	for i, chapter := range list {
+		output := filepath.Join(outputDir, FileName(i+1, chapter.Title, extension))
+		duration := time.Duration((chapter.End - chapter.Start) * float64(time.Second))
+		err := ffmpeg.Run(ctx, binary, chapter.Args(input, output), duration, func(percent float64) { report(i, percent) })
+		if err != nil {
+			for _, track := range tracks {
+				os.Remove(track.Path)
+			}
+			os.Remove(output)
+			return nil, fmt.Errorf("error al separar el capítulo %d: %w", i+1, err)
+		}
+		tracks = append(tracks, Track{Position: i + 1, Title: chapter.Title, Path: output, Start: chapter.Start, End: chapter.End})
+	}
+	return tracks, nil
+}
@@ -0,0 +1,114 @@
+package chapters
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFromDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		duration    float64
+		want        []Chapter
+	}{
+		{
+			name:        "capítulos válidos",
+			description: "Mix de verano\n\n0:00 Intro\n(3:15) - Segunda parte\n[1:02:03] Final: despedida\nGracias por ver",
+			duration:    4000,
+			want: []Chapter{
+				{Title: "Intro", Start: 0, End: 195},
+				{Title: "Segunda parte", Start: 195, End: 3723},
+				{Title: "Final: despedida", Start: 3723, End: 4000},
+			},
+		},
+		{"sin empezar en 0:00", "0:10 Intro\n1:00 Parte\n2:00 Final", 300, nil},
+		{"menos de tres", "0:00 Intro\n1:00 Final", 300, nil},
+		{"desordenados", "0:00 Intro\n2:00 Parte\n1:00 Final", 300, nil},
+		{"segundos no válidos", "0:00 Intro\n1:75 Parte\n2:00 Otra\n3:00 Final", 300, []Chapter{
+			{Title: "Intro", Start: 0, End: 120},
+			{Title: "Otra", Start: 120, End: 180},
+			{Title: "Final", Start: 180, End: 300},
+		}},
+		{"sin duración", "0:00 Intro\n1:00 Parte\n2:00 Final", 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromDescription(tt.description, tt.duration); !slices.Equal(got, tt.want) {
+				t.Errorf("FromDescription() = %+v\nse esperaba        %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		position int
+		title    string
+		want     string
+	}{
+		{1, "Intro", "01 - Intro.mp3"},
+		{12, "AC/DC: Back in Black?", "12 - AC_DC_ Back in Black_.mp3"},
+		{3, "  ..  ", "03 - Capítulo 3.mp3"},
+		{4, strings.Repeat("á", 120), "04 - " + strings.Repeat("á", 100) + ".mp3"},
+	}
+	for _, tt := range tests {
+		if got := FileName(tt.position, tt.title, ".mp3"); got != tt.want {
+			t.Errorf("FileName(%d, %q) = %q, se esperaba %q", tt.position, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+
+	// ffmpeg falso: copia la entrada en la salida (último argumento) y falla con el capítulo que empieza en 20
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	script := `#!/bin/sh
+for arg; do
+	[ "$prev" = "-i" ] && input=$arg
+	[ "$prev" = "-ss" ] && start=$arg
+	prev=$arg
+done
+[ "$start" = "20" ] && exit 1
+cp "$input" "$arg"
+`
+	if err := os.WriteFile(fakeFFmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "abc.mp3")
+	os.WriteFile(input, []byte("audio"), 0644)
+
+	list := []Chapter{{Title: "Intro", Start: 0, End: 10}, {Title: "Tema 1", Start: 10, End: 15}}
+	tracks, err := Split(context.Background(), fakeFFmpeg, input, filepath.Join(dir, "tracks"), list, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 || tracks[1].Position != 2 || tracks[1].Path != filepath.Join(dir, "tracks", "02 - Tema 1.mp3") {
+		t.Fatalf("tracks = %+v", tracks)
+	}
+	for _, track := range tracks {
+		if data, err := os.ReadFile(track.Path); err != nil || string(data) != "audio" {
+			t.Errorf("contenido de %s = %q, %v", track.Path, data, err)
+		}
+	}
+
+	// Si falla un capítulo no quedan pistas sueltas
+	list = append(list, Chapter{Title: "Tema 2", Start: 20, End: 30})
+	list[1].End = 20
+	if _, err := Split(context.Background(), fakeFFmpeg, input, filepath.Join(dir, "failed"), list, nil); err == nil {
+		t.Fatal("se esperaba un error")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "failed")); len(entries) != 0 {
+		t.Errorf("quedan %d archivos tras el error", len(entries))
+	}
+
+	if _, err := Split(context.Background(), fakeFFmpeg, input, dir, nil, nil); err == nil {
+		t.Error("se esperaba un error sin capítulos")
+	}
+}
@@ -0,0 +1,166 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"yt-converter-api/pkg/loudness"
+)
+
+// Formatos de audio que se pueden generar
+const (
+	AudioMP3  = "mp3"
+	AudioOpus = "opus"
+	AudioFLAC = "flac"
+	AudioWAV  = "wav"
+	AudioM4A  = "m4a" // AAC, sin recodificar salvo que se pida bitrate o frecuencia de muestreo
+	AudioOGG  = "ogg" // Vorbis
+)
+
+// AudioOptions describe el audio que se genera al procesar un video en modo audio
+type AudioOptions struct {
+	Format     string `json:"format"`                // mp3, opus, flac, wav, m4a u ogg, vacío equivale a mp3
+	Bitrate    int    `json:"bitrate,omitempty"`     // kbps, bitrate constante o medio
+	Quality    *int   `json:"quality,omitempty"`     // Calidad VBR del códec: 0 (mejor) a 9 en MP3, 0 a 10 (mejor) en OGG
+	SampleRate int    `json:"sample_rate,omitempty"` // Hz, vacío conserva la del original
+	// Sonoridad integrada objetivo en LUFS de la normalización EBU R128, 0 para no normalizar. Se aplica
+	// después de convertir con cualquier backend
+	Loudness float64 `json:"loudness,omitempty"`
+}
+
+// audioCodec son las características de cada formato de salida
+type audioCodec struct {
+	encoder     string   // Códec de ffmpeg
+	lossless    bool     // No admite bitrate ni calidad
+	quality     [2]int   // Rango de calidad VBR, {0, 0} si el códec no la admite
+	sampleRates []int    // Frecuencias admitidas, vacío si admite todas las habituales
+	defaults    []string // Argumentos de ffmpeg si no se indica bitrate ni calidad
+}
+
+var audioCodecs = map[string]audioCodec{
+	AudioMP3:  {encoder: "libmp3lame", quality: [2]int{0, 9}, defaults: []string{"-q:a", "2"}},
+	AudioOpus: {encoder: "libopus", sampleRates: []int{8000, 12000, 16000, 24000, 48000}, defaults: []string{"-b:a", "160k"}},
+	AudioFLAC: {encoder: "flac", lossless: true},
+	AudioWAV:  {encoder: "pcm_s16le", lossless: true},
+	AudioM4A:  {encoder: "aac"},
+	AudioOGG:  {encoder: "libvorbis", quality: [2]int{0, 10}, defaults: []string{"-q:a", "5"}},
+}
+
+// Frecuencias de muestreo admitidas por los códecs sin restricciones propias
+var sampleRates = []int{8000, 11025, 16000, 22050, 24000, 32000, 44100, 48000, 88200, 96000}
+
+// AudioFormats devuelve los formatos de audio disponibles
+func AudioFormats() []string {
+	return []string{AudioMP3, AudioOpus, AudioFLAC, AudioWAV, AudioM4A, AudioOGG}
+}
+
+// normalized devuelve las opciones con el formato en minúsculas y MP3 por defecto
+func (o AudioOptions) normalized() AudioOptions {
+	o.Format = strings.ToLower(strings.TrimSpace(o.Format))
+	if o.Format == "" {
+		o.Format = AudioMP3
+	}
+	return o
+}
+
+// Validate comprueba que el formato existe y que admite las opciones indicadas
+func (o AudioOptions) Validate() error {
+	o = o.normalized()
+	codec, ok := audioCodecs[o.Format]
+	if !ok {
+		return fmt.Errorf("formato de audio no soportado: %s, los disponibles son %s", o.Format, strings.Join(AudioFormats(), ", "))
+	}
+	if o.Bitrate != 0 && o.Quality != nil {
+		return fmt.Errorf("no se puede indicar a la vez bitrate y calidad VBR")
+	}
+	if o.Bitrate != 0 {
+		if codec.lossless {
+			return fmt.Errorf("el formato %s no admite bitrate", o.Format)
+		}
+		if o.Bitrate < 32 || o.Bitrate > 512 {
+			return fmt.Errorf("el bitrate debe estar entre 32 y 512 kbps")
+		}
+	}
+	if o.Quality != nil {
+		if codec.quality == [2]int{} {
+			return fmt.Errorf("el formato %s no admite calidad VBR", o.Format)
+		}
+		if *o.Quality < codec.quality[0] || *o.Quality > codec.quality[1] {
+			return fmt.Errorf("la calidad VBR de %s debe estar entre %d y %d", o.Format, codec.quality[0], codec.quality[1])
+		}
+	}
+	if o.SampleRate != 0 {
+		allowed := sampleRates
+		if codec.sampleRates != nil {
+			allowed = codec.sampleRates
+		}
+		if !slices.Contains(allowed, o.SampleRate) {
+			return fmt.Errorf("el formato %s no admite la frecuencia de muestreo %d Hz", o.Format, o.SampleRate)
+		}
+	}
+	if o.Loudness != 0 {
+		return loudness.ValidateTarget(o.Loudness)
+	}
+	return nil
+}
+
+// Key devuelve la variante con la que se guarda el audio, por ejemplo mp3, opus-128k, mp3-q0, flac-48000hz o
+// mp3-loudnorm16 (normalizado a -16 LUFS).
+// El MP3 sin opciones conserva la variante "mp3" de las versiones anteriores
+func (o AudioOptions) Key() string {
+	o = o.normalized()
+	key := o.Format
+	if o.Bitrate != 0 {
+		key += fmt.Sprintf("-%dk", o.Bitrate)
+	}
+	if o.Quality != nil {
+		key += fmt.Sprintf("-q%d", *o.Quality)
+	}
+	if o.SampleRate != 0 {
+		key += fmt.Sprintf("-%dhz", o.SampleRate)
+	}
+	if o.Loudness != 0 {
+		key += "-loudnorm" + loudness.FormatTarget(-o.Loudness)
+	}
+	return key
+}
+
+// Extension devuelve la extensión del archivo generado, con punto
+func (o AudioOptions) Extension() string {
+	return "." + o.normalized().Format
+}
+
+// Passthrough indica si el audio original (AAC) se puede copiar sin recodificar
+func (o AudioOptions) Passthrough() bool {
+	o = o.normalized()
+	return o.Format == AudioM4A && o.Bitrate == 0 && o.SampleRate == 0
+}
+
+// FFmpegArgs devuelve los argumentos de ffmpeg para codificar el audio, sin entrada ni salida
+func (o AudioOptions) FFmpegArgs() []string {
+	if o.Passthrough() {
+		return []string{"-vn", "-c:a", "copy"}
+	}
+	return o.EncodeArgs()
+}
+
+// EncodeArgs devuelve los argumentos de ffmpeg para codificar el audio como FFmpegArgs pero sin copiar nunca
+// el original, para cuando se aplica un filtro como la normalización
+func (o AudioOptions) EncodeArgs() []string {
+	o = o.normalized()
+	codec := audioCodecs[o.Format]
+	args := []string{"-vn", "-c:a", codec.encoder}
+	switch {
+	case o.Bitrate != 0:
+		args = append(args, "-b:a", fmt.Sprintf("%dk", o.Bitrate))
+	case o.Quality != nil:
+		args = append(args, "-q:a", strconv.Itoa(*o.Quality))
+	default:
+		args = append(args, codec.defaults...)
+	}
+	if o.SampleRate != 0 {
+		args = append(args, "-ar", strconv.Itoa(o.SampleRate))
+	}
+	return args
+}
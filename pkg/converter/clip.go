@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Clip es un fragmento de un video, en segundos desde el inicio
+type Clip struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// ParseTimestamp convierte una marca de tiempo en segundos, admite segundos (90 o 90.5), MM:SS y HH:MM:SS
+// con decimales opcionales en los segundos
+func ParseTimestamp(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, ":")
+	if value == "" || len(parts) > 3 {
+		return 0, fmt.Errorf("marca de tiempo no válida: %q", value)
+	}
+
+	var seconds float64
+	for i, part := range parts {
+		// Solo dígitos y punto decimal, ParseFloat también acepta exponentes, signos o "inf"
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || strings.Trim(part, "0123456789.") != "" {
+			return 0, fmt.Errorf("marca de tiempo no válida: %q", value)
+		}
+		// Solo la última parte puede tener decimales, los minutos y segundos no pueden pasar de 59
+		if i < len(parts)-1 && strings.Contains(part, ".") {
+			return 0, fmt.Errorf("marca de tiempo no válida: %q", value)
+		}
+		if i > 0 && number >= 60 {
+			return 0, fmt.Errorf("marca de tiempo no válida: %q", value)
+		}
+		seconds = seconds*60 + number
+	}
+	return seconds, nil
+}
+
+// ParseClip lee el inicio y el fin de un fragmento, devuelve nil si no se indica ninguno. Sin inicio el
+// fragmento empieza en el segundo 0, el fin es obligatorio
+func ParseClip(start string, end string) (*Clip, error) {
+	if start == "" && end == "" {
+		return nil, nil
+	}
+	if end == "" {
+		return nil, fmt.Errorf("debes indicar el fin del fragmento")
+	}
+
+	clip := &Clip{}
+	var err error
+	if start != "" {
+		if clip.Start, err = ParseTimestamp(start); err != nil {
+			return nil, err
+		}
+	}
+	if clip.End, err = ParseTimestamp(end); err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
+
+// Validate comprueba que el fragmento no está vacío y, si se conoce la duración del video, que está dentro
+func (c Clip) Validate(duration float64) error {
+	if c.End <= c.Start {
+		return fmt.Errorf("el fin del fragmento debe ser posterior al inicio")
+	}
+	if duration > 0 && c.End > duration {
+		return fmt.Errorf("el fragmento termina después del final del video (%s)", formatSeconds(duration))
+	}
+	return nil
+}
+
+// Duration devuelve la duración del fragmento en segundos
+func (c Clip) Duration() float64 {
+	return c.End - c.Start
+}
+
+// Key devuelve el rango con el que se identifica el fragmento en la variante, por ejemplo 90-120.5
+func (c Clip) Key() string {
+	return formatSeconds(c.Start) + "-" + formatSeconds(c.End)
+}
+
+// InputArgs devuelve los argumentos de ffmpeg que limitan una entrada al fragmento, van antes de -i
+func (c Clip) InputArgs() []string {
+	return []string{"-ss", formatSeconds(c.Start), "-to", formatSeconds(c.End)}
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
@@ -0,0 +1,108 @@
+// Package converter define la interfaz común de los backends que descargan y convierten videos.
+//
+// El backend activo se elige en la configuración (CONVERTER) y se guarda en Current, así los handlers y
+// los workers no dependen de cómo se hace la conversión y se pueden probar sin red con el backend fake.
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"yt-converter-api/config"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/chapters"
+)
+
+// Nombres de los backends disponibles
+const (
+	BackendPython = "python"
+	BackendNative = "native"
+	BackendFake   = "fake"
+)
+
+// Errores comunes que devuelven todos los backends, se pueden comprobar con errors.Is
+var (
+	ErrVideoUnavailable      = errors.New("el video no existe o no está disponible")
+	ErrResolutionUnavailable = errors.New("la resolución no está disponible")
+	ErrPlaylistUnavailable   = errors.New("la lista de reproducción no existe o no está disponible")
+	ErrSourceUnsupported     = errors.New("el backend no admite videos de este sitio")
+)
+
+// Request describe una conversión
+type Request struct {
+	VideoID     string       // ID del video de YouTube o URL del video en otros sitios
+	IsAudio     bool         // Si es true se genera un archivo de audio según Audio y se ignora Resolution
+	Audio       AudioOptions // Formato, bitrate y frecuencia del audio, por defecto MP3
+	Resolution  string       // Resolución del video, por ejemplo 720p
+	FormatID    string       // Formato de video concreto (ID de yt-dlp), si se indica tiene prioridad sobre Resolution
+	Clip        *Clip        // Fragmento que se descarga, nil para el video completo
+	CookiesPath string       // Archivo cookies.txt opcional
+	OutputDir   string       // Carpeta donde se deja el archivo generado
+}
+
+// Info es la información básica de un video
+type Info struct {
+	ID        string             `json:"id"`
+	Title     string             `json:"title"`
+	Duration  float64            `json:"duration"` // Segundos
+	Channel   string             `json:"channel"`
+	IsLive    bool               `json:"is_live"`
+	Chapters  []chapters.Chapter `json:"chapters,omitempty"`  // Vacío si el video no tiene capítulos
+	Subtitles []Subtitle         `json:"subtitles,omitempty"` // Pistas de subtítulos manuales y automáticos
+}
+
+// Converter es un backend de descarga y conversión. Los videos se identifican por su ID de YouTube o, en
+// otros sitios, por su URL (sources.Source.Ref)
+type Converter interface {
+	// Name devuelve el nombre del backend
+	Name() string
+	// ListFormats devuelve los formatos de video y de solo audio disponibles
+	ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]Format, error)
+	// Convert descarga y convierte el video, devuelve la ruta del archivo generado dentro de req.OutputDir
+	Convert(ctx context.Context, req Request, onProgress func(models.Progress)) (string, error)
+	// Probe comprueba que el video existe y devuelve su información básica
+	Probe(ctx context.Context, videoID string, cookiesPath string) (*Info, error)
+	// FetchSubtitle descarga en WebVTT una de las pistas de subtítulos que devuelve Probe
+	FetchSubtitle(ctx context.Context, subtitle Subtitle, cookiesPath string) ([]byte, error)
+	// ListPlaylist devuelve los videos de una lista de reproducción en orden, sin consultar cada video
+	ListPlaylist(ctx context.Context, playlistID string, cookiesPath string) (*Playlist, error)
+}
+
+// Current es el backend que usa la aplicación, se establece con Init
+var Current Converter
+
+// New crea el backend con el nombre indicado
+func New(name string, cfg config.Config) (Converter, error) {
+	switch name {
+	case BackendPython, "":
+		return NewPython(cfg.PyConverterPath), nil
+	case BackendNative:
+		// El archivo de cookies global es el que usa el script de Python, en su misma carpeta
+		return NewNative(cfg.FFmpegPath, filepath.Join(filepath.Dir(cfg.PyConverterPath), "cookies.txt")), nil
+	case BackendFake:
+		return NewFake(), nil
+	}
+	return nil, fmt.Errorf("backend de conversión desconocido: %s", name)
+}
+
+// Init establece Current con el backend configurado y, si se ha configurado otro distinto como
+// respaldo (CONVERTER_FALLBACK), lo usa cuando el principal falla
+func Init(cfg config.Config) error {
+	backend, err := New(cfg.Converter, cfg)
+	if err != nil {
+		return err
+	}
+
+	// El backend fake nunca usa respaldo, así las pruebas no acaban accediendo a la red
+	if cfg.ConverterFallback != "" && cfg.ConverterFallback != backend.Name() && backend.Name() != BackendFake {
+		fallback, err := New(cfg.ConverterFallback, cfg)
+		if err != nil {
+			return err
+		}
+		backend = &Fallback{Primary: backend, Secondary: fallback}
+	}
+
+	Current = backend
+	return nil
+}
@@ -0,0 +1,493 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"yt-converter-api/config"
+	"yt-converter-api/models"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+func TestFakeConvert(t *testing.T) {
+	fake := NewFake()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		req     Request
+		file    string
+		content string
+		err     error
+	}{
+		{name: "audio", req: Request{VideoID: "dQw4w9WgXcQ", IsAudio: true, Resolution: "mp3"}, file: "dQw4w9WgXcQ.mp3", content: "fake:dQw4w9WgXcQ:mp3:audio=true\n"},
+		{name: "audio opus", req: Request{VideoID: "dQw4w9WgXcQ", IsAudio: true, Resolution: "opus-128k", Audio: AudioOptions{Format: "opus", Bitrate: 128}}, file: "dQw4w9WgXcQ.opus", content: "fake:dQw4w9WgXcQ:opus-128k:audio=true\n"},
+		{name: "video", req: Request{VideoID: "dQw4w9WgXcQ", Resolution: "720p"}, file: "dQw4w9WgXcQ-720p30-h264.mp4", content: "fake:dQw4w9WgXcQ:720p:audio=false\n"},
+		{name: "formato concreto", req: Request{VideoID: "dQw4w9WgXcQ", FormatID: "399"}, file: "dQw4w9WgXcQ-1080p60-av1.mp4", content: "fake:dQw4w9WgXcQ::audio=false\n"},
+		{name: "fragmento", req: Request{VideoID: "dQw4w9WgXcQ", Resolution: "720p", Clip: &Clip{Start: 90, End: 120.5}}, file: "dQw4w9WgXcQ-720p30-h264.mp4", content: "fake:dQw4w9WgXcQ:720p:audio=false:clip=90-120.5\n"},
+		{name: "resolución no disponible", req: Request{VideoID: "dQw4w9WgXcQ", Resolution: "4320p"}, err: ErrResolutionUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.OutputDir = dir
+			var phases int
+			path, err := fake.Convert(context.Background(), tt.req, func(models.Progress) { phases++ })
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("se esperaba %v, se obtuvo %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+
+			if path != filepath.Join(dir, tt.file) {
+				t.Errorf("path = %s, se esperaba %s", path, filepath.Join(dir, tt.file))
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || string(data) != tt.content {
+				t.Errorf("contenido = %q (%v), se esperaba %q", data, err, tt.content)
+			}
+			if phases != 2 {
+				t.Errorf("se recibieron %d progresos, se esperaban 2", phases)
+			}
+		})
+	}
+}
+
+func TestFakeUnavailable(t *testing.T) {
+	fake := NewFake()
+	fake.Unavailable["xxxxxxxxxxx"] = true
+
+	if _, err := fake.ListFormats(context.Background(), "xxxxxxxxxxx", ""); !errors.Is(err, ErrVideoUnavailable) {
+		t.Errorf("ListFormats: se esperaba ErrVideoUnavailable, se obtuvo %v", err)
+	}
+	if _, err := fake.Probe(context.Background(), "xxxxxxxxxxx", ""); !errors.Is(err, ErrVideoUnavailable) {
+		t.Errorf("Probe: se esperaba ErrVideoUnavailable, se obtuvo %v", err)
+	}
+}
+
+func TestFakeListPlaylist(t *testing.T) {
+	fake := NewFake()
+	fake.Playlists = map[string]int{"PLlargalista01": 120}
+	fake.Unavailable["PLnoexiste0001"] = true
+
+	playlist, err := fake.ListPlaylist(context.Background(), "PLabcdefghij", "")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if len(playlist.Entries) != 3 || playlist.Entries[0].ID != "abcdefg-001" || playlist.Entries[2].ID != "abcdefg-003" {
+		t.Errorf("ListPlaylist() = %+v", playlist.Entries)
+	}
+
+	playlist, err = fake.ListPlaylist(context.Background(), "PLlargalista01", "")
+	if err != nil || len(playlist.Entries) != 120 || len(playlist.Entries[119].ID) != 11 {
+		t.Errorf("se esperaban 120 videos con IDs de 11 caracteres, error = %v", err)
+	}
+
+	if _, err := fake.ListPlaylist(context.Background(), "PLnoexiste0001", ""); !errors.Is(err, ErrPlaylistUnavailable) {
+		t.Errorf("se esperaba ErrPlaylistUnavailable, se obtuvo %v", err)
+	}
+}
+
+func TestAvailableEntries(t *testing.T) {
+	entries := availableEntries([]PlaylistEntry{
+		{ID: "aaaaaaaaaaa", Title: "Uno"},
+		{ID: "bbbbbbbbbbb", Title: "[Private video]"},
+		{ID: "", Title: "Sin ID"},
+		{ID: "ccccccccccc", Title: "[Deleted video]"},
+		{ID: "aaaaaaaaaaa", Title: "Uno repetido"},
+		{ID: "ddddddddddd", Title: "Dos"},
+	})
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	if !slices.Equal(ids, []string{"aaaaaaaaaaa", "ddddddddddd"}) {
+		t.Errorf("availableEntries() = %v", ids)
+	}
+}
+
+func TestFakeConvertCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewFake().Convert(ctx, Request{VideoID: "dQw4w9WgXcQ", IsAudio: true, OutputDir: t.TempDir()}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("se esperaba context.Canceled, se obtuvo %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for name, want := range map[string]string{"": BackendPython, BackendPython: BackendPython, BackendNative: BackendNative, BackendFake: BackendFake} {
+		backend, err := New(name, config.Config{})
+		if err != nil || backend.Name() != want {
+			t.Errorf("New(%q) = %v, %v; se esperaba %s", name, backend, err, want)
+		}
+	}
+	if _, err := New("desconocido", config.Config{}); err == nil {
+		t.Error("se esperaba un error con un backend desconocido")
+	}
+}
+
+// El backend de Python traduce los códigos de error del script a los errores comunes
+func TestPythonMapsScriptErrors(t *testing.T) {
+	if _, err := os.Stat(pythonInterpreter); err != nil {
+		t.Skip("python3 no disponible")
+	}
+
+	script := filepath.Join(t.TempDir(), "main.py")
+	err := os.WriteFile(script, []byte(`import sys
+print('{"v": 1, "type": "error", "error": {"code": "video_unavailable", "message": "Video unavailable"}}')
+sys.exit(1)
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewPython(script).ListFormats(context.Background(), "dQw4w9WgXcQ", "")
+	if !errors.Is(err, ErrVideoUnavailable) {
+		t.Errorf("se esperaba ErrVideoUnavailable, se obtuvo %v", err)
+	}
+}
+
+func TestPythonListFormats(t *testing.T) {
+	if _, err := os.Stat(pythonInterpreter); err != nil {
+		t.Skip("python3 no disponible")
+	}
+	fixture, err := filepath.Abs(filepath.Join("..", "protocol", "testdata", "formats.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := filepath.Join(t.TempDir(), "main.py")
+	if err := os.WriteFile(script, []byte("print(open("+strconv.Quote(fixture)+").read())\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	formats, err := NewPython(script).ListFormats(context.Background(), "dQw4w9WgXcQ", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptors := []string{}
+	for _, format := range formats {
+		descriptors = append(descriptors, format.Descriptor)
+	}
+	want := []string{"audio-aac-130k", "360p25-h264", "360p25-h264", "720p25-av1"}
+	if !slices.Equal(descriptors, want) {
+		t.Errorf("descriptores = %v, se esperaba %v", descriptors, want)
+	}
+	if formats[2].AudioCodec != "aac" || formats[1].AudioCodec != "" || formats[3].FileSize != 26648256 {
+		t.Errorf("formatos inesperados: %+v", formats)
+	}
+}
+
+func TestNativeFormatSelection(t *testing.T) {
+	formats := youtube.FormatList{
+		{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, Height: 360, AudioChannels: 2, Bitrate: 500},
+		{ItagNo: 134, MimeType: `video/mp4; codecs="avc1.4d401e"`, Height: 360, Bitrate: 300},
+		{ItagNo: 243, MimeType: `video/webm; codecs="vp9"`, Height: 360, Bitrate: 400},
+		{ItagNo: 247, MimeType: `video/webm; codecs="vp9"`, Height: 720, Bitrate: 1500},
+		{ItagNo: 140, MimeType: `audio/mp4; codecs="mp4a.40.2"`, AudioChannels: 2, Bitrate: 130},
+		{ItagNo: 251, MimeType: `audio/webm; codecs="opus"`, AudioChannels: 2, Bitrate: 160},
+	}
+
+	tests := []struct {
+		height int
+		itag   int
+	}{
+		{height: 360, itag: 134}, // Solo video en MP4 aunque tenga menos bitrate
+		{height: 720, itag: 247},
+		{height: 1080, itag: 0},
+	}
+	for _, tt := range tests {
+		got := bestVideo(formats, tt.height)
+		if (got == nil && tt.itag != 0) || (got != nil && got.ItagNo != tt.itag) {
+			t.Errorf("bestVideo(%d) = %v, se esperaba el itag %d", tt.height, got, tt.itag)
+		}
+	}
+
+	if audio := bestAudio(formats); audio == nil || audio.ItagNo != 140 {
+		t.Errorf("bestAudio = %v, se esperaba el itag 140", audio)
+	}
+	if ext := extension(formats[4].MimeType); ext != "m4a" {
+		t.Errorf("extension = %s, se esperaba m4a", ext)
+	}
+}
+
+func TestLoadCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	content := "# Netscape HTTP Cookie File\n" +
+		".youtube.com\tTRUE\t/\tTRUE\t0\tPREF\tf6=40000000\n" +
+		"#HttpOnly_.youtube.com\tTRUE\t/\tTRUE\t0\tLOGIN_INFO\tabc\n" +
+		"línea inválida\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err := loadCookies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := jar.Cookies(&url.URL{Scheme: "https", Host: "www.youtube.com", Path: "/"})
+	if len(cookies) != 2 {
+		t.Errorf("se cargaron %d cookies, se esperaban 2: %v", len(cookies), cookies)
+	}
+}
+
+func TestNativeDefaultCookies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	native := NewNative("ffmpeg", path)
+
+	// Sin archivo global se usa el cliente sin cookies
+	if client, err := native.clientFor(""); err != nil || client != native.client {
+		t.Errorf("clientFor(\"\") = %v, %v, se esperaba el cliente sin cookies", client, err)
+	}
+
+	if err := os.WriteFile(path, []byte(".youtube.com\tTRUE\t/\tTRUE\t0\tPREF\tf6=40000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := native.clientFor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client == native.client || client.HTTPClient == nil || client.HTTPClient.Jar == nil {
+		t.Fatal("se esperaba un cliente con las cookies del archivo global")
+	}
+	if cookies := client.HTTPClient.Jar.Cookies(&url.URL{Scheme: "https", Host: "www.youtube.com", Path: "/"}); len(cookies) != 1 {
+		t.Errorf("se cargaron %d cookies, se esperaba 1", len(cookies))
+	}
+}
+
+// failing es un backend que siempre devuelve el mismo error
+type failing struct {
+	Fake
+	err error
+}
+
+func (f *failing) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]Format, error) {
+	return nil, f.err
+}
+
+func TestFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{name: "error temporal", err: errors.New("HTTP 403"), want: []string{"360p", "720p", "1080p"}},
+		{name: "video no disponible", err: ErrVideoUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &Fallback{Primary: &failing{err: tt.err}, Secondary: NewFake()}
+			formats, err := backend.ListFormats(context.Background(), "dQw4w9WgXcQ", "")
+			got := Resolutions(formats)
+			if tt.want == nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("se esperaba %v sin respaldo, se obtuvo %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("ListFormats = %v, %v; se esperaba %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFormat(t *testing.T) {
+	formats := NewFake().Formats
+
+	tests := []struct {
+		selector string
+		id       string
+	}{
+		{selector: "1080p", id: "399"}, // Sin más detalle se prefieren más fps
+		{selector: "1080p30", id: "137"},
+		{selector: "1080p60-av1", id: "399"},
+		{selector: "1080P-H264", id: "137"},
+		{selector: "720p", id: "136"},
+		{selector: "137", id: "137"},
+		{selector: "1080p60-h264"},
+		{selector: "1080p-hdr"},
+		{selector: "140"}, // Solo audio
+		{selector: "999"},
+	}
+	for _, tt := range tests {
+		format, err := SelectFormat(formats, tt.selector)
+		if tt.id == "" {
+			if err == nil {
+				t.Errorf("SelectFormat(%q) = %s, se esperaba un error", tt.selector, format.ID)
+			}
+			continue
+		}
+		if err != nil || format.ID != tt.id {
+			t.Errorf("SelectFormat(%q) = %v, %v; se esperaba %s", tt.selector, format, err, tt.id)
+		}
+	}
+}
+
+func TestFormatDescriptors(t *testing.T) {
+	tests := map[string]Format{
+		"1080p60-av1":     {VideoCodec: "av01.0.08M.08", Height: 1080, FPS: 60},
+		"2160p60-vp9-hdr": {VideoCodec: "vp09.02.51.10", Height: 2160, FPS: 59.94, HDR: true},
+		"360p30-h264":     {VideoCodec: "avc1.42001E", AudioCodec: "mp4a.40.2", Height: 360, FPS: 30},
+		"audio-opus-160k": {AudioCodec: "opus", Bitrate: 160.4},
+	}
+	for want, format := range tests {
+		if got := newFormat(format).Descriptor; got != want {
+			t.Errorf("descriptor = %s, se esperaba %s", got, want)
+		}
+	}
+
+	if got := Resolutions(NewFake().Formats); !slices.Equal(got, []string{"360p", "720p", "1080p"}) {
+		t.Errorf("Resolutions = %v", got)
+	}
+}
+
+func TestAudioOptions(t *testing.T) {
+	quality := func(q int) *int { return &q }
+
+	tests := []struct {
+		name    string
+		options AudioOptions
+		key     string
+		args    []string
+		err     bool
+	}{
+		{name: "mp3 por defecto", options: AudioOptions{}, key: "mp3", args: []string{"-vn", "-c:a", "libmp3lame", "-q:a", "2"}},
+		{name: "mp3 VBR", options: AudioOptions{Format: "MP3", Quality: quality(0)}, key: "mp3-q0", args: []string{"-vn", "-c:a", "libmp3lame", "-q:a", "0"}},
+		{name: "mp3 CBR", options: AudioOptions{Format: "mp3", Bitrate: 320, SampleRate: 44100}, key: "mp3-320k-44100hz", args: []string{"-vn", "-c:a", "libmp3lame", "-b:a", "320k", "-ar", "44100"}},
+		{name: "opus", options: AudioOptions{Format: "opus", Bitrate: 96}, key: "opus-96k", args: []string{"-vn", "-c:a", "libopus", "-b:a", "96k"}},
+		{name: "flac", options: AudioOptions{Format: "flac", SampleRate: 48000}, key: "flac-48000hz", args: []string{"-vn", "-c:a", "flac", "-ar", "48000"}},
+		{name: "wav", options: AudioOptions{Format: "wav"}, key: "wav", args: []string{"-vn", "-c:a", "pcm_s16le"}},
+		{name: "m4a sin recodificar", options: AudioOptions{Format: "m4a"}, key: "m4a", args: []string{"-vn", "-c:a", "copy"}},
+		{name: "m4a con bitrate", options: AudioOptions{Format: "m4a", Bitrate: 192}, key: "m4a-192k", args: []string{"-vn", "-c:a", "aac", "-b:a", "192k"}},
+		{name: "ogg", options: AudioOptions{Format: "ogg", Quality: quality(8)}, key: "ogg-q8", args: []string{"-vn", "-c:a", "libvorbis", "-q:a", "8"}},
+		{name: "mp3 normalizado", options: AudioOptions{Loudness: -16}, key: "mp3-loudnorm16", args: []string{"-vn", "-c:a", "libmp3lame", "-q:a", "2"}},
+		{name: "opus normalizado", options: AudioOptions{Format: "opus", Bitrate: 128, Loudness: -14.5}, key: "opus-128k-loudnorm14.5", args: []string{"-vn", "-c:a", "libopus", "-b:a", "128k"}},
+		{name: "objetivo de sonoridad fuera de rango", options: AudioOptions{Loudness: -2}, err: true},
+		{name: "formato desconocido", options: AudioOptions{Format: "wma"}, err: true},
+		{name: "flac con bitrate", options: AudioOptions{Format: "flac", Bitrate: 320}, err: true},
+		{name: "bitrate y calidad", options: AudioOptions{Bitrate: 128, Quality: quality(2)}, err: true},
+		{name: "calidad fuera de rango", options: AudioOptions{Quality: quality(10)}, err: true},
+		{name: "opus sin calidad VBR", options: AudioOptions{Format: "opus", Quality: quality(5)}, err: true},
+		{name: "opus a 44100 Hz", options: AudioOptions{Format: "opus", SampleRate: 44100}, err: true},
+		{name: "bitrate demasiado bajo", options: AudioOptions{Bitrate: 8}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.err {
+				if err == nil {
+					t.Fatal("se esperaba un error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+			if key := tt.options.Key(); key != tt.key {
+				t.Errorf("Key() = %s, se esperaba %s", key, tt.key)
+			}
+			if args := tt.options.FFmpegArgs(); !slices.Equal(args, tt.args) {
+				t.Errorf("FFmpegArgs() = %v, se esperaba %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseClip(t *testing.T) {
+	tests := []struct {
+		start, end string
+		clip       *Clip
+		key        string
+		err        bool
+	}{
+		{start: "", end: "", clip: nil},
+		{start: "90", end: "120", clip: &Clip{Start: 90, End: 120}, key: "90-120"},
+		{start: "1:30", end: "2:00.5", clip: &Clip{Start: 90, End: 120.5}, key: "90-120.5"},
+		{start: "01:02:03", end: "1:02:33.25", clip: &Clip{Start: 3723, End: 3753.25}, key: "3723-3753.25"},
+		{start: "", end: "30", clip: &Clip{Start: 0, End: 30}, key: "0-30"},
+		{start: "30", end: "", err: true},
+		{start: "1:60", end: "2:00", err: true},
+		{start: "1.5:00", end: "2:00", err: true},
+		{start: "-5", end: "10", err: true},
+		{start: "1e2", end: "200", err: true},
+		{start: "inf", end: "200", err: true},
+		{start: "1:2:3:4", end: "200", err: true},
+	}
+
+	for _, tt := range tests {
+		clip, err := ParseClip(tt.start, tt.end)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseClip(%q, %q): se esperaba un error", tt.start, tt.end)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseClip(%q, %q): error inesperado: %v", tt.start, tt.end, err)
+			continue
+		}
+		if (clip == nil) != (tt.clip == nil) || (clip != nil && *clip != *tt.clip) {
+			t.Errorf("ParseClip(%q, %q) = %+v, se esperaba %+v", tt.start, tt.end, clip, tt.clip)
+			continue
+		}
+		if clip != nil && clip.Key() != tt.key {
+			t.Errorf("Key() = %s, se esperaba %s", clip.Key(), tt.key)
+		}
+	}
+
+	if err := (Clip{Start: 10, End: 10}).Validate(0); err == nil {
+		t.Error("un fragmento vacío debería dar error")
+	}
+	if err := (Clip{Start: 10, End: 70}).Validate(60); err == nil {
+		t.Error("un fragmento que termina después del video debería dar error")
+	}
+	if err := (Clip{Start: 10, End: 70}).Validate(0); err != nil {
+		t.Errorf("sin duración conocida no se debería comprobar el final: %v", err)
+	}
+}
+
+func TestSelectSubtitles(t *testing.T) {
+	fake := NewFake()
+	info, err := fake.Probe(context.Background(), "abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Las manuales van primero y las automáticas llevan el sufijo -auto
+	ids := []string{}
+	for _, subtitle := range info.Subtitles {
+		ids = append(ids, subtitle.ID)
+	}
+	if strings.Join(ids, ",") != "en,es,en-auto" {
+		t.Errorf("subtítulos = %v", ids)
+	}
+
+	selected, err := SelectSubtitles(info.Subtitles, []string{"en-auto", "ES"})
+	if err != nil || len(selected) != 2 || !selected[0].Automatic || selected[1].Language != "es" {
+		t.Errorf("SelectSubtitles() = %+v, %v", selected, err)
+	}
+	if _, err := SelectSubtitles(info.Subtitles, []string{"fr"}); err == nil {
+		t.Error("se esperaba un error con unos subtítulos que no existen")
+	}
+
+	data, err := fake.FetchSubtitle(context.Background(), selected[0], "")
+	if err != nil || !strings.HasPrefix(string(data), "WEBVTT\n\n00:00:00.000 --> 00:00:05.000\nen-auto 1\n") {
+		t.Errorf("FetchSubtitle() = %q, %v", data, err)
+	}
+}
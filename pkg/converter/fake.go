@@ -0,0 +1,151 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/chapters"
+)
+
+// Fake es un backend en memoria que no accede a la red: devuelve formatos fijos y escribe archivos
+// deterministas, pensado para pruebas y para desarrollar sin yt-dlp ni ffmpeg
+type Fake struct {
+	Formats     []Format           // Formatos que devuelve ListFormats
+	Unavailable map[string]bool    // IDs de videos que se comportan como no disponibles
+	Duration    float64            // Duración que devuelve Probe
+	Chapters    []chapters.Chapter // Capítulos que devuelve Probe
+	Subtitles   []Subtitle         // Subtítulos que devuelve Probe
+	Playlists   map[string]int     // Número de videos de cada lista que devuelve ListPlaylist
+}
+
+// NewFake crea un backend fake con formatos H.264 en 360p, 720p y 1080p, 1080p60 en AV1, audio AAC y Opus
+// tres capítulos, subtítulos en inglés, español e inglés automáticos y cualquier lista con tres videos
+func NewFake() *Fake {
+	return &Fake{
+		Formats: []Format{
+			newFormat(Format{ID: "134", Width: 640, Height: 360, FPS: 30, VideoCodec: "avc1.4d401e", Container: "mp4", Bitrate: 300, FileSize: 2_000_000}),
+			newFormat(Format{ID: "136", Width: 1280, Height: 720, FPS: 30, VideoCodec: "avc1.4d401f", Container: "mp4", Bitrate: 1100, FileSize: 8_000_000}),
+			newFormat(Format{ID: "137", Width: 1920, Height: 1080, FPS: 30, VideoCodec: "avc1.640028", Container: "mp4", Bitrate: 2500, FileSize: 18_000_000}),
+			newFormat(Format{ID: "399", Width: 1920, Height: 1080, FPS: 60, VideoCodec: "av01.0.08M.08", Container: "mp4", Bitrate: 2200, FileSize: 16_000_000}),
+			newFormat(Format{ID: "140", AudioCodec: "mp4a.40.2", Container: "m4a", Bitrate: 130, FileSize: 1_000_000}),
+			newFormat(Format{ID: "251", AudioCodec: "opus", Container: "webm", Bitrate: 160, FileSize: 1_200_000}),
+		},
+		Unavailable: map[string]bool{},
+		Duration:    60,
+		Chapters: []chapters.Chapter{
+			{Title: "Intro", Start: 0, End: 15},
+			{Title: "Primera parte", Start: 15, End: 40},
+			{Title: "Final", Start: 40, End: 60},
+		},
+		Subtitles: []Subtitle{
+			NewSubtitle("en", "English", false, ""),
+			NewSubtitle("es", "Spanish", false, ""),
+			NewSubtitle("en", "English (auto-generated)", true, ""),
+		},
+	}
+}
+
+func (f *Fake) Name() string {
+	return BackendFake
+}
+
+func (f *Fake) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]Format, error) {
+	if f.Unavailable[videoID] {
+		return nil, fmt.Errorf("%w: %s", ErrVideoUnavailable, videoID)
+	}
+	return slices.Clone(f.Formats), ctx.Err()
+}
+
+func (f *Fake) Convert(ctx context.Context, req Request, onProgress func(models.Progress)) (string, error) {
+	if f.Unavailable[req.VideoID] {
+		return "", fmt.Errorf("%w: %s", ErrVideoUnavailable, req.VideoID)
+	}
+
+	// Los videos de otros sitios se identifican por su URL, el archivo se nombra con su última parte
+	base := path.Base(req.VideoID)
+	name := base + req.Audio.Extension()
+	if !req.IsAudio {
+		selector := req.Resolution
+		if req.FormatID != "" {
+			selector = req.FormatID
+		}
+		format, err := SelectFormat(f.Formats, selector)
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s-%s.mp4", base, format.Descriptor)
+	}
+
+	// Progreso simulado en dos pasos
+	for _, percent := range []float64{0, 100} {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if onProgress != nil {
+			onProgress(models.Progress{Phase: "download", Percent: &percent})
+		}
+	}
+
+	// El contenido solo depende de la petición, así las pruebas pueden comprobarlo
+	output := filepath.Join(req.OutputDir, name)
+	content := fmt.Sprintf("fake:%s:%s:audio=%t", req.VideoID, req.Resolution, req.IsAudio)
+	if req.Clip != nil {
+		content += ":clip=" + req.Clip.Key()
+	}
+	content += "\n"
+	if err := os.WriteFile(output, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("error al escribir el archivo: %v", err)
+	}
+	return output, nil
+}
+
+func (f *Fake) Probe(ctx context.Context, videoID string, cookiesPath string) (*Info, error) {
+	if f.Unavailable[videoID] {
+		return nil, fmt.Errorf("%w: %s", ErrVideoUnavailable, videoID)
+	}
+	return &Info{
+		ID:        videoID,
+		Title:     "Fake video " + videoID,
+		Duration:  f.Duration,
+		Channel:   "Fake channel",
+		Chapters:  slices.Clone(f.Chapters),
+		Subtitles: slices.Clone(f.Subtitles),
+	}, ctx.Err()
+}
+
+// FetchSubtitle genera un WebVTT con un subtítulo cada 20 segundos que incluye el ID de la pista
+func (f *Fake) FetchSubtitle(ctx context.Context, subtitle Subtitle, cookiesPath string) ([]byte, error) {
+	if !slices.Contains(f.Subtitles, subtitle) {
+		return nil, fmt.Errorf("los subtítulos %s no están disponibles", subtitle.ID)
+	}
+	content := "WEBVTT\n\n"
+	for i := 0; float64(i*20) < f.Duration; i++ {
+		content += fmt.Sprintf("00:%02d:%02d.000 --> 00:%02d:%02d.000\n%s %d\n\n", i*20/60, i*20%60, (i*20+5)/60, (i*20+5)%60, subtitle.ID, i+1)
+	}
+	return []byte(content), ctx.Err()
+}
+
+// ListPlaylist devuelve una lista de videos (tres si no está en Playlists) con los primeros caracteres del ID
+// de la lista y la posición como ID, las listas cuyo ID está en Unavailable no existen
+func (f *Fake) ListPlaylist(ctx context.Context, playlistID string, cookiesPath string) (*Playlist, error) {
+	if f.Unavailable[playlistID] {
+		return nil, fmt.Errorf("%w: %s", ErrPlaylistUnavailable, playlistID)
+	}
+	count, ok := f.Playlists[playlistID]
+	if !ok {
+		count = 3
+	}
+
+	playlist := &Playlist{ID: playlistID, Title: "Fake playlist " + playlistID, Channel: "Fake channel"}
+	for i := 1; i <= count; i++ {
+		// Los IDs de video tienen 11 caracteres
+		id := fmt.Sprintf("%.7s-%03d", strings.TrimPrefix(playlistID, "PL")+"_______", i)
+		playlist.Entries = append(playlist.Entries, PlaylistEntry{ID: id, Title: fmt.Sprintf("Fake video %d", i), Duration: f.Duration, Channel: "Fake channel"})
+	}
+	return playlist, ctx.Err()
+}
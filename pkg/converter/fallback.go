@@ -0,0 +1,68 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"yt-converter-api/models"
+)
+
+// Fallback usa Primary y, si falla, repite la operación con Secondary. Los errores definitivos (video o lista
+// no disponible o cancelación) no se reintentan porque el otro backend obtendría el mismo resultado
+type Fallback struct {
+	Primary   Converter
+	Secondary Converter
+}
+
+func (f *Fallback) Name() string {
+	return f.Primary.Name()
+}
+
+func (f *Fallback) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]Format, error) {
+	formats, err := f.Primary.ListFormats(ctx, videoID, cookiesPath)
+	if !f.shouldFallback(ctx, "ListFormats", err) {
+		return formats, err
+	}
+	return f.Secondary.ListFormats(ctx, videoID, cookiesPath)
+}
+
+func (f *Fallback) Convert(ctx context.Context, req Request, onProgress func(models.Progress)) (string, error) {
+	path, err := f.Primary.Convert(ctx, req, onProgress)
+	if !f.shouldFallback(ctx, "Convert", err) {
+		return path, err
+	}
+	return f.Secondary.Convert(ctx, req, onProgress)
+}
+
+func (f *Fallback) Probe(ctx context.Context, videoID string, cookiesPath string) (*Info, error) {
+	info, err := f.Primary.Probe(ctx, videoID, cookiesPath)
+	if !f.shouldFallback(ctx, "Probe", err) {
+		return info, err
+	}
+	return f.Secondary.Probe(ctx, videoID, cookiesPath)
+}
+
+func (f *Fallback) FetchSubtitle(ctx context.Context, subtitle Subtitle, cookiesPath string) ([]byte, error) {
+	data, err := f.Primary.FetchSubtitle(ctx, subtitle, cookiesPath)
+	if !f.shouldFallback(ctx, "FetchSubtitle", err) {
+		return data, err
+	}
+	return f.Secondary.FetchSubtitle(ctx, subtitle, cookiesPath)
+}
+
+func (f *Fallback) ListPlaylist(ctx context.Context, playlistID string, cookiesPath string) (*Playlist, error) {
+	playlist, err := f.Primary.ListPlaylist(ctx, playlistID, cookiesPath)
+	if !f.shouldFallback(ctx, "ListPlaylist", err) {
+		return playlist, err
+	}
+	return f.Secondary.ListPlaylist(ctx, playlistID, cookiesPath)
+}
+
+// shouldFallback indica si hay que repetir la operación con el backend de respaldo
+func (f *Fallback) shouldFallback(ctx context.Context, operation string, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrVideoUnavailable) || errors.Is(err, ErrPlaylistUnavailable) {
+		return false
+	}
+	fmt.Printf("%s con el backend %s falló, usando %s: %v\n", operation, f.Primary.Name(), f.Secondary.Name(), err)
+	return true
+}
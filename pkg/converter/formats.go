@@ -0,0 +1,154 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tipos de formato
+const (
+	FormatVideo = "video"
+	FormatAudio = "audio"
+)
+
+// Format describe un stream disponible de un video
+type Format struct {
+	ID         string  `json:"id"`                    // ID del formato en yt-dlp (itag)
+	Type       string  `json:"type"`                  // video o audio
+	Descriptor string  `json:"descriptor"`            // Por ejemplo 1080p60-av1, se puede usar en POST /process
+	Resolution string  `json:"resolution,omitempty"`  // Por ejemplo 1080p
+	Width      int     `json:"width,omitempty"`       // Píxeles
+	Height     int     `json:"height,omitempty"`      // Píxeles
+	FPS        float64 `json:"fps,omitempty"`         // Fotogramas por segundo
+	VideoCodec string  `json:"video_codec,omitempty"` // h264, vp9, av1...
+	AudioCodec string  `json:"audio_codec,omitempty"` // aac, opus... vacío si el stream no trae audio
+	HDR        bool    `json:"hdr"`
+	Container  string  `json:"container"`          // mp4, webm...
+	Bitrate    float64 `json:"bitrate,omitempty"`  // kbps
+	FileSize   int64   `json:"filesize,omitempty"` // Bytes, puede ser una estimación
+}
+
+// newFormat completa los campos derivados (tipo, resolución y descriptor) y normaliza los códecs
+func newFormat(format Format) Format {
+	format.VideoCodec = normalizeCodec(format.VideoCodec)
+	format.AudioCodec = normalizeCodec(format.AudioCodec)
+	format.Type = FormatAudio
+	if format.VideoCodec != "" || format.Height > 0 {
+		format.Type = FormatVideo
+		format.Resolution = fmt.Sprintf("%dp", format.Height)
+	}
+	format.Descriptor = format.describe()
+	return format
+}
+
+// describe genera el descriptor del formato: <altura>p<fps>-<códec>[-hdr] para video y audio-<códec>-<kbps>k para audio
+func (f Format) describe() string {
+	if f.Type == FormatAudio {
+		return fmt.Sprintf("audio-%s-%dk", f.AudioCodec, int(math.Round(f.Bitrate)))
+	}
+	descriptor := fmt.Sprintf("%dp%d-%s", f.Height, int(math.Round(f.FPS)), f.VideoCodec)
+	if f.HDR {
+		descriptor += "-hdr"
+	}
+	return descriptor
+}
+
+// normalizeCodec convierte los nombres de códec de YouTube (avc1.64001F, vp09.00..., av01..., mp4a.40.2) a nombres cortos
+func normalizeCodec(codec string) string {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+	switch {
+	case codec == "" || codec == "none":
+		return ""
+	case strings.HasPrefix(codec, "avc"), codec == "h264":
+		return "h264"
+	case strings.HasPrefix(codec, "vp09"), strings.HasPrefix(codec, "vp9"):
+		return "vp9"
+	case strings.HasPrefix(codec, "av01"), codec == "av1":
+		return "av1"
+	case strings.HasPrefix(codec, "hev"), strings.HasPrefix(codec, "hvc"), codec == "h265":
+		return "h265"
+	case strings.HasPrefix(codec, "mp4a"), codec == "aac":
+		return "aac"
+	}
+	codec, _, _ = strings.Cut(codec, ".")
+	return codec
+}
+
+// Resolutions devuelve las resoluciones de video distintas ordenadas de menor a mayor
+func Resolutions(formats []Format) []string {
+	heights := []int{}
+	for _, format := range formats {
+		if format.Type == FormatVideo && format.Height > 0 && !slices.Contains(heights, format.Height) {
+			heights = append(heights, format.Height)
+		}
+	}
+	slices.Sort(heights)
+
+	resolutions := make([]string, len(heights))
+	for i, height := range heights {
+		resolutions[i] = fmt.Sprintf("%dp", height)
+	}
+	return resolutions
+}
+
+// Formato de los descriptores que acepta SelectFormat: 1080p, 1080p60, 1080p60-av1, 1080p-h264-hdr...
+var descriptorRegex = regexp.MustCompile(`^(\d+)p(\d+)?(?:-([a-z0-9]+))?(-hdr)?$`)
+
+// SelectFormat busca el formato de video que corresponde al selector, que puede ser un ID de yt-dlp o un
+// descriptor. Si varios formatos encajan con el descriptor se elige el de más fps, después H.264 por
+// compatibilidad y por último el de mayor bitrate
+func SelectFormat(formats []Format, selector string) (*Format, error) {
+	selector = strings.ToLower(strings.TrimSpace(selector))
+
+	matches := descriptorRegex.FindStringSubmatch(selector)
+	if matches == nil {
+		for i := range formats {
+			if strings.ToLower(formats[i].ID) == selector {
+				if formats[i].Type != FormatVideo {
+					return nil, fmt.Errorf("el formato %s no es de video", selector)
+				}
+				return &formats[i], nil
+			}
+		}
+		return nil, fmt.Errorf("%w: formato %s", ErrResolutionUnavailable, selector)
+	}
+
+	height, _ := strconv.Atoi(matches[1])
+	fps, _ := strconv.Atoi(matches[2])
+	codec, hdr := normalizeCodec(matches[3]), matches[4] != ""
+
+	var best *Format
+	for i := range formats {
+		format := &formats[i]
+		if format.Type != FormatVideo || format.Height != height || format.HDR != hdr {
+			continue
+		}
+		if fps > 0 && int(math.Round(format.FPS)) != fps {
+			continue
+		}
+		if codec != "" && format.VideoCodec != codec {
+			continue
+		}
+		if best == nil || betterMatch(format, best) {
+			best = format
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: %s", ErrResolutionUnavailable, selector)
+	}
+	return best, nil
+}
+
+func betterMatch(a, b *Format) bool {
+	if a.FPS != b.FPS {
+		return a.FPS > b.FPS
+	}
+	if aH264, bH264 := a.VideoCodec == "h264", b.VideoCodec == "h264"; aH264 != bH264 {
+		return aH264
+	}
+	return a.Bitrate > b.Bitrate
+}
@@ -0,0 +1,509 @@
+package converter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/chapters"
+	"yt-converter-api/pkg/ffmpeg"
+	"yt-converter-api/pkg/sources"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// Cada cuánto se informa como mucho del progreso de la descarga
+const nativeProgressInterval = 250 * time.Millisecond
+
+// Native descarga los streams directamente desde Go con kkdai/youtube y usa ffmpeg para unir audio y
+// video o codificar el MP3, no necesita Python ni yt-dlp
+type Native struct {
+	FFmpegPath  string
+	CookiesPath string // cookies.txt subido con POST /cookies, se usa cuando la petición no trae uno propio
+	client      *youtube.Client
+}
+
+// NewNative crea el backend nativo usando el binario de ffmpeg y el archivo de cookies global indicados
+func NewNative(ffmpegPath string, cookiesPath string) *Native {
+	return &Native{FFmpegPath: ffmpegPath, CookiesPath: cookiesPath, client: &youtube.Client{}}
+}
+
+func (n *Native) Name() string {
+	return BackendNative
+}
+
+func (n *Native) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]Format, error) {
+	client, err := n.clientFor(cookiesPath)
+	if err != nil {
+		return nil, err
+	}
+	video, err := getVideo(ctx, client, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := []Format{}
+	for _, format := range video.Formats {
+		if strings.HasPrefix(format.MimeType, "video/") || strings.HasPrefix(format.MimeType, "audio/") {
+			formats = append(formats, nativeFormat(format))
+		}
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no se encontraron formatos disponibles")
+	}
+	return formats, nil
+}
+
+// nativeFormat convierte un formato de kkdai/youtube, los códecs vienen en el tipo MIME: video/mp4; codecs="avc1.42001E, mp4a.40.2"
+func nativeFormat(format youtube.Format) Format {
+	mediaType, params, _ := strings.Cut(format.MimeType, ";")
+	_, codecs, _ := strings.Cut(params, "codecs=")
+	codecList := strings.Split(strings.Trim(strings.TrimSpace(codecs), `"`), ",")
+
+	result := Format{
+		ID:        strconv.Itoa(format.ItagNo),
+		Width:     format.Width,
+		Height:    format.Height,
+		FPS:       float64(format.FPS),
+		HDR:       strings.Contains(format.QualityLabel, "HDR"),
+		Container: extension(mediaType),
+		Bitrate:   float64(format.Bitrate) / 1000,
+		FileSize:  format.ContentLength,
+	}
+	if strings.HasPrefix(mediaType, "audio/") {
+		result.AudioCodec = codecList[0]
+	} else {
+		result.VideoCodec = codecList[0]
+		if len(codecList) > 1 {
+			result.AudioCodec = codecList[1]
+		}
+	}
+	return newFormat(result)
+}
+
+func (n *Native) Convert(ctx context.Context, req Request, onProgress func(models.Progress)) (string, error) {
+	client, err := n.clientFor(req.CookiesPath)
+	if err != nil {
+		return "", err
+	}
+	video, err := getVideo(ctx, client, req.VideoID)
+	if err != nil {
+		return "", err
+	}
+
+	if req.IsAudio {
+		return n.convertAudio(ctx, client, video, req, onProgress)
+	}
+	return n.convertVideo(ctx, client, video, req, onProgress)
+}
+
+func (n *Native) Probe(ctx context.Context, videoID string, cookiesPath string) (*Info, error) {
+	client, err := n.clientFor(cookiesPath)
+	if err != nil {
+		return nil, err
+	}
+	video, err := getVideo(ctx, client, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		ID:       video.ID,
+		Title:    video.Title,
+		Duration: video.Duration.Seconds(),
+		Channel:  video.Author,
+		IsLive:   video.HLSManifestURL != "",
+		// La librería no expone los capítulos, se leen de la descripción como hace YouTube
+		Chapters:  chapters.FromDescription(video.Description, video.Duration.Seconds()),
+		Subtitles: captionTracks(video),
+	}, nil
+}
+
+func (n *Native) FetchSubtitle(ctx context.Context, subtitle Subtitle, cookiesPath string) ([]byte, error) {
+	client, err := n.clientFor(cookiesPath)
+	if err != nil {
+		return nil, err
+	}
+	return fetchSubtitle(ctx, client.HTTPClient, subtitle)
+}
+
+func (n *Native) ListPlaylist(ctx context.Context, playlistID string, cookiesPath string) (*Playlist, error) {
+	client, err := n.clientFor(cookiesPath)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.GetPlaylistContext(ctx, playlistID)
+	if err != nil {
+		var status youtube.ErrPlaylistStatus
+		if errors.As(err, &status) || errors.Is(err, youtube.ErrInvalidPlaylist) {
+			return nil, fmt.Errorf("%w: %v", ErrPlaylistUnavailable, err)
+		}
+		return nil, fmt.Errorf("error al obtener la lista de reproducción: %w", err)
+	}
+
+	playlist := &Playlist{ID: list.ID, Title: list.Title, Channel: list.Author}
+	for _, video := range list.Videos {
+		playlist.Entries = append(playlist.Entries, PlaylistEntry{
+			ID:       video.ID,
+			Title:    video.Title,
+			Duration: video.Duration.Seconds(),
+			Channel:  video.Author,
+		})
+	}
+	playlist.Entries = availableEntries(playlist.Entries)
+	return playlist, nil
+}
+
+// captionTracks traduce las pistas de subtítulos del video, las de tipo asr son las automáticas
+func captionTracks(video *youtube.Video) []Subtitle {
+	var subtitles []Subtitle
+	for _, track := range video.CaptionTracks {
+		subtitles = append(subtitles, NewSubtitle(track.LanguageCode, track.Name.SimpleText, track.Kind == "asr", track.BaseURL+"&fmt=vtt"))
+	}
+	SortSubtitles(subtitles)
+	return subtitles
+}
+
+// convertAudio descarga el mejor stream de audio y lo codifica al formato pedido
+func (n *Native) convertAudio(ctx context.Context, client *youtube.Client, video *youtube.Video, req Request, onProgress func(models.Progress)) (string, error) {
+	audio := bestAudio(video.Formats)
+	if audio == nil {
+		return "", fmt.Errorf("el video no tiene ningún stream de audio")
+	}
+
+	audioPath := filepath.Join(req.OutputDir, fmt.Sprintf("%s.audio.%s", video.ID, extension(audio.MimeType)))
+	defer os.Remove(audioPath)
+	progress := newDownloadProgress(audio.ContentLength, onProgress)
+	if err := download(ctx, client, video, audio, audioPath, progress); err != nil {
+		return "", err
+	}
+
+	// Solo se puede copiar sin recodificar si el original ya es AAC
+	codecArgs := req.Audio.FFmpegArgs()
+	if req.Audio.Passthrough() && !strings.HasPrefix(audio.MimeType, "audio/mp4") {
+		codecArgs = []string{"-vn", "-c:a", "aac"}
+	}
+
+	outputPath := filepath.Join(req.OutputDir, video.ID+req.Audio.Extension())
+	args := append(clipInput(req.Clip, audioPath), codecArgs...)
+	args = append(args, outputPath)
+	if err := n.ffmpeg(ctx, args, clipDuration(req.Clip, video.Duration), "transcode", onProgress); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// convertVideo descarga el stream de video con la resolución pedida y el mejor audio y los une en un MP4
+func (n *Native) convertVideo(ctx context.Context, client *youtube.Client, video *youtube.Video, req Request, onProgress func(models.Progress)) (string, error) {
+	var videoFormat *youtube.Format
+	if req.FormatID != "" {
+		itag, _ := strconv.Atoi(req.FormatID)
+		if formats := video.Formats.Itag(itag); len(formats) > 0 {
+			videoFormat = &formats[0]
+		}
+	} else if height, err := strconv.Atoi(strings.TrimSuffix(req.Resolution, "p")); err == nil {
+		videoFormat = bestVideo(video.Formats, height)
+	}
+	if videoFormat == nil || !strings.HasPrefix(videoFormat.MimeType, "video/") {
+		return "", fmt.Errorf("%w: %s%s", ErrResolutionUnavailable, req.Resolution, req.FormatID)
+	}
+	outputPath := filepath.Join(req.OutputDir, fmt.Sprintf("%s-%dx%d.mp4", video.ID, videoFormat.Width, videoFormat.Height))
+
+	// Los formatos progresivos ya traen el audio, solo hace falta copiarlos a MP4
+	if videoFormat.AudioChannels > 0 {
+		videoPath := filepath.Join(req.OutputDir, fmt.Sprintf("%s.video.%s", video.ID, extension(videoFormat.MimeType)))
+		defer os.Remove(videoPath)
+		if err := download(ctx, client, video, videoFormat, videoPath, newDownloadProgress(videoFormat.ContentLength, onProgress)); err != nil {
+			return "", err
+		}
+		args := append(clipInput(req.Clip, videoPath), "-c", "copy", "-movflags", "+faststart", outputPath)
+		if err := n.ffmpeg(ctx, args, clipDuration(req.Clip, video.Duration), "merge", onProgress); err != nil {
+			os.Remove(outputPath)
+			return "", err
+		}
+		return outputPath, nil
+	}
+
+	audio := bestAudio(video.Formats)
+	if audio == nil {
+		return "", fmt.Errorf("el video no tiene ningún stream de audio")
+	}
+
+	videoPath := filepath.Join(req.OutputDir, fmt.Sprintf("%s.video.%s", video.ID, extension(videoFormat.MimeType)))
+	audioPath := filepath.Join(req.OutputDir, fmt.Sprintf("%s.audio.%s", video.ID, extension(audio.MimeType)))
+	defer os.Remove(videoPath)
+	defer os.Remove(audioPath)
+
+	// El progreso de la descarga cuenta los dos streams como uno solo
+	progress := newDownloadProgress(videoFormat.ContentLength+audio.ContentLength, onProgress)
+	if err := download(ctx, client, video, videoFormat, videoPath, progress); err != nil {
+		return "", err
+	}
+	if err := download(ctx, client, video, audio, audioPath, progress); err != nil {
+		return "", err
+	}
+
+	// El audio de YouTube en MP4 (AAC) se copia, el de WebM (Opus) se recodifica para que el MP4 sea compatible
+	audioCodec := "copy"
+	if !strings.HasPrefix(audio.MimeType, "audio/mp4") {
+		audioCodec = "aac"
+	}
+	args := append(clipInput(req.Clip, videoPath), clipInput(req.Clip, audioPath)...)
+	args = append(args, "-map", "0:v:0", "-map", "1:a:0", "-c:v", "copy", "-c:a", audioCodec, "-movflags", "+faststart", outputPath)
+	if err := n.ffmpeg(ctx, args, clipDuration(req.Clip, video.Duration), "merge", onProgress); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// clipInput devuelve los argumentos de una entrada de ffmpeg, limitada al fragmento si se ha pedido uno.
+// Los streams se descargan completos y se recortan al unirlos o codificarlos
+func clipInput(clip *Clip, path string) []string {
+	if clip == nil {
+		return []string{"-i", path}
+	}
+	return append(clip.InputArgs(), "-i", path)
+}
+
+// clipDuration devuelve la duración del resultado para calcular el progreso de ffmpeg
+func clipDuration(clip *Clip, duration time.Duration) time.Duration {
+	if clip == nil {
+		return duration
+	}
+	return time.Duration(clip.Duration() * float64(time.Second))
+}
+
+// ffmpeg ejecuta ffmpeg informando del progreso en la fase indicada
+func (n *Native) ffmpeg(ctx context.Context, args []string, duration time.Duration, phase string, onProgress func(models.Progress)) error {
+	report := func(percent float64) {
+		if onProgress != nil {
+			onProgress(models.Progress{Phase: phase, Percent: &percent})
+		}
+	}
+	report(0)
+	return ffmpeg.Run(ctx, n.FFmpegPath, args, duration, report)
+}
+
+// getVideo obtiene el manifiesto del video y traduce los errores de YouTube a los errores comunes. Solo admite
+// videos de YouTube, los de otros sitios devuelven ErrSourceUnsupported para que los descargue yt-dlp
+func getVideo(ctx context.Context, client *youtube.Client, videoID string) (*youtube.Video, error) {
+	if sources.IsURLRef(videoID) {
+		return nil, fmt.Errorf("%w: %s", ErrSourceUnsupported, videoID)
+	}
+	video, err := client.GetVideoContext(ctx, videoID)
+	if err == nil {
+		return video, nil
+	}
+
+	var playability *youtube.ErrPlayabiltyStatus
+	if errors.Is(err, youtube.ErrVideoPrivate) || (errors.As(err, &playability) && playability.Status != "LIVE_STREAM_OFFLINE") {
+		return nil, fmt.Errorf("%w: %v", ErrVideoUnavailable, err)
+	}
+	return nil, fmt.Errorf("error al obtener el video: %w", err)
+}
+
+// clientFor devuelve el cliente compartido o uno nuevo con las cookies del archivo indicado
+func (n *Native) clientFor(cookiesPath string) (*youtube.Client, error) {
+	// Como en el backend de Python, si no se indica ninguno se usa el archivo global si existe
+	if cookiesPath == "" {
+		if _, err := os.Stat(n.CookiesPath); err != nil {
+			return n.client, nil
+		}
+		cookiesPath = n.CookiesPath
+	}
+
+	jar, err := loadCookies(cookiesPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el archivo de cookies: %v", err)
+	}
+	return &youtube.Client{HTTPClient: &http.Client{Jar: jar}}, nil
+}
+
+// bestAudio devuelve el stream de solo audio con mayor bitrate, dando preferencia a AAC (audio/mp4)
+func bestAudio(formats youtube.FormatList) *youtube.Format {
+	var best *youtube.Format
+	for i := range formats {
+		format := &formats[i]
+		if !strings.HasPrefix(format.MimeType, "audio/") || format.AudioChannels == 0 {
+			continue
+		}
+		if best == nil || betterFormat(format, best, "audio/mp4") {
+			best = format
+		}
+	}
+	return best
+}
+
+// bestVideo devuelve el stream de video con la altura indicada, dando preferencia a los streams de solo
+// video en H.264 (video/mp4) y con mayor bitrate
+func bestVideo(formats youtube.FormatList, height int) *youtube.Format {
+	var best *youtube.Format
+	for i := range formats {
+		format := &formats[i]
+		if !strings.HasPrefix(format.MimeType, "video/") || format.Height != height {
+			continue
+		}
+		if best == nil || betterVideo(format, best) {
+			best = format
+		}
+	}
+	return best
+}
+
+// betterVideo indica si a es mejor que b, los streams de solo video son mejores que los progresivos
+func betterVideo(a, b *youtube.Format) bool {
+	aVideoOnly, bVideoOnly := a.AudioChannels == 0, b.AudioChannels == 0
+	if aVideoOnly != bVideoOnly {
+		return aVideoOnly
+	}
+	return betterFormat(a, b, "video/mp4")
+}
+
+// betterFormat indica si a es mejor que b prefiriendo el tipo MIME indicado y después el mayor bitrate
+func betterFormat(a, b *youtube.Format, preferredMime string) bool {
+	aPreferred, bPreferred := strings.HasPrefix(a.MimeType, preferredMime), strings.HasPrefix(b.MimeType, preferredMime)
+	if aPreferred != bPreferred {
+		return aPreferred
+	}
+	return a.Bitrate > b.Bitrate
+}
+
+// extension devuelve la extensión de archivo para un tipo MIME de YouTube, por ejemplo "audio/mp4; codecs=..." -> m4a
+func extension(mimeType string) string {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	switch mediaType {
+	case "audio/mp4":
+		return "m4a"
+	case "audio/webm", "video/webm":
+		return "webm"
+	}
+	return "mp4"
+}
+
+// download guarda un stream en path informando del progreso
+func download(ctx context.Context, client *youtube.Client, video *youtube.Video, format *youtube.Format, path string, progress *downloadProgress) error {
+	stream, size, err := client.GetStreamContext(ctx, video, format)
+	if err != nil {
+		return fmt.Errorf("error al obtener el stream: %w", err)
+	}
+	defer stream.Close()
+	if format.ContentLength == 0 && size > 0 {
+		progress.total += size
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error al crear el archivo: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, io.TeeReader(stream, progress)); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error al descargar el stream: %w", err)
+	}
+	progress.finish()
+	return nil
+}
+
+// downloadProgress cuenta los bytes descargados y los informa como progreso de la fase download
+type downloadProgress struct {
+	total      int64
+	downloaded int64
+	started    time.Time
+	lastReport time.Time
+	onProgress func(models.Progress)
+}
+
+func newDownloadProgress(total int64, onProgress func(models.Progress)) *downloadProgress {
+	return &downloadProgress{total: total, started: time.Now(), onProgress: onProgress}
+}
+
+func (p *downloadProgress) Write(data []byte) (int, error) {
+	p.downloaded += int64(len(data))
+	if time.Since(p.lastReport) >= nativeProgressInterval {
+		p.report()
+	}
+	return len(data), nil
+}
+
+// finish informa del progreso al terminar un stream aunque no haya pasado el intervalo
+func (p *downloadProgress) finish() {
+	p.report()
+}
+
+func (p *downloadProgress) report() {
+	p.lastReport = time.Now()
+	if p.onProgress == nil {
+		return
+	}
+
+	downloaded := p.downloaded
+	progress := models.Progress{Phase: "download", DownloadedBytes: &downloaded}
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 {
+		speed := float64(downloaded) / elapsed
+		progress.Speed = &speed
+		if p.total > downloaded && speed > 0 {
+			eta := int64(float64(p.total-downloaded) / speed)
+			progress.ETA = &eta
+		}
+	}
+	if p.total > 0 {
+		total := p.total
+		percent := min(float64(downloaded)*100/float64(total), 100)
+		progress.TotalBytes = &total
+		progress.Percent = &percent
+	}
+	p.onProgress(progress)
+}
+
+// loadCookies lee un archivo cookies.txt con formato Netscape, el mismo que usa yt-dlp
+func loadCookies(path string) (*cookiejar.Jar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	jar, _ := cookiejar.New(nil)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Las cookies HttpOnly se escriben comentadas con este prefijo
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		domain := strings.TrimPrefix(fields[0], ".")
+		cookie := &http.Cookie{
+			Name:   fields[5],
+			Value:  fields[6],
+			Path:   fields[2],
+			Domain: fields[0],
+			Secure: strings.EqualFold(fields[3], "TRUE"),
+		}
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		jar.SetCookies(&url.URL{Scheme: "https", Host: domain, Path: "/"}, []*http.Cookie{cookie})
+	}
+	return jar, scanner.Err()
+}
@@ -0,0 +1,37 @@
+package converter
+
+import "slices"
+
+// Playlist es una lista de reproducción con sus videos en el orden de la lista
+type Playlist struct {
+	ID      string          `json:"id"`
+	Title   string          `json:"title"`
+	Channel string          `json:"channel"`
+	Entries []PlaylistEntry `json:"entries"`
+}
+
+// PlaylistEntry es un video de una lista con la información que incluye el propio listado
+type PlaylistEntry struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Duration float64 `json:"duration"` // Segundos, 0 si el listado no la incluye
+	Channel  string  `json:"channel"`
+}
+
+// Títulos con los que YouTube muestra en las listas los videos que ya no se pueden ver
+var unavailableEntryTitles = []string{"[Private video]", "[Deleted video]", "[Video privado]", "[Video eliminado]"}
+
+// availableEntries quita de la lista los videos privados o borrados y los repetidos, que no se pueden
+// procesar o ya están en otra posición
+func availableEntries(entries []PlaylistEntry) []PlaylistEntry {
+	seen := map[string]bool{}
+	result := make([]PlaylistEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ID == "" || seen[entry.ID] || slices.Contains(unavailableEntryTitles, entry.Title) {
+			continue
+		}
+		seen[entry.ID] = true
+		result = append(result, entry)
+	}
+	return result
+}
@@ -0,0 +1,198 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/chapters"
+	"yt-converter-api/pkg/protocol"
+)
+
+// Intérprete con el que se ejecuta pyConverter/main.py
+const pythonInterpreter = "/usr/bin/python3"
+
+// Python ejecuta pyConverter/main.py (yt-dlp) como subproceso usando el protocolo JSON-lines
+type Python struct {
+	ScriptPath string
+}
+
+// NewPython crea el backend que ejecuta el script indicado
+func NewPython(scriptPath string) *Python {
+	return &Python{ScriptPath: scriptPath}
+}
+
+func (p *Python) Name() string {
+	return BackendPython
+}
+
+func (p *Python) ListFormats(ctx context.Context, videoID string, cookiesPath string) ([]Format, error) {
+	// El script exige una carpeta de salida aunque en este modo no escribe nada
+	result, err := p.run(ctx, []string{videoID, "video", os.TempDir()}, cookiesPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error al ejecutar el script de Python, comprueba la dirección URL del video u otros factores: %w", err)
+	}
+
+	if len(result.Formats) == 0 {
+		return nil, fmt.Errorf("no se encontraron formatos disponibles")
+	}
+
+	formats := make([]Format, 0, len(result.Formats))
+	for _, f := range result.Formats {
+		formats = append(formats, newFormat(Format{
+			ID:         f.FormatID,
+			Width:      f.Width,
+			Height:     f.Height,
+			FPS:        f.FPS,
+			VideoCodec: f.VCodec,
+			AudioCodec: f.ACodec,
+			HDR:        f.DynamicRange != "" && f.DynamicRange != "SDR",
+			Container:  f.Ext,
+			Bitrate:    f.TBR,
+			FileSize:   f.FileSize,
+		}))
+	}
+	return formats, nil
+}
+
+func (p *Python) Convert(ctx context.Context, req Request, onProgress func(models.Progress)) (string, error) {
+	args := []string{req.VideoID}
+	if req.IsAudio {
+		args = append(args, "audio", req.OutputDir)
+		args = append(args, audioArgs(req.Audio)...)
+	} else {
+		args = append(args, "video", req.OutputDir)
+		if req.FormatID != "" {
+			args = append(args, "--format-id", req.FormatID)
+		} else {
+			args = append(args, "--resolution", req.Resolution)
+		}
+	}
+
+	// yt-dlp solo descarga el fragmento pedido
+	if req.Clip != nil {
+		args = append(args, "--start", formatSeconds(req.Clip.Start), "--end", formatSeconds(req.Clip.End))
+	}
+
+	result, err := p.run(ctx, args, req.CookiesPath, onProgress)
+	if err != nil {
+		return "", fmt.Errorf("error al ejecutar el comando: %w", err)
+	}
+	if result.Path == "" {
+		return "", fmt.Errorf("el script no devolvió la ruta del archivo procesado")
+	}
+	return result.Path, nil
+}
+
+func (p *Python) Probe(ctx context.Context, videoID string, cookiesPath string) (*Info, error) {
+	result, err := p.run(ctx, []string{videoID, "info", os.TempDir()}, cookiesPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la información del video: %w", err)
+	}
+	if result.Info == nil {
+		return nil, fmt.Errorf("el script no devolvió la información del video")
+	}
+
+	info := &Info{
+		ID:       result.Info.ID,
+		Title:    result.Info.Title,
+		Duration: result.Info.Duration,
+		Channel:  result.Info.Channel,
+		IsLive:   result.Info.IsLive,
+	}
+	for _, chapter := range result.Info.Chapters {
+		info.Chapters = append(info.Chapters, chapters.Chapter{Title: chapter.Title, Start: chapter.StartTime, End: chapter.EndTime})
+	}
+	for _, subtitle := range result.Info.Subtitles {
+		info.Subtitles = append(info.Subtitles, NewSubtitle(subtitle.Language, subtitle.Name, subtitle.Automatic, subtitle.URL))
+	}
+	SortSubtitles(info.Subtitles)
+	return info, nil
+}
+
+func (p *Python) ListPlaylist(ctx context.Context, playlistID string, cookiesPath string) (*Playlist, error) {
+	result, err := p.run(ctx, []string{playlistID, "playlist", os.TempDir()}, cookiesPath, nil)
+	if errors.Is(err, ErrVideoUnavailable) {
+		return nil, fmt.Errorf("%w: %s", ErrPlaylistUnavailable, playlistID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener la lista de reproducción: %w", err)
+	}
+	if result.Playlist == nil {
+		return nil, fmt.Errorf("el script no devolvió la lista de reproducción")
+	}
+
+	playlist := &Playlist{ID: result.Playlist.ID, Title: result.Playlist.Title, Channel: result.Playlist.Channel}
+	for _, entry := range result.Playlist.Entries {
+		playlist.Entries = append(playlist.Entries, PlaylistEntry(entry))
+	}
+	playlist.Entries = availableEntries(playlist.Entries)
+	return playlist, nil
+}
+
+// FetchSubtitle descarga la dirección que devolvió yt-dlp, ya incluye la firma y no necesita las cookies
+func (p *Python) FetchSubtitle(ctx context.Context, subtitle Subtitle, cookiesPath string) ([]byte, error) {
+	return fetchSubtitle(ctx, http.DefaultClient, subtitle)
+}
+
+// audioArgs traduce las opciones de audio a los argumentos del script, el MP3 por defecto no necesita ninguno
+func audioArgs(options AudioOptions) []string {
+	options = options.normalized()
+	args := []string{}
+	if options.Format != AudioMP3 {
+		args = append(args, "--audio-format", options.Format)
+	}
+	if options.Bitrate != 0 {
+		args = append(args, "--audio-bitrate", strconv.Itoa(options.Bitrate))
+	}
+	if options.Quality != nil {
+		args = append(args, "--audio-quality", strconv.Itoa(*options.Quality))
+	}
+	if options.SampleRate != 0 {
+		args = append(args, "--sample-rate", strconv.Itoa(options.SampleRate))
+	}
+	return args
+}
+
+// run ejecuta el script con el protocolo JSON, si se cancela el contexto se mata el proceso y todos sus hijos (ffmpeg)
+func (p *Python) run(ctx context.Context, args []string, cookiesPath string, onProgress func(models.Progress)) (*protocol.Result, error) {
+	args = append([]string{p.ScriptPath}, args...)
+	if cookiesPath != "" {
+		args = append(args, "--cookies", cookiesPath)
+		fmt.Println("Usando archivo de cookies en:", cookiesPath)
+	}
+
+	// Mostrar comando por consola
+	fmt.Println("Ejecutando comando:", pythonInterpreter, strings.Join(args, " "))
+
+	args = append(args, "--json")
+	cmd := exec.CommandContext(ctx, pythonInterpreter, args...)
+	pkg.KillProcessGroupOnCancel(cmd)
+
+	result, err := protocol.Run(cmd, onProgress)
+	if err != nil {
+		return nil, mapScriptError(err)
+	}
+	return result, nil
+}
+
+// mapScriptError traduce los códigos de error del script a los errores comunes de los backends
+func mapScriptError(err error) error {
+	var scriptErr *protocol.Error
+	if !errors.As(err, &scriptErr) {
+		return err
+	}
+	switch scriptErr.Code {
+	case protocol.CodeVideoUnavailable:
+		return fmt.Errorf("%w: %s", ErrVideoUnavailable, scriptErr.Message)
+	case protocol.CodeResolutionUnavailable:
+		return fmt.Errorf("%w: %s", ErrResolutionUnavailable, scriptErr.Message)
+	}
+	return err
+}
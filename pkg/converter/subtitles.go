@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Sufijo del ID de los subtítulos generados automáticamente
+const autoSuffix = "-auto"
+
+// Tamaño máximo de un archivo de subtítulos
+const maxSubtitleSize = 10 << 20
+
+// Subtitle es una pista de subtítulos disponible para un video
+type Subtitle struct {
+	ID        string `json:"id"`       // Idioma, con el sufijo -auto en los automáticos: en, es-419, en-auto
+	Language  string `json:"language"` // Código de idioma de YouTube
+	Name      string `json:"name"`
+	Automatic bool   `json:"automatic"` // Generados automáticamente por YouTube
+	URL       string `json:"-"`         // Dirección del WebVTT
+}
+
+// NewSubtitle crea una pista con su ID
+func NewSubtitle(language string, name string, automatic bool, url string) Subtitle {
+	id := language
+	if automatic {
+		id += autoSuffix
+	}
+	return Subtitle{ID: id, Language: language, Name: name, Automatic: automatic, URL: url}
+}
+
+// SortSubtitles ordena las pistas con las manuales primero y después por idioma
+func SortSubtitles(subtitles []Subtitle) {
+	sort.SliceStable(subtitles, func(i, j int) bool {
+		if subtitles[i].Automatic != subtitles[j].Automatic {
+			return !subtitles[i].Automatic
+		}
+		return subtitles[i].Language < subtitles[j].Language
+	})
+}
+
+// SelectSubtitles devuelve las pistas con los IDs indicados, en el mismo orden
+func SelectSubtitles(available []Subtitle, ids []string) ([]Subtitle, error) {
+	selected := make([]Subtitle, 0, len(ids))
+	for _, id := range ids {
+		found := false
+		for _, subtitle := range available {
+			if strings.EqualFold(subtitle.ID, id) {
+				selected = append(selected, subtitle)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("los subtítulos %s no están disponibles", id)
+		}
+	}
+	return selected, nil
+}
+
+// fetchSubtitle descarga el WebVTT de una pista
+func fetchSubtitle(ctx context.Context, client *http.Client, subtitle Subtitle) ([]byte, error) {
+	if subtitle.URL == "" {
+		return nil, fmt.Errorf("los subtítulos %s no tienen dirección de descarga", subtitle.ID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subtitle.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al descargar los subtítulos %s: %v", subtitle.ID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error al descargar los subtítulos %s: código de estado %d", subtitle.ID, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSubtitleSize))
+}
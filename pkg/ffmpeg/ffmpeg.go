@@ -0,0 +1,74 @@
+// Package ffmpeg ejecuta ffmpeg desde Go informando del progreso a partir de su salida -progress.
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"yt-converter-api/pkg"
+)
+
+// Cantidad máxima de stderr que se incluye en los errores
+const stderrTailSize = 2048
+
+// Run ejecuta ffmpeg con los argumentos indicados (sin incluir el binario). Si duration es mayor que cero
+// se llama a onProgress con el porcentaje completado, al cancelar el contexto se mata el proceso
+func Run(ctx context.Context, binary string, args []string, duration time.Duration, onProgress func(percent float64)) error {
+	_, err := run(ctx, binary, "error", args, duration, onProgress)
+	return err
+}
+
+// Analyze ejecuta ffmpeg como Run pero con el nivel de log info y devuelve su stderr, para los filtros que
+// escriben sus medidas en el log (loudnorm, volumedetect...)
+func Analyze(ctx context.Context, binary string, args []string, duration time.Duration, onProgress func(percent float64)) (string, error) {
+	return run(ctx, binary, "info", args, duration, onProgress)
+}
+
+// run ejecuta ffmpeg con el nivel de log indicado y devuelve su stderr
+func run(ctx context.Context, binary string, logLevel string, args []string, duration time.Duration, onProgress func(percent float64)) (string, error) {
+	args = append([]string{"-hide_banner", "-loglevel", logLevel, "-nostats", "-progress", "pipe:1", "-y"}, args...)
+	cmd := exec.CommandContext(ctx, binary, args...)
+	pkg.KillProcessGroupOnCancel(cmd)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("no se pudo ejecutar ffmpeg: %w", err)
+	}
+
+	// -progress escribe bloques clave=valor, out_time_us es el tiempo ya procesado
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if key != "out_time_us" || duration <= 0 || onProgress == nil {
+			continue
+		}
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			onProgress(min(float64(us)*100/float64(duration.Microseconds()), 100))
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		tail := stderr.Bytes()
+		if len(tail) > stderrTailSize {
+			tail = tail[len(tail)-stderrTailSize:]
+		}
+		return "", fmt.Errorf("ffmpeg falló: %v, stderr: %s", err, strings.TrimSpace(string(tail)))
+	}
+	if onProgress != nil {
+		onProgress(100)
+	}
+	return stderr.String(), nil
+}
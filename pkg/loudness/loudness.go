@@ -0,0 +1,199 @@
+// Package loudness normaliza la sonoridad del audio según EBU R128 con el filtro loudnorm de ffmpeg en dos
+// pasadas: la primera mide la sonoridad integrada, el pico verdadero y el rango de sonoridad del audio y la
+// segunda aplica esas medidas para llegar al objetivo, con un cambio de volumen lineal siempre que el pico
+// verdadero lo permita.
+package loudness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/ffmpeg"
+)
+
+// Objetivos de la normalización, la sonoridad integrada (LUFS) la indica cada petición o LOUDNESS_TARGET
+const (
+	MinTarget     = -70.0
+	MaxTarget     = -5.0
+	TruePeak      = -1.5 // Pico verdadero máximo, dBTP
+	LoudnessRange = 11.0 // Rango de sonoridad objetivo, LU
+)
+
+// Frecuencia de muestreo de la salida si no se puede leer la del original, loudnorm trabaja a 192 kHz y
+// hay que indicar siempre la de salida
+const fallbackSampleRate = 48000
+
+var sampleRatePattern = regexp.MustCompile(`Stream #0:\d+.*: Audio: [^\n]*?(\d+) Hz`)
+
+// ValidateTarget comprueba que el objetivo esté en el rango que admite loudnorm
+func ValidateTarget(target float64) error {
+	if math.IsNaN(target) || target < MinTarget || target > MaxTarget {
+		return fmt.Errorf("el objetivo de sonoridad debe estar entre %g y %g LUFS", MinTarget, MaxTarget)
+	}
+	return nil
+}
+
+// FormatTarget escribe el objetivo sin decimales innecesarios: -16, -14.5
+func FormatTarget(target float64) string {
+	return strconv.FormatFloat(target, 'f', -1, 64)
+}
+
+// filter devuelve el filtro loudnorm para el objetivo, con las medidas de la primera pasada si se indican
+func filter(target float64, measured map[string]string) string {
+	parts := []string{
+		"I=" + FormatTarget(target),
+		"TP=" + FormatTarget(TruePeak),
+		"LRA=" + FormatTarget(LoudnessRange),
+	}
+	if measured != nil {
+		parts = append(parts,
+			"measured_I="+measured["input_i"],
+			"measured_TP="+measured["input_tp"],
+			"measured_LRA="+measured["input_lra"],
+			"measured_thresh="+measured["input_thresh"],
+			"offset="+measured["target_offset"],
+			"linear=true",
+		)
+	}
+	parts = append(parts, "print_format=json")
+	return "loudnorm=" + strings.Join(parts, ":")
+}
+
+// MeasureArgs devuelve los argumentos de ffmpeg de la primera pasada, que solo mide el audio
+func MeasureArgs(input string, target float64) []string {
+	return []string{"-i", input, "-vn", "-af", filter(target, nil), "-f", "null", "-"}
+}
+
+// NormalizeArgs devuelve los argumentos de ffmpeg de la segunda pasada, que codifica el audio normalizado
+// en output con codecArgs y la frecuencia de muestreo indicada
+func NormalizeArgs(input string, target float64, measured map[string]string, codecArgs []string, sampleRate int, output string) []string {
+	args := []string{"-i", input, "-map_metadata", "0", "-af", filter(target, measured)}
+	args = append(args, codecArgs...)
+	if !slices.Contains(codecArgs, "-ar") {
+		args = append(args, "-ar", strconv.Itoa(sampleRate))
+	}
+	return append(args, output)
+}
+
+// ParseStats lee las medidas que loudnorm escribe en el log como un objeto JSON con valores de texto
+func ParseStats(log string) (map[string]string, error) {
+	index := strings.LastIndex(log, "[Parsed_loudnorm")
+	if index < 0 {
+		return nil, fmt.Errorf("ffmpeg no devolvió las medidas de loudnorm")
+	}
+	start := strings.Index(log[index:], "{")
+	end := strings.Index(log[index:], "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("ffmpeg no devolvió las medidas de loudnorm")
+	}
+
+	var stats map[string]string
+	if err := json.Unmarshal([]byte(log[index+start:index+end+1]), &stats); err != nil {
+		return nil, fmt.Errorf("error al leer las medidas de loudnorm: %v", err)
+	}
+	return stats, nil
+}
+
+// parseSampleRate lee la frecuencia de muestreo del audio de entrada en el log de ffmpeg
+func parseSampleRate(log string) int {
+	if match := sampleRatePattern.FindStringSubmatch(log); match != nil {
+		if rate, err := strconv.Atoi(match[1]); err == nil && rate > 0 {
+			return rate
+		}
+	}
+	return fallbackSampleRate
+}
+
+// number lee una medida, el audio en silencio da -inf y no se puede normalizar
+func number(stats map[string]string, key string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(stats[key]), 64)
+	if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("loudnorm no pudo medir %s (%q), el audio puede estar en silencio", key, stats[key])
+	}
+	return value, nil
+}
+
+// Result convierte las medidas de las dos pasadas en los valores que se guardan con el video procesado
+func Result(target float64, measured map[string]string, output map[string]string) (models.Loudness, error) {
+	result := models.Loudness{Target: target, NormalizationType: output["normalization_type"]}
+	fields := []struct {
+		stats map[string]string
+		key   string
+		value *float64
+	}{
+		{measured, "input_i", &result.InputI},
+		{measured, "input_tp", &result.InputTP},
+		{measured, "input_lra", &result.InputLRA},
+		{measured, "input_thresh", &result.InputThresh},
+		{output, "output_i", &result.OutputI},
+		{output, "output_tp", &result.OutputTP},
+		{output, "output_lra", &result.OutputLRA},
+	}
+	for _, field := range fields {
+		value, err := number(field.stats, field.key)
+		if err != nil {
+			return result, err
+		}
+		*field.value = value
+	}
+	return result, nil
+}
+
+// Normalize normaliza el audio de path al objetivo en dos pasadas, recodificándolo con codecArgs (sin
+// entrada ni salida), y reemplaza el archivo por el resultado. onProgress recibe el porcentaje de las dos
+// pasadas juntas si se conoce la duración
+func Normalize(ctx context.Context, binary string, path string, target float64, codecArgs []string, duration time.Duration, onProgress func(percent float64)) (models.Loudness, error) {
+	if err := ValidateTarget(target); err != nil {
+		return models.Loudness{}, err
+	}
+	half := func(offset float64) func(float64) {
+		if onProgress == nil {
+			return nil
+		}
+		return func(percent float64) { onProgress(offset + percent/2) }
+	}
+
+	log, err := ffmpeg.Analyze(ctx, binary, MeasureArgs(path, target), duration, half(0))
+	if err != nil {
+		return models.Loudness{}, fmt.Errorf("error al medir la sonoridad: %w", err)
+	}
+	measured, err := ParseStats(log)
+	if err != nil {
+		return models.Loudness{}, err
+	}
+	if _, err := number(measured, "input_i"); err != nil {
+		return models.Loudness{}, err
+	}
+
+	extension := filepath.Ext(path)
+	output := strings.TrimSuffix(path, extension) + ".loudnorm" + extension
+	log, err = ffmpeg.Analyze(ctx, binary, NormalizeArgs(path, target, measured, codecArgs, parseSampleRate(log), output), duration, half(50))
+	if err != nil {
+		os.Remove(output)
+		return models.Loudness{}, fmt.Errorf("error al normalizar el audio: %w", err)
+	}
+	stats, err := ParseStats(log)
+	if err != nil {
+		os.Remove(output)
+		return models.Loudness{}, err
+	}
+	result, err := Result(target, measured, stats)
+	if err != nil {
+		os.Remove(output)
+		return models.Loudness{}, err
+	}
+	if err := os.Rename(output, path); err != nil {
+		os.Remove(output)
+		return models.Loudness{}, fmt.Errorf("error al normalizar el audio: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package loudness
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func readLog(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestValidateTarget(t *testing.T) {
+	tests := []struct {
+		target  float64
+		wantErr bool
+	}{
+		{-16, false},
+		{-23, false},
+		{-70, false},
+		{-5, false},
+		{-4.9, true},
+		{-71, true},
+		{0, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateTarget(tt.target); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTarget(%g) error = %v, se esperaba error: %v", tt.target, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	log := readLog(t, "measure.log")
+	stats, err := ParseStats(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["input_i"] != "-9.83" || stats["target_offset"] != "-0.12" || stats["normalization_type"] != "dynamic" {
+		t.Errorf("ParseStats() = %v", stats)
+	}
+	if rate := parseSampleRate(log); rate != 44100 {
+		t.Errorf("parseSampleRate() = %d, se esperaba 44100", rate)
+	}
+	if rate := parseSampleRate("sin información"); rate != fallbackSampleRate {
+		t.Errorf("parseSampleRate() = %d, se esperaba %d", rate, fallbackSampleRate)
+	}
+	if _, err := ParseStats("Stream #0:0: Audio: mp3, 44100 Hz"); err == nil {
+		t.Error("se esperaba un error sin las medidas de loudnorm")
+	}
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	measured, err := ParseStats(readLog(t, "measure.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(NormalizeArgs("in.mp3", -14.5, measured, []string{"-vn", "-c:a", "libmp3lame", "-q:a", "2"}, 44100, "out.mp3"), " ")
+	want := "-i in.mp3 -map_metadata 0 -af loudnorm=I=-14.5:TP=-1.5:LRA=11:measured_I=-9.83:measured_TP=0.41:measured_LRA=5.20:" +
+		"measured_thresh=-19.95:offset=-0.12:linear=true:print_format=json -vn -c:a libmp3lame -q:a 2 -ar 44100 out.mp3"
+	if got != want {
+		t.Errorf("NormalizeArgs() = %s\nse esperaba      %s", got, want)
+	}
+
+	// La frecuencia de muestreo pedida en las opciones del audio tiene prioridad
+	got = strings.Join(NormalizeArgs("in.opus", -16, measured, []string{"-c:a", "libopus", "-ar", "24000"}, 48000, "out.opus"), " ")
+	if strings.Count(got, "-ar") != 1 || !strings.Contains(got, "-ar 24000") {
+		t.Errorf("NormalizeArgs() = %s, se esperaba solo -ar 24000", got)
+	}
+
+	if got := strings.Join(MeasureArgs("in.mp3", -16), " "); got != "-i in.mp3 -vn -af loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json -f null -" {
+		t.Errorf("MeasureArgs() = %s", got)
+	}
+}
+
+func TestResult(t *testing.T) {
+	stats, err := ParseStats(readLog(t, "measure.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Result(-16, stats, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Target != -16 || result.InputI != -9.83 || result.InputTP != 0.41 || result.OutputI != -15.88 || result.NormalizationType != "dynamic" {
+		t.Errorf("Result() = %+v", result)
+	}
+
+	silence, err := ParseStats(readLog(t, "silence.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Result(-16, silence, silence); err == nil {
+		t.Error("se esperaba un error con audio en silencio")
+	}
+}
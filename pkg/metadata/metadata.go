@@ -0,0 +1,136 @@
+// Package metadata obtiene la información de los videos (título, canal, duración...) desde distintas
+// fuentes: la API de datos de YouTube, la salida --dump-json de yt-dlp u oEmbed.
+//
+// Los proveedores se configuran en METADATA_PROVIDERS y se prueban en orden, así el servidor puede
+// funcionar sin clave de Google y las pruebas pueden usar el proveedor Stub.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"yt-converter-api/config"
+)
+
+// Nombres de los proveedores disponibles
+const (
+	ProviderYoutubeAPI = "youtube-api"
+	ProviderYtDlp      = "yt-dlp"
+	ProviderOEmbed     = "oembed"
+)
+
+// ErrNotFound se devuelve cuando el proveedor confirma que el video no existe o no está disponible
+var ErrNotFound = errors.New("el video no existe o no está disponible")
+
+// ErrUnsupported se devuelve cuando el proveedor solo conoce los videos de YouTube y el video es de otro sitio
+var ErrUnsupported = errors.New("el proveedor no admite videos de este sitio")
+
+// Metadata es la información de un video, cada proveedor rellena los campos que conoce
+type Metadata struct {
+	VideoID       string `json:"video_id"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	ChannelName   string `json:"channel_name"`
+	ChannelID     string `json:"channel_id"`
+	Duration      int    `json:"duration"`    // Segundos
+	UploadDate    string `json:"upload_date"` // YYYY-MM-DD
+	ViewCount     *int64 `json:"view_count"`
+	ThumbnailURL  string `json:"thumbnail_url"`
+	IsLive        bool   `json:"is_live"`
+	IsShort       bool   `json:"is_short"`
+	AgeRestricted bool   `json:"age_restricted"`
+	Provider      string `json:"provider"` // Proveedor que devolvió la información
+}
+
+// Provider obtiene la información de un video a partir de su ID de YouTube o, en otros sitios, de su URL
+// (sources.Source.Ref)
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context, videoID string) (*Metadata, error)
+}
+
+// Current es el proveedor que usa la aplicación, se establece con Init
+var Current Provider
+
+// Init crea la cadena de proveedores configurada en METADATA_PROVIDERS. La API de YouTube se omite si
+// no hay GOOGLE_CLOUD_API_KEY
+func Init(cfg config.Config) error {
+	chain := Chain{}
+	for _, name := range strings.Split(cfg.MetadataProviders, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case ProviderYoutubeAPI:
+			if cfg.GoogleCloudApiKey == "" {
+				fmt.Println("GOOGLE_CLOUD_API_KEY no establecida, se omite el proveedor de metadatos youtube-api")
+				continue
+			}
+			chain = append(chain, NewYoutubeAPI(cfg.GoogleCloudApiKey))
+		case ProviderYtDlp:
+			chain = append(chain, NewYtDlp(cfg.YtDlpPath))
+		case ProviderOEmbed:
+			chain = append(chain, NewOEmbed())
+		default:
+			return fmt.Errorf("proveedor de metadatos desconocido: %s", name)
+		}
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("no hay ningún proveedor de metadatos configurado")
+	}
+
+	Current = chain
+	return nil
+}
+
+// Chain prueba los proveedores en orden hasta que uno devuelve la información. Si uno confirma que el
+// video no existe (ErrNotFound) no se prueban los siguientes, los que no admiten el sitio se saltan
+type Chain []Provider
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, provider := range c {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Fetch(ctx context.Context, videoID string) (*Metadata, error) {
+	var errs []error
+	for _, provider := range c {
+		metadata, err := provider.Fetch(ctx, videoID)
+		if err == nil {
+			metadata.Provider = provider.Name()
+			return metadata, nil
+		}
+		if errors.Is(err, ErrNotFound) || ctx.Err() != nil {
+			return nil, err
+		}
+		if errors.Is(err, ErrUnsupported) {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		fmt.Printf("Error obteniendo los metadatos de %s con %s: %v\n", videoID, provider.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return nil, fmt.Errorf("ningún proveedor de metadatos respondió: %w", errors.Join(errs...))
+}
+
+// Stub devuelve metadatos fijos sin acceder a la red, pensado para pruebas
+type Stub struct {
+	Videos map[string]*Metadata
+}
+
+func (s *Stub) Name() string {
+	return "stub"
+}
+
+func (s *Stub) Fetch(ctx context.Context, videoID string) (*Metadata, error) {
+	metadata, ok := s.Videos[videoID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, videoID)
+	}
+	result := *metadata
+	return &result, nil
+}
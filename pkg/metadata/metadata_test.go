@@ -0,0 +1,134 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveFixture responde con el fixture indicado solo para el video dQw4w9WgXcQ
+func serveFixture(t *testing.T, fixture string, notFound func(w http.ResponseWriter)) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") == "dQw4w9WgXcQ" || r.URL.Query().Get("url") == "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+			w.Write(data)
+			return
+		}
+		notFound(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestYoutubeAPI(t *testing.T) {
+	server := serveFixture(t, "youtube_api.json", func(w http.ResponseWriter) {
+		w.Write([]byte(`{"items": []}`))
+	})
+	provider := &YoutubeAPI{APIKey: "key", BaseURL: server.URL, Client: server.Client()}
+
+	metadata, err := provider.Fetch(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Duration != 212 || metadata.UploadDate != "2009-10-25" || metadata.ChannelID != "UCuAXFkgsw1L7xaCfnd5JJOw" ||
+		metadata.ViewCount == nil || *metadata.ViewCount != 1600000000 || metadata.ThumbnailURL != "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" {
+		t.Errorf("metadatos inesperados: %+v", metadata)
+	}
+
+	if _, err := provider.Fetch(context.Background(), "xxxxxxxxxxx"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("se esperaba ErrNotFound, se obtuvo %v", err)
+	}
+}
+
+func TestOEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"title": "Never Gonna Give You Up", "author_name": "Rick Astley", "thumbnail_url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg"}`))
+	}))
+	defer server.Close()
+	provider := &OEmbed{BaseURL: server.URL, Client: server.Client()}
+
+	metadata, err := provider.Fetch(context.Background(), "dQw4w9WgXcQ")
+	if err != nil || metadata.Title != "Never Gonna Give You Up" || metadata.ChannelName != "Rick Astley" {
+		t.Errorf("Fetch = %+v, %v", metadata, err)
+	}
+	if _, err := provider.Fetch(context.Background(), "xxxxxxxxxxx"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("se esperaba ErrNotFound, se obtuvo %v", err)
+	}
+}
+
+func TestParseYtDlpInfo(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ytdlp.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := parseYtDlpInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.VideoID != "dQw4w9WgXcQ" || metadata.Duration != 212 || metadata.UploadDate != "2009-10-25" ||
+		metadata.ChannelName != "Rick Astley" || metadata.IsShort || metadata.AgeRestricted {
+		t.Errorf("metadatos inesperados: %+v", metadata)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]int{"PT3M32S": 212, "PT1H": 3600, "P1DT1S": 86401, "PT0S": 0, "": 0, "invalid": 0}
+	for duration, want := range tests {
+		if got := parseISODuration(duration); got != want {
+			t.Errorf("parseISODuration(%q) = %d, se esperaba %d", duration, got, want)
+		}
+	}
+}
+
+// failingProvider siempre devuelve el mismo error
+type failingProvider struct{ err error }
+
+func (f failingProvider) Name() string { return "failing" }
+
+func (f failingProvider) Fetch(ctx context.Context, videoID string) (*Metadata, error) {
+	return nil, f.err
+}
+
+func TestChain(t *testing.T) {
+	stub := &Stub{Videos: map[string]*Metadata{"dQw4w9WgXcQ": {VideoID: "dQw4w9WgXcQ", Title: "Stub"}}}
+
+	// Un error temporal pasa al siguiente proveedor
+	chain := Chain{failingProvider{errors.New("quota exceeded")}, stub}
+	metadata, err := chain.Fetch(context.Background(), "dQw4w9WgXcQ")
+	if err != nil || metadata.Title != "Stub" || metadata.Provider != "stub" {
+		t.Errorf("Fetch = %+v, %v", metadata, err)
+	}
+
+	// Si un proveedor confirma que el video no existe no se prueban los siguientes
+	chain = Chain{failingProvider{ErrNotFound}, stub}
+	if _, err := chain.Fetch(context.Background(), "dQw4w9WgXcQ"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("se esperaba ErrNotFound, se obtuvo %v", err)
+	}
+
+	// Los proveedores solo de YouTube se saltan con los videos de otros sitios
+	stub.Videos["https://vimeo.com/76979871"] = &Metadata{Title: "Vimeo"}
+	chain = Chain{NewOEmbed(), stub}
+	metadata, err = chain.Fetch(context.Background(), "https://vimeo.com/76979871")
+	if err != nil || metadata.Title != "Vimeo" {
+		t.Errorf("Fetch = %+v, %v", metadata, err)
+	}
+
+	// Si todos fallan se devuelven todos los errores
+	chain = Chain{failingProvider{errors.New("quota exceeded")}, failingProvider{errors.New("timeout")}}
+	if _, err := chain.Fetch(context.Background(), "dQw4w9WgXcQ"); err == nil {
+		t.Error("se esperaba un error")
+	}
+}
@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"yt-converter-api/pkg/sources"
+)
+
+// OEmbed usa el endpoint público oEmbed de YouTube, no necesita clave pero solo devuelve el título,
+// el canal y la miniatura
+type OEmbed struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewOEmbed crea el proveedor oEmbed de YouTube
+func NewOEmbed() *OEmbed {
+	return &OEmbed{BaseURL: "https://www.youtube.com/oembed", Client: http.DefaultClient}
+}
+
+func (o *OEmbed) Name() string {
+	return ProviderOEmbed
+}
+
+type oEmbedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (o *OEmbed) Fetch(ctx context.Context, videoID string) (*Metadata, error) {
+	if sources.IsURLRef(videoID) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, videoID)
+	}
+	videoURL := "https://www.youtube.com/watch?v=" + videoID
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"?format=json&url="+url.QueryEscape(videoURL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al hacer la solicitud HTTP a oEmbed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 404 indica que el video no existe, 401 que existe pero no se puede insertar (no es concluyente)
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, videoID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oEmbed respondió con el código de estado %d", resp.StatusCode)
+	}
+
+	var oEmbedResp oEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&oEmbedResp); err != nil {
+		return nil, fmt.Errorf("error al deserializar la respuesta: %v", err)
+	}
+
+	return &Metadata{
+		VideoID:      videoID,
+		Title:        oEmbedResp.Title,
+		ChannelName:  oEmbedResp.AuthorName,
+		ThumbnailURL: oEmbedResp.ThumbnailURL,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"yt-converter-api/pkg/sources"
+)
+
+// YoutubeAPI usa la API de datos de YouTube v3, necesita una clave de Google Cloud
+type YoutubeAPI struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewYoutubeAPI crea el proveedor con la clave indicada
+func NewYoutubeAPI(apiKey string) *YoutubeAPI {
+	return &YoutubeAPI{APIKey: apiKey, BaseURL: "https://www.googleapis.com/youtube/v3", Client: http.DefaultClient}
+}
+
+func (y *YoutubeAPI) Name() string {
+	return ProviderYoutubeAPI
+}
+
+type youtubeAPIResponse struct {
+	Items []struct {
+		ID      string `json:"id"`
+		Snippet struct {
+			Title                string `json:"title"`
+			Description          string `json:"description"`
+			ChannelID            string `json:"channelId"`
+			ChannelTitle         string `json:"channelTitle"`
+			PublishedAt          string `json:"publishedAt"`
+			LiveBroadcastContent string `json:"liveBroadcastContent"`
+			Thumbnails           map[string]struct {
+				URL string `json:"url"`
+			} `json:"thumbnails"`
+		} `json:"snippet"`
+		ContentDetails struct {
+			Duration      string `json:"duration"`
+			ContentRating struct {
+				YtRating string `json:"ytRating"`
+			} `json:"contentRating"`
+		} `json:"contentDetails"`
+		Statistics struct {
+			ViewCount string `json:"viewCount"`
+		} `json:"statistics"`
+	} `json:"items"`
+}
+
+func (y *YoutubeAPI) Fetch(ctx context.Context, videoID string) (*Metadata, error) {
+	if sources.IsURLRef(videoID) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, videoID)
+	}
+	apiURL := fmt.Sprintf("%s/videos?part=snippet,contentDetails,statistics&id=%s&key=%s", y.BaseURL, url.QueryEscape(videoID), url.QueryEscape(y.APIKey))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hacer la solicitud HTTP a la API de YouTube
+	resp, err := y.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al hacer la solicitud HTTP a la API de YouTube: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("la API de YouTube respondió con el código de estado %d", resp.StatusCode)
+	}
+
+	var youtubeResp youtubeAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&youtubeResp); err != nil {
+		return nil, fmt.Errorf("error al deserializar la respuesta: %v", err)
+	}
+
+	// Si no se encuentra el video la API devuelve la lista vacía
+	if len(youtubeResp.Items) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, videoID)
+	}
+
+	item := youtubeResp.Items[0]
+	metadata := &Metadata{
+		VideoID:       videoID,
+		Title:         item.Snippet.Title,
+		Description:   item.Snippet.Description,
+		ChannelName:   item.Snippet.ChannelTitle,
+		ChannelID:     item.Snippet.ChannelID,
+		Duration:      parseISODuration(item.ContentDetails.Duration),
+		IsLive:        item.Snippet.LiveBroadcastContent == "live",
+		AgeRestricted: item.ContentDetails.ContentRating.YtRating == "ytAgeRestricted",
+	}
+	if len(item.Snippet.PublishedAt) >= 10 {
+		metadata.UploadDate = item.Snippet.PublishedAt[:10]
+	}
+	if views, err := strconv.ParseInt(item.Statistics.ViewCount, 10, 64); err == nil {
+		metadata.ViewCount = &views
+	}
+
+	// Usar la miniatura de mayor calidad disponible
+	for _, quality := range []string{"maxres", "standard", "high", "medium", "default"} {
+		if thumbnail, ok := item.Snippet.Thumbnails[quality]; ok {
+			metadata.ThumbnailURL = thumbnail.URL
+			break
+		}
+	}
+
+	return metadata, nil
+}
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration convierte una duración ISO 8601 (PT1H2M3S) a segundos
+func parseISODuration(duration string) int {
+	matches := isoDurationRegex.FindStringSubmatch(duration)
+	if matches == nil {
+		return 0
+	}
+
+	seconds := 0
+	for i, multiplier := range []int{86400, 3600, 60, 1} {
+		value, _ := strconv.Atoi(matches[i+1])
+		seconds += value * multiplier
+	}
+	return seconds
+}
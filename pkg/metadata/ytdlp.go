@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/sources"
+)
+
+// Duración máxima de un Short de YouTube en segundos
+const maxShortDuration = 180
+
+// YtDlp ejecuta yt-dlp --dump-json, no necesita clave pero sí tener yt-dlp instalado
+type YtDlp struct {
+	Binary string
+}
+
+// NewYtDlp crea el proveedor que ejecuta el binario indicado
+func NewYtDlp(binary string) *YtDlp {
+	return &YtDlp{Binary: binary}
+}
+
+func (y *YtDlp) Name() string {
+	return ProviderYtDlp
+}
+
+// ytDlpInfo son los campos de --dump-json que se usan
+type ytDlpInfo struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Channel     string  `json:"channel"`
+	Uploader    string  `json:"uploader"`
+	ChannelID   string  `json:"channel_id"`
+	Duration    float64 `json:"duration"`
+	UploadDate  string  `json:"upload_date"` // YYYYMMDD
+	ViewCount   *int64  `json:"view_count"`
+	Thumbnail   string  `json:"thumbnail"`
+	IsLive      bool    `json:"is_live"`
+	AgeLimit    int     `json:"age_limit"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+}
+
+func (y *YtDlp) Fetch(ctx context.Context, videoID string) (*Metadata, error) {
+	// Los videos de otros sitios llegan ya como URL
+	videoURL := videoID
+	if !sources.IsURLRef(videoURL) {
+		videoURL = "https://www.youtube.com/watch?v=" + videoID
+	}
+	cmd := exec.CommandContext(ctx, y.Binary, "--dump-json", "--skip-download", "--no-warnings", "--no-playlist", videoURL)
+	pkg.KillProcessGroupOnCancel(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if isUnavailableMessage(message) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, message)
+		}
+		return nil, fmt.Errorf("error al ejecutar yt-dlp: %v, stderr: %s", err, message)
+	}
+
+	return parseYtDlpInfo(output)
+}
+
+// parseYtDlpInfo convierte la salida de --dump-json a Metadata
+func parseYtDlpInfo(output []byte) (*Metadata, error) {
+	var info ytDlpInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("error al deserializar la salida de yt-dlp: %v", err)
+	}
+
+	metadata := &Metadata{
+		VideoID:       info.ID,
+		Title:         info.Title,
+		Description:   info.Description,
+		ChannelName:   info.Channel,
+		ChannelID:     info.ChannelID,
+		Duration:      int(info.Duration),
+		ViewCount:     info.ViewCount,
+		ThumbnailURL:  info.Thumbnail,
+		IsLive:        info.IsLive,
+		IsShort:       info.Duration > 0 && info.Duration <= maxShortDuration && info.Height > info.Width,
+		AgeRestricted: info.AgeLimit >= 18,
+	}
+	if metadata.ChannelName == "" {
+		metadata.ChannelName = info.Uploader
+	}
+	if len(info.UploadDate) == 8 {
+		metadata.UploadDate = fmt.Sprintf("%s-%s-%s", info.UploadDate[:4], info.UploadDate[4:6], info.UploadDate[6:])
+	}
+	return metadata, nil
+}
+
+// isUnavailableMessage indica si el error de yt-dlp significa que el video no existe o es privado
+func isUnavailableMessage(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "video unavailable") || strings.Contains(message, "private video") || strings.Contains(message, "has been removed")
+}
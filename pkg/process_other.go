@@ -0,0 +1,13 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"os/exec"
+	"time"
+)
+
+// KillProcessGroupOnCancel en sistemas no unix solo puede matar el proceso principal
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 5 * time.Second
+}
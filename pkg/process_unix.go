@@ -0,0 +1,19 @@
+//go:build unix
+
+package pkg
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// KillProcessGroupOnCancel hace que al cancelar el contexto del comando se mate todo su grupo de procesos,
+// así no quedan procesos hijos (ffmpeg) huérfanos cuando se cancela una conversión
+func KillProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+}
@@ -0,0 +1,280 @@
+// Package protocol decodifica el protocolo JSON-lines que usa pyConverter/main.py cuando se ejecuta con --json.
+//
+// Cada línea de stdout es un mensaje con la forma {"v": 1, "type": "<tipo>", "<tipo>": {...}}, donde el tipo
+// puede ser progress, log, result o error. Las líneas que no son JSON válido se ignoran, así un print
+// perdido nunca puede confundirse con el resultado.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"yt-converter-api/models"
+)
+
+// Version es la versión del protocolo que entiende este decodificador
+const Version = 1
+
+// Tipos de mensaje
+const (
+	TypeProgress = "progress"
+	TypeLog      = "log"
+	TypeResult   = "result"
+	TypeError    = "error"
+)
+
+// Códigos de error que puede enviar el script
+const (
+	CodeInvalidArguments      = "invalid_arguments"
+	CodeVideoUnavailable      = "video_unavailable"
+	CodeResolutionUnavailable = "resolution_unavailable"
+	CodeDownloadFailed        = "download_failed"
+	CodeTranscodeFailed       = "transcode_failed"
+	CodeInternalError         = "internal_error"
+)
+
+// ErrUnsupportedVersion se devuelve cuando el script habla una versión del protocolo distinta
+var ErrUnsupportedVersion = errors.New("versión del protocolo no soportada")
+
+// ErrNoResult se devuelve cuando el script termina sin enviar ni resultado ni error
+var ErrNoResult = errors.New("el script terminó sin enviar un resultado")
+
+// Message es un mensaje del protocolo, solo viene relleno el campo que corresponde a su tipo
+type Message struct {
+	Version  int              `json:"v"`
+	Type     string           `json:"type"`
+	Progress *models.Progress `json:"progress,omitempty"`
+	Log      *Log             `json:"log,omitempty"`
+	Result   *Result          `json:"result,omitempty"`
+	Error    *Error           `json:"error,omitempty"`
+}
+
+// Log es un mensaje informativo del script
+type Log struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// Result es el resultado final del script
+type Result struct {
+	Path        string    `json:"path,omitempty"`        // Archivo generado
+	Resolutions []string  `json:"resolutions,omitempty"` // Resoluciones disponibles
+	Formats     []Format  `json:"formats,omitempty"`     // Formatos disponibles con el detalle de cada stream
+	Info        *Info     `json:"info,omitempty"`        // Información del video (modo info)
+	Playlist    *Playlist `json:"playlist,omitempty"`    // Videos de una lista de reproducción (modo playlist)
+}
+
+// Format es un formato tal y como lo describe yt-dlp
+type Format struct {
+	FormatID     string  `json:"format_id"`
+	Ext          string  `json:"ext"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	FPS          float64 `json:"fps"`
+	VCodec       string  `json:"vcodec"`
+	ACodec       string  `json:"acodec"`
+	DynamicRange string  `json:"dynamic_range"`
+	TBR          float64 `json:"tbr"`      // kbps
+	FileSize     int64   `json:"filesize"` // Bytes, exacto o aproximado
+}
+
+// Info es la información básica de un video que devuelve el modo info del script
+type Info struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Duration  float64    `json:"duration"`
+	Channel   string     `json:"channel"`
+	IsLive    bool       `json:"is_live"`
+	Chapters  []Chapter  `json:"chapters,omitempty"`
+	Subtitles []Subtitle `json:"subtitles,omitempty"`
+}
+
+// Playlist es una lista de reproducción que devuelve el modo playlist del script
+type Playlist struct {
+	ID      string          `json:"id"`
+	Title   string          `json:"title"`
+	Channel string          `json:"channel"`
+	Entries []PlaylistEntry `json:"entries"`
+}
+
+// PlaylistEntry es un video de la lista tal y como aparece en el listado, sin consultar el video
+type PlaylistEntry struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Duration float64 `json:"duration"`
+	Channel  string  `json:"channel"`
+}
+
+// Subtitle es una pista de subtítulos en WebVTT, manual o generada automáticamente
+type Subtitle struct {
+	Language  string `json:"language"`
+	Name      string `json:"name"`
+	Automatic bool   `json:"automatic"`
+	URL       string `json:"url"`
+}
+
+// Chapter es un capítulo del video según yt-dlp, en segundos
+type Chapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+}
+
+// Error es un error con código estable enviado por el script
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Decoder lee mensajes del protocolo línea a línea
+type Decoder struct {
+	scanner *bufio.Scanner
+	// Stray guarda las líneas que no eran mensajes del protocolo, útil para depurar
+	Stray []string
+}
+
+// NewDecoder crea un decodificador que lee de r
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &Decoder{scanner: scanner}
+}
+
+// Next devuelve el siguiente mensaje o io.EOF cuando no hay más
+func (d *Decoder) Next() (*Message, error) {
+	for d.scanner.Scan() {
+		line := bytes.TrimSpace(d.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg Message
+		if line[0] != '{' || json.Unmarshal(line, &msg) != nil || msg.Type == "" {
+			d.Stray = append(d.Stray, string(line))
+			continue
+		}
+		if msg.Version != Version {
+			return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, msg.Version)
+		}
+		if !msg.valid() {
+			return nil, fmt.Errorf("mensaje %s sin contenido", msg.Type)
+		}
+		return &msg, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// valid comprueba que el mensaje trae el contenido de su tipo, los tipos desconocidos se aceptan para
+// que el script pueda añadir mensajes nuevos sin romper versiones anteriores de la API
+func (m *Message) valid() bool {
+	switch m.Type {
+	case TypeProgress:
+		return m.Progress != nil
+	case TypeLog:
+		return m.Log != nil
+	case TypeResult:
+		return m.Result != nil
+	case TypeError:
+		return m.Error != nil
+	}
+	return true
+}
+
+// Read consume todos los mensajes, llama a onProgress con cada progreso y devuelve el resultado final.
+// Si el script envía un error se devuelve como *Error
+func Read(r io.Reader, onProgress func(models.Progress)) (*Result, error) {
+	decoder := NewDecoder(r)
+	var result *Result
+	var scriptErr *Error
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Hay que vaciar la salida para que el proceso no se quede bloqueado escribiendo
+			io.Copy(io.Discard, r)
+			return nil, err
+		}
+
+		switch msg.Type {
+		case TypeProgress:
+			if onProgress != nil {
+				onProgress(*msg.Progress)
+			}
+		case TypeResult:
+			result = msg.Result
+		case TypeError:
+			scriptErr = msg.Error
+		}
+	}
+
+	if scriptErr != nil {
+		return nil, scriptErr
+	}
+	if result == nil {
+		return nil, ErrNoResult
+	}
+	return result, nil
+}
+
+// Run ejecuta el comando, que debe usar --json, y devuelve su resultado. Si el comando falla sin
+// enviar un mensaje de error se incluye el final de stderr en el error devuelto
+func Run(cmd *exec.Cmd, onProgress func(models.Progress)) (*Result, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	result, readErr := Read(stdout, onProgress)
+	waitErr := cmd.Wait()
+
+	var scriptErr *Error
+	if errors.As(readErr, &scriptErr) {
+		return nil, scriptErr
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("%v, stderr: %s", waitErr, stderr.String())
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return result, nil
+}
+
+// Cantidad máxima de stderr que se guarda para los mensajes de error
+const stderrTailSize = 4096
+
+// tailBuffer guarda solo el final de lo que se escribe en él
+type tailBuffer struct {
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailSize {
+		t.buf = t.buf[len(t.buf)-stderrTailSize:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return strings.TrimSpace(string(t.buf))
+}
@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"yt-converter-api/models"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("no se pudo abrir el fixture %s: %v", name, err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestReadFixtures(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		path        string
+		resolutions []string
+		formats     int
+		phases      []string
+		errCode     string
+		err         error
+	}{
+		{fixture: "formats.jsonl", resolutions: []string{"360p", "720p"}, formats: 4},
+		{fixture: "video_success.jsonl", path: "/app/storage/.work/job-1/dQw4w9WgXcQ-1280x720.mp4", phases: []string{"download", "download", "merge", "merge"}},
+		{fixture: "noisy.jsonl", path: "/app/storage/.work/job-7/Error - dQw4w9WgXcQ.mp3", phases: []string{"download", "transcode"}},
+		{fixture: "resolution_unavailable.jsonl", errCode: CodeResolutionUnavailable},
+		{fixture: "video_unavailable.jsonl", errCode: CodeVideoUnavailable},
+		{fixture: "unsupported_version.jsonl", err: ErrUnsupportedVersion},
+		{fixture: "no_result.jsonl", phases: []string{"download"}, err: ErrNoResult},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var phases []string
+			result, err := Read(openFixture(t, tt.fixture), func(p models.Progress) {
+				phases = append(phases, p.Phase)
+			})
+
+			if tt.errCode != "" {
+				var scriptErr *Error
+				if !errors.As(err, &scriptErr) || scriptErr.Code != tt.errCode {
+					t.Fatalf("se esperaba un error %s, se obtuvo %v", tt.errCode, err)
+				}
+				return
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("se esperaba %v, se obtuvo %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+
+			if tt.phases != nil && !slices.Equal(phases, tt.phases) {
+				t.Errorf("fases = %v, se esperaba %v", phases, tt.phases)
+			}
+			if result == nil {
+				return
+			}
+			if result.Path != tt.path {
+				t.Errorf("path = %q, se esperaba %q", result.Path, tt.path)
+			}
+			if !slices.Equal(result.Resolutions, tt.resolutions) {
+				t.Errorf("resoluciones = %v, se esperaba %v", result.Resolutions, tt.resolutions)
+			}
+			if len(result.Formats) != tt.formats {
+				t.Errorf("se recibieron %d formatos, se esperaban %d", len(result.Formats), tt.formats)
+			}
+		})
+	}
+}
+
+func TestDecoderKeepsStrayLines(t *testing.T) {
+	decoder := NewDecoder(openFixture(t, "noisy.jsonl"))
+	count := 0
+	for {
+		_, err := decoder.Next()
+		if err != nil {
+			break
+		}
+		count++
+	}
+
+	if count != 4 {
+		t.Errorf("se decodificaron %d mensajes, se esperaban 4", count)
+	}
+	if len(decoder.Stray) != 5 {
+		t.Errorf("se ignoraron %d líneas, se esperaban 5: %v", len(decoder.Stray), decoder.Stray)
+	}
+}
+
+func TestDecoderProgressValues(t *testing.T) {
+	decoder := NewDecoder(openFixture(t, "video_success.jsonl"))
+	decoder.Next() // log
+	msg, err := decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := msg.Progress
+	if p == nil || p.Percent == nil || *p.Percent != 50 || *p.DownloadedBytes != 512 || *p.TotalBytes != 1024 || *p.ETA != 2 {
+		t.Errorf("progreso inesperado: %+v", p)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat no disponible")
+	}
+
+	result, err := Run(exec.Command(cat, filepath.Join("testdata", "video_success.jsonl")), nil)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if !strings.HasSuffix(result.Path, "-1280x720.mp4") {
+		t.Errorf("path inesperado: %s", result.Path)
+	}
+
+	// Un error del script tiene prioridad sobre el código de salida
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh no disponible")
+	}
+	_, err = Run(exec.Command(sh, "-c", "cat testdata/video_unavailable.jsonl; exit 1"), nil)
+	var scriptErr *Error
+	if !errors.As(err, &scriptErr) || scriptErr.Code != CodeVideoUnavailable {
+		t.Errorf("se esperaba video_unavailable, se obtuvo %v", err)
+	}
+
+	// Sin mensaje de error se incluye stderr
+	_, err = Run(exec.Command(sh, "-c", "echo Traceback >&2; exit 1"), nil)
+	if err == nil || !strings.Contains(err.Error(), "Traceback") {
+		t.Errorf("se esperaba el stderr en el error, se obtuvo %v", err)
+	}
+}
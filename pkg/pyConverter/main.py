@@ -1,10 +1,88 @@
 import yt_dlp
 import sys
 import os
+import json
 import subprocess
 import argparse
 
 
+# Versión del protocolo JSON-lines que se usa para comunicarse con la API en Go (--json)
+PROTOCOL_VERSION = 1
+
+# Si está activo, stdout solo contiene mensajes del protocolo, uno por línea
+JSON_MODE = False
+
+# Salida real del protocolo, en modo JSON sys.stdout se redirige a stderr para que ningún print la ensucie
+PROTOCOL_OUT = sys.stdout
+
+
+class ConverterError(Exception):
+    """
+    Error con un código estable que se envía a la API en el mensaje de tipo error.
+    Códigos: invalid_arguments, video_unavailable, resolution_unavailable, download_failed,
+    transcode_failed, internal_error.
+    """
+
+    def __init__(self, code: str, message: str):
+        super().__init__(message)
+        self.code = code
+        self.message = message
+
+
+def emit(message_type: str, payload: dict) -> None:
+    """
+    Escribe un mensaje del protocolo: {"v": 1, "type": <tipo>, <tipo>: {...}}
+    Tipos: progress, log, result, error.
+    """
+    if not JSON_MODE:
+        return
+    message = {"v": PROTOCOL_VERSION, "type": message_type, message_type: payload}
+    PROTOCOL_OUT.write(json.dumps(message, ensure_ascii=False) + "\n")
+    PROTOCOL_OUT.flush()
+
+
+def log(message: str, level: str = "info") -> None:
+    if JSON_MODE:
+        emit("log", {"level": level, "message": message})
+    else:
+        print(message)
+
+
+def emit_progress(phase: str, percent: float | None = None, downloaded_bytes: int | None = None,
+                  total_bytes: int | None = None, speed: float | None = None, eta: int | None = None) -> None:
+    """
+    Envía el progreso de la conversión. Fases posibles: download, merge, transcode.
+    """
+    emit("progress", {
+        "phase": phase,
+        "percent": round(percent, 2) if percent is not None else None,
+        "downloaded_bytes": downloaded_bytes,
+        "total_bytes": total_bytes,
+        "speed": speed,
+        "eta": int(eta) if eta is not None else None,
+    })
+
+
+def download_progress_hook(d: dict) -> None:
+    if d.get("status") == "downloading":
+        downloaded = d.get("downloaded_bytes")
+        total = d.get("total_bytes") or d.get("total_bytes_estimate")
+        percent = downloaded * 100 / total if downloaded is not None and total else None
+        emit_progress("download", percent, downloaded, total, d.get("speed"), d.get("eta"))
+    elif d.get("status") == "finished":
+        total = d.get("total_bytes") or d.get("downloaded_bytes")
+        emit_progress("download", 100, total, total)
+
+
+def postprocessor_hook(d: dict) -> None:
+    # yt-dlp une audio y video con FFmpegMerger y extrae el audio con FFmpegExtractAudio
+    phase = "merge" if d.get("postprocessor") == "Merger" else "transcode"
+    if d.get("status") == "started":
+        emit_progress(phase, 0)
+    elif d.get("status") == "finished":
+        emit_progress(phase, 100)
+
+
 # Returns the path of the cookie file to use if exists
 def get_cookie_file_path(cookies_path: str | None) -> str | None:
     """
@@ -12,7 +90,7 @@ def get_cookie_file_path(cookies_path: str | None) -> str | None:
     Si no existe ninguno, devuelve None.
     """
     if cookies_path and os.path.exists(cookies_path):
-        print("Usando cookies %s" % cookies_path)
+        log("Usando cookies %s" % cookies_path)
         return cookies_path
 
     # Ruta absoluta al cookies.txt desde donde se encuentra este script
@@ -20,7 +98,7 @@ def get_cookie_file_path(cookies_path: str | None) -> str | None:
     default_path = os.path.join(script_dir, "cookies.txt")
 
     if os.path.exists(default_path):
-        print("Usando cookies %s" % default_path)
+        log("Usando cookies %s" % default_path)
         return default_path
 
     return None
@@ -40,22 +118,66 @@ def check_if_cookies_file_is_present(cookies_path: str | None) -> bool:
 
     return os.path.exists(default_path)
     
-def convert_m4a_to_mp3(m4a_path: str, mp3_path: str) -> str:
+# Códec de ffmpeg y argumentos por defecto de cada formato de audio, m4a sin opciones se copia sin recodificar
+AUDIO_CODECS = {
+    "mp3": ("libmp3lame", ["-q:a", "2"]),
+    "opus": ("libopus", ["-b:a", "160k"]),
+    "flac": ("flac", []),
+    "wav": ("pcm_s16le", []),
+    "m4a": ("aac", []),
+    "ogg": ("libvorbis", ["-q:a", "5"]),
+}
+
+
+def audio_codec_args(audio_format: str, bitrate: int | None = None, quality: int | None = None,
+                     sample_rate: int | None = None) -> list[str]:
+    encoder, defaults = AUDIO_CODECS[audio_format]
+    args = ["-vn", "-codec:a", encoder]
+    if bitrate:
+        args += ["-b:a", f"{bitrate}k"]
+    elif quality is not None:
+        args += ["-q:a", str(quality)]
+    else:
+        args += defaults
+    if sample_rate:
+        args += ["-ar", str(sample_rate)]
+    return args
+
+
+def transcode_audio(m4a_path: str, output_path: str, codec_args: list[str], duration: float | None = None) -> str:
     try:
-        # Use ffmpeg to convert M4A to MP3
-        subprocess.run(
-            ["ffmpeg", "-i", m4a_path, "-codec:a", "libmp3lame", "-q:a", "2", mp3_path],
-            check=True,
+        # Use ffmpeg to convert M4A to the requested format, -progress escribe el avance en stdout como clave=valor
+        process = subprocess.Popen(
+            ["ffmpeg", "-y", "-i", m4a_path, *codec_args,
+             "-progress", "pipe:1", "-nostats", output_path],
+            stdout=subprocess.PIPE,
+            stderr=subprocess.DEVNULL,
+            text=True,
         )
-        return mp3_path
+        emit_progress("transcode", 0)
+        for line in process.stdout:
+            key, _, value = line.strip().partition("=")
+            if key == "out_time_us" and duration and value.isdigit():
+                emit_progress("transcode", min(int(value) / 1_000_000 * 100 / duration, 100))
+        if process.wait() != 0:
+            raise subprocess.CalledProcessError(process.returncode, "ffmpeg")
+        emit_progress("transcode", 100)
+        return output_path
     except subprocess.CalledProcessError as e:
-        print(f"Error converting M4A to MP3: {e}")
-        return ""
+        raise ConverterError("transcode_failed", f"Error converting M4A to {os.path.splitext(output_path)[1][1:].upper()}: {e}")
+
+
+def apply_clip(ydl_opts: dict, start: float | None, end: float | None) -> None:
+    """Limita la descarga al fragmento [start, end] en segundos usando las secciones de yt-dlp."""
+    if end is None:
+        return
+    ydl_opts["download_ranges"] = yt_dlp.utils.download_range_func(None, [(start or 0, end)])
+    ydl_opts["force_keyframes_at_cuts"] = True
 
 
 def convert_to_audio(
-    output_path: str, youtube_id: str, cookies_path: str = None
-) -> str:
+    output_path: str, video_url: str, cookies_path: str = None, start: float | None = None, end: float | None = None
+) -> tuple[str, float | None]:
     if check_if_cookies_file_is_present(cookies_path):
         ydl_opts = {
             "format": "m4a/bestaudio/best",
@@ -79,12 +201,17 @@ def convert_to_audio(
             ],
             "outtmpl": output_path + "/%(id)s.%(ext)s",
         }
+    ydl_opts["progress_hooks"] = [download_progress_hook]
+    ydl_opts["postprocessor_hooks"] = [postprocessor_hook]
+    apply_clip(ydl_opts, start, end)
 
     with yt_dlp.YoutubeDL(ydl_opts) as ydl:
         # Esto es lo que hace la descarga real
-        url = f"https://www.youtube.com/watch?v={youtube_id}"
-        ydl.download([url])
-        return f"{output_path}/{youtube_id}.m4a"
+        info = ydl.extract_info(video_url, download=True)
+        # Con un fragmento la duración del audio es la del fragmento
+        duration = end - (start or 0) if end is not None else info.get("duration")
+        # El nombre sale de outtmpl con el ID del sitio de origen, tras extraer el audio la extensión es m4a
+        return os.path.splitext(ydl.prepare_filename(info))[0] + ".m4a", duration
 
 
 def get_video_available_resolutions(youtube_url: str, cookies_path: str = None) -> list[str]:
@@ -112,45 +239,163 @@ def get_video_available_resolutions(youtube_url: str, cookies_path: str = None)
         return sorted(resolutions, key=lambda x: int(x.replace("p", "")))
 
 
-def convert_to_video(youtube_url: str, resolution: str, output_path: str, cookies_path: str = None) -> str:
-    available_resolutions = get_video_available_resolutions(youtube_url, cookies_path=cookies_path)
+def get_video_formats(youtube_url: str, cookies_path: str = None) -> list[dict]:
+    """
+    Devuelve los formatos de video y de solo audio con el detalle de cada stream.
+    Se omiten los storyboards y los formatos sin video ni audio.
+    """
+    ydl_opts = {"quiet": True}
+    if check_if_cookies_file_is_present(cookies_path):
+        ydl_opts["cookiefile"] = get_cookie_file_path(cookies_path=cookies_path)
+
+    with yt_dlp.YoutubeDL(ydl_opts) as ydl:
+        info = ydl.extract_info(youtube_url, download=False)
+
+    formats = []
+    for stream in info.get("formats", []):
+        vcodec, acodec = stream.get("vcodec") or "none", stream.get("acodec") or "none"
+        if vcodec == "none" and acodec == "none":
+            continue
+        filesize = stream.get("filesize") or stream.get("filesize_approx")
+        formats.append({
+            "format_id": stream.get("format_id"),
+            "ext": stream.get("ext"),
+            "width": stream.get("width"),
+            "height": stream.get("height") if vcodec != "none" else None,
+            "fps": stream.get("fps"),
+            "vcodec": vcodec,
+            "acodec": acodec,
+            "dynamic_range": stream.get("dynamic_range"),
+            "tbr": stream.get("tbr"),
+            "filesize": int(filesize) if filesize else None,
+        })
+    return formats
+
+
+def convert_to_video(youtube_url: str, resolution: str | None, output_path: str, cookies_path: str = None,
+                     format_id: str | None = None, start: float | None = None, end: float | None = None) -> str:
+    if format_id:
+        # El formato concreto ya lo ha validado la API, se une con el mejor audio solo si no lo trae
+        video_only = f"{format_id}[acodec=none]"
+        video_format = f"{video_only}+bestaudio[ext=m4a]/{video_only}+bestaudio/{format_id}"
+        log(f"⏳ Downloading video {youtube_url} with format {format_id}...")
+    else:
+        available_resolutions = get_video_available_resolutions(youtube_url, cookies_path=cookies_path)
 
-    if resolution not in available_resolutions:
-        print(
-            f"❌ Resolution {resolution} not available. Available resolutions: {available_resolutions}"
-        )
-        return ""
+        if resolution not in available_resolutions:
+            raise ConverterError(
+                "resolution_unavailable",
+                f"Resolution {resolution} not available. Available resolutions: {available_resolutions}",
+            )
 
-    print(f"⏳ Downloading video {youtube_url} with resolution {resolution}...")
+        video_format = f"bestvideo[height={resolution[:-1]}]+bestaudio/best"
+        log(f"⏳ Downloading video {youtube_url} with resolution {resolution}...")
 
     if check_if_cookies_file_is_present(cookies_path):
         ydl_opts = {
-            "format": f"bestvideo[height={resolution[:-1]}]+bestaudio/best",
+            "format": video_format,
             "outtmpl": output_path + "/%(id)s-%(resolution)s.%(ext)s",
             "merge_output_format": "mp4",
             "cookiefile": get_cookie_file_path(cookies_path=cookies_path)
         }
     else:
         ydl_opts = {
-            "format": f"bestvideo[height={resolution[:-1]}]+bestaudio/best",
+            "format": video_format,
             "outtmpl": output_path + "/%(id)s-%(resolution)s.%(ext)s",
             "merge_output_format": "mp4",
         }
+    ydl_opts["progress_hooks"] = [download_progress_hook]
+    ydl_opts["postprocessor_hooks"] = [postprocessor_hook]
+    apply_clip(ydl_opts, start, end)
 
     with yt_dlp.YoutubeDL(ydl_opts) as ydl:
         try:
             info_dict = ydl.extract_info(youtube_url, download=True)
             output_filename = ydl.prepare_filename(info_dict)
             return output_filename
-        except Exception as e:
-            print(f"Error downloading video: {e}")
-            return ""
+        except yt_dlp.utils.DownloadError as e:
+            raise ConverterError("download_failed", f"Error downloading video: {e}")
+
+
+def get_video_info(youtube_url: str, cookies_path: str = None) -> dict:
+    ydl_opts = {"quiet": True}
+    if check_if_cookies_file_is_present(cookies_path):
+        ydl_opts["cookiefile"] = get_cookie_file_path(cookies_path=cookies_path)
+
+    with yt_dlp.YoutubeDL(ydl_opts) as ydl:
+        info = ydl.extract_info(youtube_url, download=False)
+        return {
+            "id": info.get("id"),
+            "title": info.get("title") or "",
+            "duration": info.get("duration") or 0,
+            "channel": info.get("channel") or info.get("uploader") or "",
+            "is_live": bool(info.get("is_live")),
+            "chapters": [
+                {
+                    "title": chapter.get("title") or "",
+                    "start_time": chapter.get("start_time") or 0,
+                    "end_time": chapter.get("end_time") or 0,
+                }
+                for chapter in info.get("chapters") or []
+            ],
+            "subtitles": subtitle_tracks(info),
+        }
+
+
+def get_playlist(playlist_id: str, cookies_path: str = None) -> dict:
+    """Videos de una lista de reproducción en orden. extract_flat solo lee el listado, sin consultar cada video."""
+    ydl_opts = {"quiet": True, "extract_flat": "in_playlist"}
+    if check_if_cookies_file_is_present(cookies_path):
+        ydl_opts["cookiefile"] = get_cookie_file_path(cookies_path=cookies_path)
+
+    with yt_dlp.YoutubeDL(ydl_opts) as ydl:
+        info = ydl.extract_info(playlist_id_to_youtube_url(playlist_id), download=False)
+        return {
+            "id": info.get("id") or playlist_id,
+            "title": info.get("title") or "",
+            "channel": info.get("channel") or info.get("uploader") or "",
+            "entries": [
+                {
+                    "id": entry.get("id"),
+                    "title": entry.get("title") or "",
+                    "duration": entry.get("duration") or 0,
+                    "channel": entry.get("channel") or entry.get("uploader") or "",
+                }
+                for entry in info.get("entries") or []
+                if entry and entry.get("id")
+            ],
+        }
+
+
+def subtitle_tracks(info: dict) -> list[dict]:
+    """Pistas de subtítulos manuales y automáticas con la dirección de su versión WebVTT."""
+    tracks = []
+    for automatic, key in ((False, "subtitles"), (True, "automatic_captions")):
+        for language, formats in (info.get(key) or {}).items():
+            vtt = next((f for f in formats if f.get("ext") == "vtt" and f.get("url")), None)
+            # live_chat no son subtítulos, es la repetición del chat de los directos
+            if vtt is None or language == "live_chat":
+                continue
+            tracks.append({
+                "language": language,
+                "name": vtt.get("name") or language,
+                "automatic": automatic,
+                "url": vtt["url"],
+            })
+    return tracks
 
 
 def video_to_youtube_url(video_id: str) -> str:
+    # Los videos de otros sitios (Vimeo, SoundCloud...) llegan ya como URL
+    if video_id.startswith(("http://", "https://")):
+        return video_id
     return f"https://www.youtube.com/watch?v={video_id}"
 
 
+def playlist_id_to_youtube_url(playlist_id: str) -> str:
+    return f"https://www.youtube.com/playlist?list={playlist_id}"
+
+
 def delete_repeated_resolutions(resolutions: list[str]) -> list[str]:
     return list(set(resolutions))
 
@@ -164,11 +409,11 @@ def main():
         description="Convertidor de videos de YouTube a audio/video con soporte opcional para cookies"
     )
 
-    parser.add_argument("video_id", help="ID del video de YouTube")
+    parser.add_argument("video_id", help="ID del video de YouTube o URL del video en otros sitios (o ID de la lista si convert_to=playlist)")
     parser.add_argument(
         "convert_to",
-        choices=["audio", "video"],
-        help="Formato de conversión: audio o video",
+        choices=["audio", "video", "info", "playlist"],
+        help="Formato de conversión: audio o video, info solo devuelve la información del video y playlist los videos de una lista",
     )
     parser.add_argument(
         "output_path", help="Ruta absoluta donde guardar el archivo de salida"
@@ -181,35 +426,101 @@ def main():
         "--resolution",
         help="Resolución deseada para video (opcional si convert_to=video)",
     )
+    parser.add_argument(
+        "--format-id",
+        help="ID de yt-dlp del formato de video a descargar, tiene prioridad sobre --resolution",
+    )
+    parser.add_argument(
+        "--audio-format",
+        choices=list(AUDIO_CODECS),
+        default="mp3",
+        help="Formato del audio si convert_to=audio (mp3 por defecto)",
+    )
+    parser.add_argument("--audio-bitrate", type=int, help="Bitrate del audio en kbps (opcional)")
+    parser.add_argument("--audio-quality", type=int, help="Calidad VBR del códec de audio (opcional)")
+    parser.add_argument("--sample-rate", type=int, help="Frecuencia de muestreo del audio en Hz (opcional)")
+    parser.add_argument("--start", type=float, help="Inicio del fragmento a descargar en segundos (opcional)")
+    parser.add_argument("--end", type=float, help="Fin del fragmento a descargar en segundos (opcional)")
+    parser.add_argument(
+        "--json",
+        action="store_true",
+        help="Usa el protocolo JSON-lines en stdout (progreso, logs, resultado y errores)",
+    )
 
     args = parser.parse_args()
 
+    global JSON_MODE
+    JSON_MODE = args.json
+    if JSON_MODE:
+        sys.stdout = sys.stderr
+
+    try:
+        result = run(args)
+    except ConverterError as e:
+        fail(e.code, e.message)
+    except yt_dlp.utils.DownloadError as e:
+        # yt-dlp indica así los videos privados, borrados o con restricciones
+        message = str(e)
+        code = "video_unavailable" if "unavailable" in message.lower() or "private" in message.lower() else "download_failed"
+        fail(code, message)
+    except Exception as e:
+        fail("internal_error", f"{type(e).__name__}: {e}")
+
+    if JSON_MODE:
+        emit("result", result)
+    else:
+        print(result.get("path") or result.get("resolutions") or result.get("info") or result.get("playlist"))
+    sys.exit(0)
+
+
+def fail(code: str, message: str) -> None:
+    if JSON_MODE:
+        emit("error", {"code": code, "message": message})
+    else:
+        print(f"❌ Error: {message}")
+    sys.exit(1)
+
+
+def run(args) -> dict:
     # Validaciones básicas
     if not check_if_path_is_valid_and_absolute(args.output_path):
-        print("❌ Por favor proporciona una ruta absoluta válida para la salida.")
-        sys.exit(1)
+        raise ConverterError("invalid_arguments", "Por favor proporciona una ruta absoluta válida para la salida.")
+
+    if args.convert_to == "playlist":
+        return {"playlist": get_playlist(args.video_id, args.cookies)}
 
     video_url = video_to_youtube_url(args.video_id)
 
     if args.convert_to == "audio":
-        path = convert_to_audio(args.output_path, args.video_id, args.cookies)
-        mp3path = convert_m4a_to_mp3(
-            path, os.path.join(args.output_path, f"{args.video_id}.mp3")
+        path, duration = convert_to_audio(args.output_path, video_url, args.cookies, args.start, args.end)
+        # El m4a descargado ya es AAC, solo se recodifica si se pide bitrate o frecuencia de muestreo
+        if args.audio_format == "m4a" and not args.audio_bitrate and not args.sample_rate:
+            return {"path": path}
+        # ffmpeg no puede escribir sobre su entrada, que en m4a tiene el mismo nombre que la salida, así que se
+        # codifica a <id>.audio.<formato> (como el backend nativo) y se renombra al borrar la descarga
+        base = os.path.splitext(path)[0]
+        output = transcode_audio(
+            path,
+            f"{base}.audio.{args.audio_format}",
+            audio_codec_args(args.audio_format, args.audio_bitrate, args.audio_quality, args.sample_rate),
+            duration,
         )
         os.remove(path)
-        print(mp3path)
-        sys.exit(0)
-
-    elif args.convert_to == "video":
-        if not args.resolution:
-            resolutions = get_video_available_resolutions(video_url, args.cookies)
-            print(resolutions)
-            sys.exit(0)
-        path = convert_to_video(
-            video_url, args.resolution, args.output_path, args.cookies
-        )
-        print(path)
-        sys.exit(0)
+        final_path = f"{base}.{args.audio_format}"
+        os.replace(output, final_path)
+        return {"path": final_path}
+
+    if args.convert_to == "info":
+        return {"info": get_video_info(video_url, args.cookies)}
+
+    if not args.resolution and not args.format_id:
+        formats = get_video_formats(video_url, args.cookies)
+        resolutions = sorted({f"{f['height']}p" for f in formats if f["height"]}, key=lambda x: int(x[:-1]))
+        return {"resolutions": resolutions, "formats": formats}
+    path = convert_to_video(
+        video_url, args.resolution, args.output_path, args.cookies, args.format_id, args.start, args.end
+    )
+    return {"path": path}
 
 
 if __name__ == "__main__":
@@ -0,0 +1,93 @@
+"""
+Pruebas del convertidor sin red ni ffmpeg: yt_dlp se sustituye por un módulo vacío, la descarga por un
+archivo de prueba y ffmpeg por un proceso falso que, como el real, no escribe sobre su entrada.
+
+Ejecutar con: python3 -m unittest discover -s pkg/pyConverter
+"""
+import argparse
+import os
+import sys
+import tempfile
+import types
+import unittest
+from unittest import mock
+
+sys.modules.setdefault("yt_dlp", types.ModuleType("yt_dlp"))
+sys.dont_write_bytecode = True
+
+import main  # noqa: E402
+
+
+class FakeFFmpeg:
+    """Sustituye a subprocess.Popen: copia la entrada en la salida con un prefijo y registra los argumentos."""
+
+    calls = []
+
+    def __init__(self, args, **kwargs):
+        FakeFFmpeg.calls.append(args)
+        source, output = args[args.index("-i") + 1], args[-1]
+        self.stdout = iter(["out_time_us=1000000\n", "progress=end\n"])
+        if os.path.abspath(source) == os.path.abspath(output):
+            # ffmpeg: "Output same as Input"
+            self.returncode = 1
+            return
+        with open(source) as src, open(output, "w") as dst:
+            dst.write("transcoded:" + src.read())
+        self.returncode = 0
+
+    def wait(self):
+        return self.returncode
+
+
+class AudioTest(unittest.TestCase):
+    def setUp(self):
+        self.dir = tempfile.mkdtemp()
+        FakeFFmpeg.calls = []
+
+    def run_audio(self, audio_format, bitrate=None, sample_rate=None):
+        downloaded = os.path.join(self.dir, "dQw4w9WgXcQ.m4a")
+        with open(downloaded, "w") as f:
+            f.write("aac")
+
+        args = argparse.Namespace(
+            output_path=self.dir, convert_to="audio", video_id="dQw4w9WgXcQ", cookies=None, start=None, end=None,
+            audio_format=audio_format, audio_bitrate=bitrate, audio_quality=None, sample_rate=sample_rate,
+        )
+        with mock.patch.object(main, "convert_to_audio", return_value=(downloaded, 10.0)), \
+                mock.patch.object(main.subprocess, "Popen", FakeFFmpeg):
+            return main.run(args)
+
+    def read(self, path):
+        with open(path) as f:
+            return f.read()
+
+    def test_m4a_with_bitrate(self):
+        result = self.run_audio("m4a", bitrate=128)
+
+        self.assertEqual(result["path"], os.path.join(self.dir, "dQw4w9WgXcQ.m4a"))
+        self.assertEqual(self.read(result["path"]), "transcoded:aac")
+        self.assertEqual(sorted(os.listdir(self.dir)), ["dQw4w9WgXcQ.m4a"])
+        self.assertIn("128k", FakeFFmpeg.calls[0])
+
+    def test_m4a_with_sample_rate(self):
+        result = self.run_audio("m4a", sample_rate=44100)
+
+        self.assertEqual(self.read(result["path"]), "transcoded:aac")
+        self.assertEqual(sorted(os.listdir(self.dir)), ["dQw4w9WgXcQ.m4a"])
+
+    def test_m4a_without_options_is_not_transcoded(self):
+        result = self.run_audio("m4a")
+
+        self.assertEqual(self.read(result["path"]), "aac")
+        self.assertEqual(FakeFFmpeg.calls, [])
+
+    def test_mp3(self):
+        result = self.run_audio("mp3", bitrate=192)
+
+        self.assertEqual(result["path"], os.path.join(self.dir, "dQw4w9WgXcQ.mp3"))
+        self.assertEqual(self.read(result["path"]), "transcoded:aac")
+        self.assertEqual(sorted(os.listdir(self.dir)), ["dQw4w9WgXcQ.mp3"])
+
+
+if __name__ == "__main__":
+    unittest.main()
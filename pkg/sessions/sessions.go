@@ -0,0 +1,327 @@
+// Package sessions guarda en la base de datos las sesiones iniciadas con POST /api/auth/login para poder
+// refrescarlas y revocarlas.
+//
+// Cada sesión tiene un token de acceso (JWT) de corta duración y un token de refresco que se cambia cada
+// vez que se usa, del que solo se guarda el hash. Los tokens de acceso que dejan de valer antes de caducar
+// (al refrescar o cerrar la sesión) se guardan por su jti en revoked_tokens, que comprueba
+// middleware.JWTProtected.
+package sessions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg"
+)
+
+var (
+	// ErrInvalidToken se devuelve cuando el token de refresco no existe, está revocado o ha caducado
+	ErrInvalidToken = errors.New("el token de refresco no es válido o ha caducado")
+	// ErrTokenReused se devuelve cuando se usa un token de refresco que ya se había cambiado por otro, la
+	// sesión se revoca porque el token puede haber sido robado
+	ErrTokenReused = errors.New("el token de refresco ya se había usado, se ha cerrado la sesión")
+	// ErrUserInactive se devuelve al refrescar la sesión de un usuario borrado o desactivado
+	ErrUserInactive = errors.New("el usuario no existe o ha sido desactivado")
+)
+
+// Duración de los tokens y clave con la que se firman, se establecen con Init
+var (
+	AccessTTL  = 15 * time.Minute
+	RefreshTTL = 30 * 24 * time.Hour
+	secret     []byte
+)
+
+// Init establece la duración de los tokens y la clave con la que se firman
+func Init(cfg config.Config) {
+	AccessTTL = time.Duration(cfg.AccessTokenMinutes) * time.Minute
+	RefreshTTL = time.Duration(cfg.RefreshTokenDays) * 24 * time.Hour
+	secret = []byte(cfg.JwtSecret)
+}
+
+// Tokens son los tokens que se devuelven al iniciar o refrescar una sesión
+type Tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Segundos que dura el token de acceso
+}
+
+// Create inicia una sesión del usuario y devuelve sus tokens
+func Create(userID string, role string, ip string, userAgent string) (Tokens, error) {
+	refreshToken, err := pkg.RandomToken(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+	jti, err := pkg.RandomToken(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	result, err := db.DB.Exec(`INSERT INTO sessions (user_id, refresh_token_hash, access_jti, access_expires_at, ip, user_agent, expires_at)
+		VALUES (?, ?, ?, datetime('now', ?), ?, ?, datetime('now', ?))`,
+		userID, pkg.HashToken(refreshToken), jti, seconds(AccessTTL), ip, userAgent, seconds(RefreshTTL))
+	if err != nil {
+		return Tokens{}, fmt.Errorf("error guardando la sesión: %w", err)
+	}
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	token, err := pkg.GenerateToken(secret, userID, role, sessionID, jti, AccessTTL)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{Token: token, RefreshToken: refreshToken, ExpiresIn: int(AccessTTL.Seconds())}, nil
+}
+
+// Refresh cambia el token de refresco por uno nuevo y un nuevo token de acceso con el rol actual del usuario.
+// El token de acceso anterior de la sesión deja de valer
+func Refresh(refreshToken string, ip string, userAgent string) (Tokens, error) {
+	hash := pkg.HashToken(refreshToken)
+
+	var sessionID int64
+	var userID, previousJTI, previousExpiresAt string
+	err := db.DB.QueryRow(`SELECT id, user_id, access_jti, access_expires_at FROM sessions
+		WHERE refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, hash).
+		Scan(&sessionID, &userID, &previousJTI, &previousExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Un token ya cambiado solo lo tiene quien lo robó o quien lo usó antes que él, se cierra la sesión
+		err = db.DB.QueryRow("SELECT id FROM sessions WHERE previous_token_hash = ? AND revoked_at IS NULL", hash).Scan(&sessionID)
+		if err == nil {
+			if err := Revoke(sessionID); err != nil {
+				return Tokens{}, err
+			}
+			return Tokens{}, ErrTokenReused
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tokens{}, ErrInvalidToken
+		}
+		return Tokens{}, err
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	// El rol se lee de nuevo por si un administrador lo ha cambiado
+	var role string
+	err = db.DB.QueryRow("SELECT role FROM users WHERE id = ? AND active = 1", userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := Revoke(sessionID); err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrUserInactive
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	newRefreshToken, err := pkg.RandomToken(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+	jti, err := pkg.RandomToken(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Tokens{}, err
+	}
+	defer tx.Rollback()
+
+	// La condición sobre el hash evita que dos peticiones simultáneas cambien el mismo token
+	result, err := tx.Exec(`UPDATE sessions SET refresh_token_hash = ?, previous_token_hash = ?, access_jti = ?,
+		access_expires_at = datetime('now', ?), ip = ?, user_agent = ?, last_used_at = CURRENT_TIMESTAMP, expires_at = datetime('now', ?)
+		WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL`,
+		pkg.HashToken(newRefreshToken), hash, jti, seconds(AccessTTL), ip, userAgent, seconds(RefreshTTL), sessionID, hash)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return Tokens{}, ErrInvalidToken
+	}
+	_, err = tx.Exec("INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)", previousJTI, previousExpiresAt)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Tokens{}, err
+	}
+
+	token, err := pkg.GenerateToken(secret, userID, role, sessionID, jti, AccessTTL)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{Token: token, RefreshToken: newRefreshToken, ExpiresIn: int(AccessTTL.Seconds())}, nil
+}
+
+// Revoke cierra la sesión: su token de refresco deja de valer y su token de acceso se añade a revoked_tokens
+func Revoke(sessionID int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, access_expires_at FROM sessions WHERE id = ? AND revoked_at IS NULL`, sessionID)
+	if err != nil {
+		return fmt.Errorf("error revocando el token de la sesión %d: %w", sessionID, err)
+	}
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", sessionID)
+	if err != nil {
+		return fmt.Errorf("error revocando la sesión %d: %w", sessionID, err)
+	}
+	return tx.Commit()
+}
+
+// RevokeUser cierra todas las sesiones del usuario y devuelve cuántas se han cerrado
+func RevokeUser(userID string) (int64, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := revokeUserTokens(tx, userID); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userID)
+	if err != nil {
+		return 0, fmt.Errorf("error revocando las sesiones del usuario %s: %w", userID, err)
+	}
+	revoked, _ := result.RowsAffected()
+	return revoked, tx.Commit()
+}
+
+// DeleteUserTx borra las sesiones del usuario dentro de la transacción con la que se borra el usuario, sus
+// tokens de acceso se añaden a revoked_tokens para que dejen de valer aunque no hayan caducado
+func DeleteUserTx(tx *sql.Tx, userID string) error {
+	if err := revokeUserTokens(tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error borrando las sesiones del usuario %s: %w", userID, err)
+	}
+	return nil
+}
+
+// revokeUserTokens añade a revoked_tokens los tokens de acceso de las sesiones abiertas del usuario
+func revokeUserTokens(tx *sql.Tx, userID string) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO revoked_tokens (jti, expires_at)
+		SELECT access_jti, access_expires_at FROM sessions WHERE user_id = ? AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("error revocando los tokens del usuario %s: %w", userID, err)
+	}
+	return nil
+}
+
+// List obtiene las sesiones abiertas del usuario, de la usada más recientemente a la que menos
+func List(userID string) ([]models.Session, error) {
+	rows, err := db.DB.Query(`SELECT id, user_id, ip, user_agent, created_at, last_used_at, expires_at FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP ORDER BY last_used_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.IP, &session.UserAgent, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, session)
+	}
+	return list, rows.Err()
+}
+
+// Cada cuánto como mucho se guarda el último uso de una sesión, para no escribir en cada petición
+const touchInterval = time.Minute
+
+var (
+	// touched guarda cuándo se guardó por última vez el uso de cada sesión
+	touched   = map[int64]time.Time{}
+	touchedMu sync.Mutex
+)
+
+// Touch guarda que la sesión se acaba de usar, como mucho una vez cada touchInterval
+func Touch(sessionID int64) error {
+	touchedMu.Lock()
+	if time.Since(touched[sessionID]) < touchInterval {
+		touchedMu.Unlock()
+		return nil
+	}
+	touched[sessionID] = time.Now()
+	touchedMu.Unlock()
+
+	_, err := db.DB.Exec("UPDATE sessions SET last_used_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", sessionID)
+	return err
+}
+
+// IsRevoked indica si el token de acceso con el jti indicado se ha revocado
+func IsRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked)
+	return revoked, err
+}
+
+// Purge borra los tokens revocados que ya han caducado y las sesiones caducadas o revocadas cuyo token de
+// acceso ya no vale, devuelve cuántas filas se han borrado
+func Purge() (int64, error) {
+	result, err := db.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, err
+	}
+	tokens, _ := result.RowsAffected()
+
+	result, err = db.DB.Exec(`DELETE FROM sessions WHERE access_expires_at <= CURRENT_TIMESTAMP
+		AND (expires_at <= CURRENT_TIMESTAMP OR revoked_at IS NOT NULL)`)
+	if err != nil {
+		return tokens, err
+	}
+	sessions, _ := result.RowsAffected()
+
+	// Las sesiones que no se han usado en el último intervalo ya no necesitan la marca de Touch
+	touchedMu.Lock()
+	for id, at := range touched {
+		if time.Since(at) >= touchInterval {
+			delete(touched, id)
+		}
+	}
+	touchedMu.Unlock()
+	return tokens + sessions, nil
+}
+
+// Cada cuánto se borran las sesiones y los tokens revocados caducados
+const purgeInterval = time.Hour
+
+// StartPurger borra periódicamente con Purge las sesiones y los tokens revocados caducados, para que las
+// tablas no crezcan mientras el servidor está en marcha
+func StartPurger() {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for {
+			if purged, err := Purge(); err != nil {
+				log.Println("Error borrando las sesiones caducadas:", err)
+			} else if purged > 0 {
+				log.Printf("Borradas %d sesiones y tokens revocados caducados", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// seconds da formato a una duración para datetime('now', ?) de SQLite
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("+%d seconds", int(d.Seconds()))
+}
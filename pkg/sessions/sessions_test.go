@@ -0,0 +1,227 @@
+package sessions
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"yt-converter-api/db"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// openTestDB usa la base de datos de prueba de db con los usuarios invitados 1 y 2
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db.OpenTestDB(t)
+	_, err := db.DB.Exec("INSERT INTO users (username, password, role) VALUES ('uno', 'x', 'guest'), ('dos', 'x', 'guest')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret = []byte("secreto de prueba")
+	touched = map[int64]time.Time{}
+}
+
+// claims devuelve los claims del token de acceso
+func claims(t *testing.T, token string) jwt.MapClaims {
+	t.Helper()
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	return parsed.Claims.(jwt.MapClaims)
+}
+
+// revoked indica si el jti del token de acceso está revocado
+func revoked(t *testing.T, token string) bool {
+	t.Helper()
+	revoked, err := IsRevoked(claims(t, token)["jti"].(string))
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	return revoked
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	openTestDB(t)
+
+	first, err := Create("1", "guest", "127.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if claims(t, first.Token)["sid"].(float64) != 1 {
+		t.Errorf("se esperaba la sesión 1 en el token, se obtuvo %v", claims(t, first.Token)["sid"])
+	}
+
+	// Un administrador cambia el rol, el token nuevo lo incluye y el anterior deja de valer
+	db.DB.Exec("UPDATE users SET role = 'admin' WHERE id = 1")
+	second, err := Refresh(first.RefreshToken, "127.0.0.2", "curl")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("se esperaba un token de refresco nuevo")
+	}
+	if role := claims(t, second.Token)["role"]; role != "admin" {
+		t.Errorf("se esperaba el rol admin, se obtuvo %v", role)
+	}
+	if !revoked(t, first.Token) || revoked(t, second.Token) {
+		t.Error("se esperaba revocado solo el token de acceso anterior")
+	}
+
+	// Volver a usar el token de refresco anterior cierra la sesión
+	if _, err := Refresh(first.RefreshToken, "127.0.0.3", "curl"); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("se esperaba ErrTokenReused, se obtuvo %v", err)
+	}
+	if !revoked(t, second.Token) {
+		t.Error("se esperaba revocado el token de acceso de la sesión cerrada")
+	}
+	if _, err := Refresh(second.RefreshToken, "127.0.0.2", "curl"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("se esperaba ErrInvalidToken, se obtuvo %v", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	openTestDB(t)
+
+	tokens, err := Create("1", "guest", "127.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if err := Revoke(int64(claims(t, tokens.Token)["sid"].(float64))); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if !revoked(t, tokens.Token) {
+		t.Error("se esperaba revocado el token de acceso")
+	}
+	if _, err := Refresh(tokens.RefreshToken, "127.0.0.1", "curl"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("se esperaba ErrInvalidToken, se obtuvo %v", err)
+	}
+}
+
+func TestRevokeUser(t *testing.T) {
+	openTestDB(t)
+
+	var tokens []Tokens
+	for _, userID := range []string{"1", "1", "2"} {
+		created, err := Create(userID, "guest", "127.0.0.1", "curl")
+		if err != nil {
+			t.Fatalf("error inesperado: %v", err)
+		}
+		tokens = append(tokens, created)
+	}
+	if list, err := List("1"); err != nil || len(list) != 2 {
+		t.Fatalf("List(1) = %d sesiones, %v, se esperaban 2", len(list), err)
+	}
+
+	revokedCount, err := RevokeUser("1")
+	if err != nil || revokedCount != 2 {
+		t.Fatalf("RevokeUser(1) = %d, %v, se esperaban 2", revokedCount, err)
+	}
+	if list, err := List("1"); err != nil || len(list) != 0 {
+		t.Errorf("List(1) = %d sesiones, %v, no se esperaba ninguna", len(list), err)
+	}
+	if !revoked(t, tokens[0].Token) || !revoked(t, tokens[1].Token) || revoked(t, tokens[2].Token) {
+		t.Error("se esperaban revocados solo los tokens del usuario 1")
+	}
+	if list, err := List("2"); err != nil || len(list) != 1 {
+		t.Errorf("List(2) = %d sesiones, %v, se esperaba 1", len(list), err)
+	}
+}
+
+func TestRefreshInactiveUser(t *testing.T) {
+	openTestDB(t)
+
+	tokens, err := Create("1", "guest", "127.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	db.DB.Exec("UPDATE users SET active = 0 WHERE id = 1")
+	if _, err := Refresh(tokens.RefreshToken, "127.0.0.1", "curl"); !errors.Is(err, ErrUserInactive) {
+		t.Fatalf("se esperaba ErrUserInactive, se obtuvo %v", err)
+	}
+	if !revoked(t, tokens.Token) {
+		t.Error("se esperaba revocado el token de acceso")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	openTestDB(t)
+
+	tokens, err := Create("1", "guest", "127.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if err := Revoke(1); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+
+	// Mientras el token de acceso no caduca se conservan la sesión y el jti revocado
+	if purged, err := Purge(); err != nil || purged != 0 {
+		t.Fatalf("Purge() = %d, %v, se esperaba 0", purged, err)
+	}
+	db.DB.Exec("UPDATE sessions SET access_expires_at = datetime('now', '-1 seconds')")
+	db.DB.Exec("UPDATE revoked_tokens SET expires_at = datetime('now', '-1 seconds')")
+	if purged, err := Purge(); err != nil || purged != 2 {
+		t.Fatalf("Purge() = %d, %v, se esperaba 2", purged, err)
+	}
+	if revoked(t, tokens.Token) {
+		t.Error("se esperaba borrado el jti caducado")
+	}
+}
+
+func TestDeleteUserTx(t *testing.T) {
+	openTestDB(t)
+
+	first, _ := Create("1", "guest", "127.0.0.1", "curl")
+	second, _ := Create("2", "guest", "127.0.0.1", "curl")
+	tx, err := db.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteUserTx(tx, "1"); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	db.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = 1").Scan(&count)
+	if count != 0 {
+		t.Errorf("se esperaban borradas las sesiones del usuario 1, quedan %d", count)
+	}
+	if !revoked(t, first.Token) || revoked(t, second.Token) {
+		t.Error("se esperaba revocado solo el token del usuario 1")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	openTestDB(t)
+
+	Create("1", "guest", "127.0.0.1", "curl")
+	lastUsedAt := func() string {
+		var at string
+		db.DB.QueryRow("SELECT last_used_at FROM sessions WHERE id = 1").Scan(&at)
+		return at
+	}
+	db.DB.Exec("UPDATE sessions SET last_used_at = '2000-01-01 00:00:00'")
+	old := lastUsedAt()
+
+	if err := Touch(1); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if lastUsedAt() == old {
+		t.Fatal("se esperaba actualizado el último uso")
+	}
+
+	// Dentro del mismo intervalo no se vuelve a escribir
+	db.DB.Exec("UPDATE sessions SET last_used_at = '2000-01-01 00:00:00'")
+	if err := Touch(1); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if at := lastUsedAt(); at != old {
+		t.Errorf("no se esperaba actualizado el último uso, se obtuvo %s", at)
+	}
+}
@@ -0,0 +1,110 @@
+package sources
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"yt-converter-api/pkg"
+)
+
+// siteHosts son los hosts de cada sitio con proveedor propio, el genérico no los acepta para que
+// deshabilitar un sitio no se pueda saltar con SOURCE_PROVIDERS=generic
+var siteHosts = map[string][]string{
+	ProviderYoutube:    {"youtube.com", "m.youtube.com", "music.youtube.com", "youtu.be", "youtube-nocookie.com"},
+	ProviderVimeo:      {"vimeo.com", "player.vimeo.com"},
+	ProviderSoundCloud: {"soundcloud.com", "m.soundcloud.com", "on.soundcloud.com"},
+}
+
+// Youtube reconoce los videos de YouTube, las listas de reproducción y los canales se tratan aparte
+type Youtube struct{}
+
+func (Youtube) Name() string {
+	return ProviderYoutube
+}
+
+func (Youtube) Parse(u *url.URL) string {
+	if !hostIn(u, siteHosts[ProviderYoutube]...) {
+		return ""
+	}
+	return pkg.GetYoutubeVideoID(u.String())
+}
+
+func (Youtube) URL(externalID string) string {
+	return "https://www.youtube.com/watch?v=" + externalID
+}
+
+// Vimeo reconoce los videos de vimeo.com y del reproductor insertado, el ID es numérico
+type Vimeo struct{}
+
+var vimeoPath = regexp.MustCompile(`^/(?:video/|channels/[^/]+/|groups/[^/]+/videos/|showcase/\d+/video/)?(\d+)/?$`)
+
+func (Vimeo) Name() string {
+	return ProviderVimeo
+}
+
+func (Vimeo) Parse(u *url.URL) string {
+	if !hostIn(u, siteHosts[ProviderVimeo]...) {
+		return ""
+	}
+	if matches := vimeoPath.FindStringSubmatch(u.Path); matches != nil {
+		return matches[1]
+	}
+	return ""
+}
+
+func (Vimeo) URL(externalID string) string {
+	return "https://vimeo.com/" + externalID
+}
+
+// SoundCloud reconoce las pistas (soundcloud.com/<usuario>/<pista>), el ID es la ruta usuario/pista. Los
+// perfiles, las listas (sets) y los enlaces cortos de on.soundcloud.com no se admiten
+type SoundCloud struct{}
+
+var soundCloudPath = regexp.MustCompile(`^/([A-Za-z0-9_-]+)/([A-Za-z0-9_-]+)/?$`)
+
+// Segundas partes de la ruta que son secciones de un perfil y no pistas
+var soundCloudSections = []string{"sets", "tracks", "albums", "popular-tracks", "reposts", "likes", "followers", "following", "comments"}
+
+func (SoundCloud) Name() string {
+	return ProviderSoundCloud
+}
+
+func (SoundCloud) Parse(u *url.URL) string {
+	if !hostIn(u, "soundcloud.com", "m.soundcloud.com") {
+		return ""
+	}
+	matches := soundCloudPath.FindStringSubmatch(u.Path)
+	if matches == nil || slices.Contains(soundCloudSections, strings.ToLower(matches[2])) {
+		return ""
+	}
+	return strings.ToLower(matches[1] + "/" + matches[2])
+}
+
+func (SoundCloud) URL(externalID string) string {
+	return "https://soundcloud.com/" + externalID
+}
+
+// Generic acepta cualquier URL http(s) de un sitio sin proveedor propio y deja a yt-dlp reconocerla, el ID
+// es la URL sin el fragmento
+type Generic struct{}
+
+func (Generic) Name() string {
+	return ProviderGeneric
+}
+
+func (Generic) Parse(u *url.URL) string {
+	for _, hosts := range siteHosts {
+		if hostIn(u, hosts...) {
+			return ""
+		}
+	}
+	normalized := *u
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	return normalized.String()
+}
+
+func (Generic) URL(externalID string) string {
+	return externalID
+}
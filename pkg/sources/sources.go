@@ -0,0 +1,181 @@
+// Package sources reconoce las URLs de los sitios de los que se pueden agregar videos (YouTube, Vimeo,
+// SoundCloud o cualquier sitio que admita yt-dlp) y las convierte en un par (proveedor, ID externo).
+//
+// Los proveedores habilitados se configuran en SOURCE_PROVIDERS y se prueban en orden, el genérico siempre
+// el último. Los videos de YouTube se guardan con su ID como video_id, como antes de existir el resto de
+// proveedores, y los demás como <proveedor>-<ID>.
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"yt-converter-api/config"
+)
+
+// Nombres de los proveedores disponibles
+const (
+	ProviderYoutube    = "youtube"
+	ProviderVimeo      = "vimeo"
+	ProviderSoundCloud = "soundcloud"
+	ProviderGeneric    = "generic"
+)
+
+// ErrUnsupported se devuelve cuando ningún proveedor habilitado reconoce la URL
+var ErrUnsupported = errors.New("la URL no corresponde a ningún sitio habilitado")
+
+// Source identifica un medio en su sitio de origen
+type Source struct {
+	Provider   string `json:"provider"`
+	ExternalID string `json:"external_id"`
+}
+
+// Provider reconoce las URLs de un sitio
+type Provider interface {
+	Name() string
+	// Parse devuelve el ID del medio en el sitio, "" si la URL no es de este proveedor
+	Parse(u *url.URL) string
+	// URL devuelve la dirección del medio a partir de su ID
+	URL(externalID string) string
+}
+
+// providers son todos los proveedores, aunque no estén habilitados se siguen pudiendo descargar los videos
+// que ya se agregaron con ellos
+var providers = map[string]Provider{
+	ProviderYoutube:    Youtube{},
+	ProviderVimeo:      Vimeo{},
+	ProviderSoundCloud: SoundCloud{},
+	ProviderGeneric:    Generic{},
+}
+
+// Current son los proveedores habilitados, se establece con Init
+var Current Registry
+
+// Init habilita los proveedores de SOURCE_PROVIDERS
+func Init(cfg config.Config) error {
+	registry, err := New(cfg.SourceProviders)
+	if err != nil {
+		return err
+	}
+	Current = registry
+	return nil
+}
+
+// New crea un registro con los proveedores indicados separados por comas, el genérico se prueba el último
+// aunque se indique antes
+func New(names string) (Registry, error) {
+	registry := Registry{}
+	generic := false
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		provider, ok := providers[name]
+		if !ok {
+			return nil, fmt.Errorf("proveedor de videos desconocido: %s", name)
+		}
+		if name == ProviderGeneric {
+			generic = true
+			continue
+		}
+		registry = append(registry, provider)
+	}
+	if generic {
+		registry = append(registry, providers[ProviderGeneric])
+	}
+	if len(registry) == 0 {
+		return nil, fmt.Errorf("no hay ningún proveedor de videos habilitado")
+	}
+	return registry, nil
+}
+
+// Registry son los proveedores habilitados en el orden en que se prueban
+type Registry []Provider
+
+func (r Registry) Name() string {
+	names := make([]string, len(r))
+	for i, provider := range r {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Enabled indica si el proveedor está habilitado
+func (r Registry) Enabled(name string) bool {
+	for _, provider := range r {
+		if provider.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse devuelve el medio de la URL con el primer proveedor que la reconoce
+func (r Registry) Parse(rawURL string) (Source, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Source{}, fmt.Errorf("%w: %s", ErrUnsupported, rawURL)
+	}
+	for _, provider := range r {
+		if id := provider.Parse(u); id != "" {
+			return Source{Provider: provider.Name(), ExternalID: id}, nil
+		}
+	}
+	return Source{}, fmt.Errorf("%w: %s", ErrUnsupported, rawURL)
+}
+
+// safeID son los IDs que se pueden usar tal cual en las rutas de la API y en los nombres de carpeta
+var safeID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// VideoID devuelve el video_id con el que se guarda el medio. Los IDs con otros caracteres (las rutas de
+// SoundCloud o las URLs del proveedor genérico) se sustituyen por un resumen SHA-256
+func (s Source) VideoID() string {
+	if s.Provider == ProviderYoutube || s.Provider == "" {
+		return s.ExternalID
+	}
+	id := s.ExternalID
+	if !safeID.MatchString(id) {
+		sum := sha256.Sum256([]byte(id))
+		id = hex.EncodeToString(sum[:8])
+	}
+	return s.Provider + "-" + id
+}
+
+// URL devuelve la dirección del medio en su sitio
+func (s Source) URL() string {
+	provider, ok := providers[s.Provider]
+	if !ok {
+		provider = providers[ProviderYoutube]
+	}
+	return provider.URL(s.ExternalID)
+}
+
+// Ref devuelve cómo se pide el medio a los backends de conversión y a los proveedores de metadatos: el ID
+// en los videos de YouTube, que es lo que esperaban antes de existir el resto de sitios, y la URL en los demás
+func (s Source) Ref() string {
+	if s.Provider == ProviderYoutube || s.Provider == "" {
+		return s.ExternalID
+	}
+	return s.URL()
+}
+
+// IsURLRef indica si la referencia que devuelve Ref es una URL y no un ID de YouTube
+func IsURLRef(ref string) bool {
+	return strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://")
+}
+
+// hostIn indica si el host de la URL, sin www. ni el puerto, es uno de hosts
+func hostIn(u *url.URL, hosts ...string) bool {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, h := range hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package sources
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistryParse(t *testing.T) {
+	registry, err := New("youtube,generic,vimeo,soundcloud")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+
+	tests := []struct {
+		url        string
+		provider   string
+		externalID string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", ProviderYoutube, "dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", ProviderYoutube, "dQw4w9WgXcQ"},
+		{"https://vimeo.com/76979871", ProviderVimeo, "76979871"},
+		{"https://player.vimeo.com/video/76979871?h=abc", ProviderVimeo, "76979871"},
+		{"https://vimeo.com/channels/staffpicks/76979871", ProviderVimeo, "76979871"},
+		{"https://soundcloud.com/Forss/Flickermood", ProviderSoundCloud, "forss/flickermood"},
+		{"https://m.soundcloud.com/forss/flickermood/", ProviderSoundCloud, "forss/flickermood"},
+		{"https://example.com/media/clip.mp4#t=10", ProviderGeneric, "https://example.com/media/clip.mp4"},
+		// Las URLs de los sitios con proveedor propio que este no reconoce no pasan al genérico
+		{"https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", "", ""},
+		{"https://vimeo.com/staffpicks", "", ""},
+		{"https://soundcloud.com/forss/sets", "", ""},
+		{"ftp://example.com/clip.mp4", "", ""},
+		{"no es una url", "", ""},
+	}
+	for _, tt := range tests {
+		source, err := registry.Parse(tt.url)
+		if tt.provider == "" {
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("Parse(%q) = %+v, %v, se esperaba ErrUnsupported", tt.url, source, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): error inesperado: %v", tt.url, err)
+			continue
+		}
+		if source.Provider != tt.provider || source.ExternalID != tt.externalID {
+			t.Errorf("Parse(%q) = %s/%s, se esperaba %s/%s", tt.url, source.Provider, source.ExternalID, tt.provider, tt.externalID)
+		}
+	}
+}
+
+func TestRegistryDisabledProvider(t *testing.T) {
+	registry, err := New("youtube")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if _, err := registry.Parse("https://vimeo.com/76979871"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("se esperaba ErrUnsupported con Vimeo deshabilitado, se obtuvo %v", err)
+	}
+
+	// El genérico tampoco acepta los sitios deshabilitados
+	registry, err = New("generic")
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if _, err := registry.Parse("https://www.youtube.com/watch?v=dQw4w9WgXcQ"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("se esperaba ErrUnsupported con YouTube deshabilitado, se obtuvo %v", err)
+	}
+
+	for _, names := range []string{"", "youtube,dailymotion"} {
+		if _, err := New(names); err == nil {
+			t.Errorf("New(%q): se esperaba un error", names)
+		}
+	}
+}
+
+func TestSourceIDs(t *testing.T) {
+	tests := []struct {
+		source  Source
+		videoID string
+		ref     string
+	}{
+		{Source{ProviderYoutube, "dQw4w9WgXcQ"}, "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{Source{ProviderVimeo, "76979871"}, "vimeo-76979871", "https://vimeo.com/76979871"},
+		{Source{ProviderSoundCloud, "forss/flickermood"}, "soundcloud-94d08ca83ad2c93b", "https://soundcloud.com/forss/flickermood"},
+		{Source{ProviderGeneric, "https://example.com/a"}, "generic-2dce0a4c50441bfc", "https://example.com/a"},
+	}
+	for _, tt := range tests {
+		if got := tt.source.VideoID(); got != tt.videoID {
+			t.Errorf("VideoID(%+v) = %q, se esperaba %q", tt.source, got, tt.videoID)
+		}
+		if got := tt.source.Ref(); got != tt.ref {
+			t.Errorf("Ref(%+v) = %q, se esperaba %q", tt.source, got, tt.ref)
+		}
+	}
+}
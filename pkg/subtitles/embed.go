@@ -0,0 +1,96 @@
+package subtitles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"yt-converter-api/pkg/ffmpeg"
+)
+
+// Track es un archivo de subtítulos que se incrusta en el video
+type Track struct {
+	Path     string // Archivo SRT
+	Language string // Código de idioma de YouTube: en, es-419, pt-BR...
+	Title    string // Nombre que muestran los reproductores
+}
+
+// Códec de subtítulos de cada contenedor que admite subtítulos seleccionables
+var embedCodecs = map[string]string{
+	".mp4": "mov_text",
+	".mkv": "srt",
+}
+
+// Códigos ISO 639-2 de los idiomas más habituales, MP4 y MKV no admiten los códigos de dos letras
+var iso6392 = map[string]string{
+	"ar": "ara", "ca": "cat", "cs": "ces", "da": "dan", "de": "deu", "el": "ell", "en": "eng", "es": "spa",
+	"eu": "eus", "fi": "fin", "fr": "fra", "gl": "glg", "he": "heb", "hi": "hin", "hu": "hun", "id": "ind",
+	"it": "ita", "ja": "jpn", "ko": "kor", "nl": "nld", "no": "nor", "pl": "pol", "pt": "por", "ro": "ron",
+	"ru": "rus", "sv": "swe", "th": "tha", "tr": "tur", "uk": "ukr", "vi": "vie", "zh": "zho",
+}
+
+// CanEmbed indica si se pueden incrustar subtítulos en un archivo con esa extensión (con punto)
+func CanEmbed(extension string) bool {
+	_, ok := embedCodecs[strings.ToLower(extension)]
+	return ok
+}
+
+// languageCode traduce el idioma de YouTube al código ISO 639-2, und si no se conoce
+func languageCode(language string) string {
+	base, _, _ := strings.Cut(strings.ToLower(language), "-")
+	if code, ok := iso6392[base]; ok {
+		return code
+	}
+	if len(base) == 3 {
+		return base
+	}
+	return "und"
+}
+
+// EmbedArgs devuelve los argumentos de ffmpeg para copiar input en output añadiendo las pistas de
+// subtítulos, sin recodificar el audio ni el video
+func EmbedArgs(input string, tracks []Track, output string) ([]string, error) {
+	codec, ok := embedCodecs[strings.ToLower(filepath.Ext(output))]
+	if !ok {
+		return nil, fmt.Errorf("solo se pueden incrustar subtítulos en MP4 o MKV")
+	}
+
+	args := []string{"-i", input}
+	for _, track := range tracks {
+		args = append(args, "-i", track.Path)
+	}
+	args = append(args, "-map", "0:v", "-map", "0:a?")
+	for i := range tracks {
+		args = append(args, "-map", strconv.Itoa(i+1))
+	}
+	args = append(args, "-c", "copy", "-c:s", codec)
+	for i, track := range tracks {
+		stream := "-metadata:s:s:" + strconv.Itoa(i)
+		args = append(args, stream, "language="+languageCode(track.Language))
+		if track.Title != "" {
+			args = append(args, stream, "title="+track.Title)
+		}
+	}
+	return append(args, output), nil
+}
+
+// Embed incrusta los subtítulos en el video, que se reemplaza por el resultado
+func Embed(ctx context.Context, binary string, path string, tracks []Track) error {
+	extension := filepath.Ext(path)
+	output := strings.TrimSuffix(path, extension) + ".subs" + extension
+	args, err := EmbedArgs(path, tracks, output)
+	if err != nil {
+		return err
+	}
+	if err := ffmpeg.Run(ctx, binary, args, 0, nil); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("error al incrustar los subtítulos: %w", err)
+	}
+	if err := os.Rename(output, path); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("error al incrustar los subtítulos: %w", err)
+	}
+	return nil
+}
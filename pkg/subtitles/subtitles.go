@@ -0,0 +1,201 @@
+// Package subtitles lee los subtítulos WebVTT que ofrece YouTube y los convierte a SRT, WebVTT limpio o
+// una transcripción en texto plano. También los incrusta con ffmpeg como subtítulos seleccionables en
+// archivos MP4 y MKV.
+//
+// Los subtítulos automáticos de YouTube repiten en cada cue la línea anterior para que el texto vaya
+// subiendo en pantalla, al leerlos se quitan esas repeticiones y las marcas de tiempo por palabra.
+package subtitles
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formatos a los que se pueden convertir los subtítulos
+const (
+	FormatSRT  = "srt"
+	FormatVTT  = "vtt"
+	FormatText = "txt" // Transcripción sin marcas de tiempo
+)
+
+// Cue es un subtítulo que se muestra entre Start y End
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // Puede tener varias líneas
+}
+
+// Duración mínima de un cue, los automáticos de YouTube incluyen cues de 10 ms que solo repiten el texto
+// anterior
+const minCueDuration = 50 * time.Millisecond
+
+var (
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+	timestampPattern = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})[.,](\d{3})$`)
+)
+
+// Formats devuelve los formatos de salida disponibles
+func Formats() []string {
+	return []string{FormatSRT, FormatVTT, FormatText}
+}
+
+// ValidFormat indica si el formato de salida existe
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatSRT, FormatVTT, FormatText:
+		return true
+	}
+	return false
+}
+
+// ParseVTT lee un archivo WebVTT, quita las etiquetas de formato y las repeticiones de los subtítulos
+// automáticos
+func ParseVTT(data []byte) ([]Cue, error) {
+	content := strings.ReplaceAll(string(bytes.TrimPrefix(data, []byte("\ufeff"))), "\r\n", "\n")
+	if !strings.HasPrefix(content, "WEBVTT") {
+		return nil, fmt.Errorf("el archivo no es WebVTT")
+	}
+
+	var cues []Cue
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		// Los bloques de cabecera, comentarios y estilos no tienen marca de tiempo en las dos primeras líneas
+		timing := -1
+		for i := 0; i < len(lines) && i < 2; i++ {
+			if strings.Contains(lines[i], "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+
+		start, end, err := parseTiming(lines[timing])
+		if err != nil {
+			return nil, err
+		}
+		var text []string
+		for _, line := range lines[timing+1:] {
+			line = strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(line, "")))
+			if line != "" {
+				text = append(text, line)
+			}
+		}
+		cues = append(cues, Cue{Start: start, End: end, Text: strings.Join(text, "\n")})
+	}
+	return dedupe(cues), nil
+}
+
+// parseTiming lee una línea "00:00:01.000 --> 00:00:02.500 align:start position:0%"
+func parseTiming(line string) (time.Duration, time.Duration, error) {
+	startText, rest, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("marca de tiempo no válida: %q", line)
+	}
+	start, err := parseTimestamp(strings.TrimSpace(startText))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseTimestamp lee HH:MM:SS.mmm o MM:SS.mmm
+func parseTimestamp(value string) (time.Duration, error) {
+	match := timestampPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("marca de tiempo no válida: %q", value)
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	millis, _ := strconv.Atoi(match[4])
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond, nil
+}
+
+// dedupe quita los cues vacíos o demasiado cortos y las líneas que repiten el final del cue anterior
+func dedupe(cues []Cue) []Cue {
+	var result []Cue
+	var previous []string
+	for _, cue := range cues {
+		if cue.End-cue.Start < minCueDuration || cue.Text == "" {
+			continue
+		}
+		lines := strings.Split(cue.Text, "\n")
+		for len(lines) > 0 && len(previous) > 0 && lines[0] == previous[len(previous)-1] {
+			lines = lines[1:]
+		}
+		previous = strings.Split(cue.Text, "\n")
+		if len(lines) == 0 {
+			continue
+		}
+		cue.Text = strings.Join(lines, "\n")
+		result = append(result, cue)
+	}
+	return result
+}
+
+// Shift deja los cues que se ven entre start y end, recortados y con el tiempo relativo a start, para los
+// fragmentos de video. Si end es cero no se recorta el final
+func Shift(cues []Cue, start time.Duration, end time.Duration) []Cue {
+	var result []Cue
+	for _, cue := range cues {
+		if cue.End <= start || (end > 0 && cue.Start >= end) {
+			continue
+		}
+		cue.Start = max(cue.Start, start) - start
+		if end > 0 {
+			cue.End = min(cue.End, end)
+		}
+		cue.End -= start
+		result = append(result, cue)
+	}
+	return result
+}
+
+// Convert escribe los cues en el formato indicado
+func Convert(cues []Cue, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatSRT:
+		for i, cue := range cues {
+			fmt.Fprintf(&buf, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, ","), formatTimestamp(cue.End, ","), cue.Text)
+		}
+	case FormatVTT:
+		buf.WriteString("WEBVTT\n\n")
+		for _, cue := range cues {
+			fmt.Fprintf(&buf, "%s --> %s\n%s\n\n", formatTimestamp(cue.Start, "."), formatTimestamp(cue.End, "."), cue.Text)
+		}
+	case FormatText:
+		// Una línea por frase, sin repetir líneas consecutivas iguales
+		var last string
+		for _, cue := range cues {
+			for _, line := range strings.Split(cue.Text, "\n") {
+				if line != last {
+					buf.WriteString(line + "\n")
+					last = line
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("formato de subtítulos no soportado: %s, los disponibles son %s", format, strings.Join(Formats(), ", "))
+	}
+	return buf.Bytes(), nil
+}
+
+// formatTimestamp escribe HH:MM:SS,mmm (SRT) o HH:MM:SS.mmm (WebVTT)
+func formatTimestamp(d time.Duration, separator string) string {
+	millis := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", millis/3_600_000, millis/60_000%60, millis/1000%60, separator, millis%1000)
+}
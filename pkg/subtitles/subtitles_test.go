@@ -0,0 +1,115 @@
+package subtitles
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readCues(t *testing.T, name string) []Cue {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cues, err := ParseVTT(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cues
+}
+
+func TestParseVTT(t *testing.T) {
+	tests := []struct {
+		file string
+		want []Cue
+	}{
+		{"manual.vtt", []Cue{
+			{Start: time.Second, End: 3500 * time.Millisecond, Text: "Hola & bienvenidos"},
+			{Start: 4 * time.Second, End: 6250 * time.Millisecond, Text: "Primera línea\nSegunda línea"},
+			{Start: 62 * time.Second, End: 64 * time.Second, Text: "Sin horas"},
+		}},
+		{"auto.vtt", []Cue{
+			{Start: 80 * time.Millisecond, End: 2270 * time.Millisecond, Text: "we're no strangers to love"},
+			{Start: 2280 * time.Millisecond, End: 5110 * time.Millisecond, Text: "you know the rules"},
+			{Start: 5120 * time.Millisecond, End: 7 * time.Second, Text: "and so do I"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := readCues(t, tt.file); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseVTT() = %+v\nse esperaba  %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseVTT([]byte("1\n00:00:01,000 --> 00:00:02,000\nSRT")); err == nil {
+		t.Error("se esperaba un error con un archivo que no es WebVTT")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cues := readCues(t, "manual.vtt")
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatSRT, "1\n00:00:01,000 --> 00:00:03,500\nHola & bienvenidos\n\n2\n00:00:04,000 --> 00:00:06,250\nPrimera línea\nSegunda línea\n\n3\n00:01:02,000 --> 00:01:04,000\nSin horas\n\n"},
+		{FormatVTT, "WEBVTT\n\n00:00:01.000 --> 00:00:03.500\nHola & bienvenidos\n\n00:00:04.000 --> 00:00:06.250\nPrimera línea\nSegunda línea\n\n00:01:02.000 --> 00:01:04.000\nSin horas\n\n"},
+		{FormatText, "Hola & bienvenidos\nPrimera línea\nSegunda línea\nSin horas\n"},
+	}
+	for _, tt := range tests {
+		got, err := Convert(cues, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Convert(%s) = %q\nse esperaba    %q", tt.format, got, tt.want)
+		}
+	}
+	if _, err := Convert(cues, "ass"); err == nil {
+		t.Error("se esperaba un error con un formato no soportado")
+	}
+}
+
+func TestShift(t *testing.T) {
+	cues := readCues(t, "manual.vtt")
+	got := Shift(cues, 2*time.Second, 5*time.Second)
+	want := []Cue{
+		{Start: 0, End: 1500 * time.Millisecond, Text: "Hola & bienvenidos"},
+		{Start: 2 * time.Second, End: 3 * time.Second, Text: "Primera línea\nSegunda línea"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Shift() = %+v\nse esperaba %+v", got, want)
+	}
+}
+
+func TestEmbedArgs(t *testing.T) {
+	tracks := []Track{
+		{Path: "en.srt", Language: "en", Title: "English"},
+		{Path: "es.srt", Language: "es-419", Title: "Español (Latinoamérica)"},
+		{Path: "xx.srt", Language: "xx"},
+	}
+
+	args, err := EmbedArgs("in.mp4", tracks, "out.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-i in.mp4 -i en.srt -i es.srt -i xx.srt -map 0:v -map 0:a? -map 1 -map 2 -map 3 -c copy -c:s mov_text " +
+		"-metadata:s:s:0 language=eng -metadata:s:s:0 title=English -metadata:s:s:1 language=spa " +
+		"-metadata:s:s:1 title=Español (Latinoamérica) -metadata:s:s:2 language=und out.mp4"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("EmbedArgs() = %s\nse esperaba    %s", got, want)
+	}
+
+	if args, _ := EmbedArgs("in.mkv", tracks[:1], "out.mkv"); !slices.Contains(args, "srt") {
+		t.Errorf("MKV debería usar el códec srt: %v", args)
+	}
+	if _, err := EmbedArgs("in.webm", tracks, "out.webm"); err == nil {
+		t.Error("se esperaba un error con WebM")
+	}
+}
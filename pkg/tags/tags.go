@@ -0,0 +1,257 @@
+// Package tags escribe con ffmpeg las etiquetas (ID3 en MP3, átomos MP4 en M4A y Vorbis comments en Opus)
+// y la carátula en los archivos de audio generados.
+//
+// Las etiquetas salen de los metadatos guardados del video (título, canal, fecha de subida y URL) y se
+// pueden reemplazar en la solicitud de procesamiento. La carátula es la miniatura del video.
+package tags
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/ffmpeg"
+	"yt-converter-api/pkg/sources"
+)
+
+// Tags son las etiquetas que se escriben en el archivo, las vacías no se escriben
+type Tags struct {
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Date   string `json:"date,omitempty"`  // YYYY o YYYY-MM-DD
+	URL    string `json:"url,omitempty"`   // Se guarda en el comentario y en purl
+	Track  string `json:"track,omitempty"` // Número de pista, por ejemplo 3/12
+}
+
+// Tamaño máximo de la carátula que se descarga
+const maxCoverSize = 5 << 20
+
+// Las carátulas de Opus van codificadas en base64 en un argumento de ffmpeg, Linux limita cada argumento a
+// 128 KiB
+const maxOpusCoverSize = 90 << 10
+
+var datePattern = regexp.MustCompile(`^\d{4}(-\d{2}-\d{2})?$`)
+
+// FromVideo devuelve las etiquetas por defecto de un video: el título como título y álbum, el canal como
+// artista, la fecha de subida y la URL del video
+func FromVideo(video models.Video) Tags {
+	return Tags{
+		Title:  video.Title,
+		Artist: video.ChannelName,
+		Album:  video.Title,
+		Date:   video.UploadDate,
+		URL:    videoURL(video),
+	}
+}
+
+// videoURL devuelve la dirección del video en su sitio de origen, los videos sin proveedor son de YouTube
+func videoURL(video models.Video) string {
+	source := sources.Source{Provider: video.Provider, ExternalID: video.ExternalID}
+	if source.ExternalID == "" {
+		source.ExternalID = video.VideoID
+	}
+	return source.URL()
+}
+
+// Merge devuelve las etiquetas con los campos no vacíos de overrides reemplazados
+func (t Tags) Merge(overrides Tags) Tags {
+	for _, field := range []struct{ dst, src *string }{
+		{&t.Title, &overrides.Title},
+		{&t.Artist, &overrides.Artist},
+		{&t.Album, &overrides.Album},
+		{&t.Date, &overrides.Date},
+		{&t.URL, &overrides.URL},
+		{&t.Track, &overrides.Track},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	return t
+}
+
+// Validate comprueba el formato de la fecha
+func (t Tags) Validate() error {
+	if t.Date != "" && !datePattern.MatchString(t.Date) {
+		return fmt.Errorf("la fecha de las etiquetas debe tener el formato YYYY o YYYY-MM-DD")
+	}
+	return nil
+}
+
+// Key devuelve un hash corto de las etiquetas para distinguir en la clave de la variante los audios con
+// etiquetas distintas
+func (t Tags) Key() string {
+	data, _ := json.Marshal(t)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4])
+}
+
+// Supported indica si se escriben etiquetas en los archivos con esa extensión (con punto)
+func Supported(extension string) bool {
+	switch strings.ToLower(extension) {
+	case ".mp3", ".m4a", ".opus":
+		return true
+	}
+	return false
+}
+
+// metadata devuelve las etiquetas como pares clave=valor de ffmpeg
+func (t Tags) metadata() []string {
+	var pairs []string
+	for _, tag := range [][2]string{
+		{"title", t.Title},
+		{"artist", t.Artist},
+		{"album", t.Album},
+		{"date", t.Date},
+		{"track", t.Track},
+		{"comment", t.URL},
+		{"purl", t.URL},
+	} {
+		if tag[1] != "" {
+			pairs = append(pairs, tag[0]+"="+tag[1])
+		}
+	}
+	return pairs
+}
+
+// Args devuelve los argumentos de ffmpeg para copiar input en output con las etiquetas y, si cover no está
+// vacío, la carátula guardada en esa ruta. En Opus la carátula va en la etiqueta METADATA_BLOCK_PICTURE
+// (picture, su contenido ya codificado) porque el contenedor Ogg no admite imágenes adjuntas
+func (t Tags) Args(input string, cover string, picture string, output string) []string {
+	extension := strings.ToLower(filepath.Ext(output))
+	args := []string{"-i", input}
+	if cover != "" && extension != ".opus" {
+		args = append(args, "-i", cover, "-map", "0:a", "-map", "1:0", "-c", "copy", "-disposition:v:0", "attached_pic")
+		if extension == ".mp3" {
+			args = append(args, "-id3v2_version", "3", "-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)")
+		}
+	} else {
+		args = append(args, "-map", "0:a", "-c", "copy")
+	}
+
+	// Ogg guarda las etiquetas en el stream de audio, MP3 y M4A en el archivo
+	flag := "-metadata"
+	if extension == ".opus" {
+		flag = "-metadata:s:a:0"
+	}
+	for _, pair := range t.metadata() {
+		args = append(args, flag, pair)
+	}
+	if picture != "" && extension == ".opus" {
+		args = append(args, flag, "METADATA_BLOCK_PICTURE="+picture)
+	}
+	return append(args, output)
+}
+
+// Embed escribe las etiquetas y la carátula (JPEG o PNG, se ignora si está vacía) en el archivo de audio,
+// que se reemplaza por el etiquetado. Los formatos sin soporte se dejan como están
+func Embed(ctx context.Context, binary string, path string, tags Tags, cover []byte) error {
+	extension := filepath.Ext(path)
+	if !Supported(extension) {
+		return nil
+	}
+
+	var coverPath, picture string
+	if len(cover) > 0 {
+		if strings.EqualFold(extension, ".opus") {
+			if len(cover) <= maxOpusCoverSize {
+				picture = pictureBlock(cover)
+			}
+		} else {
+			coverPath = strings.TrimSuffix(path, extension) + ".cover" + coverExtension(cover)
+			if err := os.WriteFile(coverPath, cover, 0644); err != nil {
+				return fmt.Errorf("error al guardar la carátula: %w", err)
+			}
+			defer os.Remove(coverPath)
+		}
+	}
+
+	output := strings.TrimSuffix(path, extension) + ".tagged" + extension
+	if err := ffmpeg.Run(ctx, binary, tags.Args(path, coverPath, picture, output), 0, nil); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("error al escribir las etiquetas: %w", err)
+	}
+	if err := os.Rename(output, path); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("error al escribir las etiquetas: %w", err)
+	}
+	return nil
+}
+
+// FetchCover descarga la carátula, solo se aceptan imágenes JPEG o PNG
+func FetchCover(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al descargar la carátula: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("la carátula respondió con el código de estado %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error al descargar la carátula: %v", err)
+	}
+	if len(data) > maxCoverSize {
+		return nil, fmt.Errorf("la carátula ocupa más de %d MB", maxCoverSize>>20)
+	}
+	if coverExtension(data) == "" {
+		return nil, fmt.Errorf("la carátula no es una imagen JPEG o PNG")
+	}
+	return data, nil
+}
+
+// coverExtension devuelve la extensión de la imagen según su contenido, vacía si no es JPEG ni PNG
+func coverExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	}
+	return ""
+}
+
+// pictureBlock codifica la carátula como un bloque PICTURE de FLAC en base64, el formato que usan los
+// Vorbis comments para las imágenes
+func pictureBlock(cover []byte) string {
+	mime := http.DetectContentType(cover)
+	var width, height int
+	if config, _, err := image.DecodeConfig(bytes.NewReader(cover)); err == nil {
+		width, height = config.Width, config.Height
+	}
+
+	var block bytes.Buffer
+	write := func(value uint32) { binary.Write(&block, binary.BigEndian, value) }
+	write(3) // Portada
+	write(uint32(len(mime)))
+	block.WriteString(mime)
+	write(0) // Sin descripción
+	write(uint32(width))
+	write(uint32(height))
+	write(24) // Profundidad de color
+	write(0)  // Sin paleta
+	write(uint32(len(cover)))
+	block.Write(cover)
+	return base64.StdEncoding.EncodeToString(block.Bytes())
+}
@@ -0,0 +1,175 @@
+package tags
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yt-converter-api/models"
+)
+
+// testCover devuelve un PNG de 4x2
+func testCover(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFromVideoAndMerge(t *testing.T) {
+	tags := FromVideo(models.Video{VideoID: "abc", Title: "Mix", ChannelName: "Canal", UploadDate: "2024-05-01"})
+	want := Tags{Title: "Mix", Artist: "Canal", Album: "Mix", Date: "2024-05-01", URL: "https://www.youtube.com/watch?v=abc"}
+	if tags != want {
+		t.Errorf("FromVideo() = %+v", tags)
+	}
+
+	vimeo := FromVideo(models.Video{VideoID: "vimeo-76979871", Provider: "vimeo", ExternalID: "76979871"})
+	if vimeo.URL != "https://vimeo.com/76979871" {
+		t.Errorf("FromVideo().URL = %q, se esperaba la URL de Vimeo", vimeo.URL)
+	}
+
+	merged := tags.Merge(Tags{Artist: "Otro artista", Date: "2020"})
+	if merged.Artist != "Otro artista" || merged.Date != "2020" || merged.Title != "Mix" {
+		t.Errorf("Merge() = %+v", merged)
+	}
+
+	for _, date := range []string{"2020", "2020-01-31", ""} {
+		if err := (Tags{Date: date}).Validate(); err != nil {
+			t.Errorf("Validate(%q): error inesperado %v", date, err)
+		}
+	}
+	for _, date := range []string{"20", "2020/01/31", "2020-1-3"} {
+		if err := (Tags{Date: date}).Validate(); err == nil {
+			t.Errorf("Validate(%q): se esperaba un error", date)
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	tags := Tags{Title: "Mix", Artist: "Canal", URL: "https://youtu.be/abc"}
+
+	tests := []struct {
+		name    string
+		cover   string
+		picture string
+		output  string
+		want    string
+	}{
+		{"mp3 con carátula", "cover.jpg", "", "out.mp3", "-i in -i cover.jpg -map 0:a -map 1:0 -c copy -disposition:v:0 attached_pic -id3v2_version 3 -metadata:s:v title=Album cover -metadata:s:v comment=Cover (front) -metadata title=Mix -metadata artist=Canal -metadata comment=https://youtu.be/abc -metadata purl=https://youtu.be/abc out.mp3"},
+		{"m4a con carátula", "cover.png", "", "out.m4a", "-i in -i cover.png -map 0:a -map 1:0 -c copy -disposition:v:0 attached_pic -metadata title=Mix -metadata artist=Canal -metadata comment=https://youtu.be/abc -metadata purl=https://youtu.be/abc out.m4a"},
+		{"mp3 sin carátula", "", "", "out.mp3", "-i in -map 0:a -c copy -metadata title=Mix -metadata artist=Canal -metadata comment=https://youtu.be/abc -metadata purl=https://youtu.be/abc out.mp3"},
+		{"opus con carátula", "", "QUJD", "out.opus", "-i in -map 0:a -c copy -metadata:s:a:0 title=Mix -metadata:s:a:0 artist=Canal -metadata:s:a:0 comment=https://youtu.be/abc -metadata:s:a:0 purl=https://youtu.be/abc -metadata:s:a:0 METADATA_BLOCK_PICTURE=QUJD out.opus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tags.Args("in", tt.cover, tt.picture, tt.output), " "); got != tt.want {
+				t.Errorf("Args() = %s\nse esperaba   %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPictureBlock(t *testing.T) {
+	cover := testCover(t)
+	block, err := base64.StdEncoding.DecodeString(pictureBlock(cover))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tipo, mime, descripción, ancho, alto, profundidad, paleta, imagen
+	read := func() uint32 {
+		value := binary.BigEndian.Uint32(block)
+		block = block[4:]
+		return value
+	}
+	if kind := read(); kind != 3 {
+		t.Errorf("tipo = %d, se esperaba 3", kind)
+	}
+	mime := string(block[:read()])
+	block = block[len(mime):]
+	if mime != "image/png" {
+		t.Errorf("mime = %s", mime)
+	}
+	read()
+	if width, height := read(), read(); width != 4 || height != 2 {
+		t.Errorf("tamaño = %dx%d, se esperaba 4x2", width, height)
+	}
+	read()
+	read()
+	if size := read(); int(size) != len(cover) || !bytes.Equal(block, cover) {
+		t.Errorf("la imagen no coincide")
+	}
+}
+
+func TestEmbedAndFetchCover(t *testing.T) {
+	dir := t.TempDir()
+	cover := testCover(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cover.png":
+			w.Write(cover)
+		case "/page":
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetched, err := FetchCover(context.Background(), server.Client(), server.URL+"/cover.png")
+	if err != nil || !bytes.Equal(fetched, cover) {
+		t.Fatalf("FetchCover() = %d bytes, %v", len(fetched), err)
+	}
+	for _, path := range []string{"/page", "/missing"} {
+		if _, err := FetchCover(context.Background(), server.Client(), server.URL+path); err == nil {
+			t.Errorf("FetchCover(%s): se esperaba un error", path)
+		}
+	}
+
+	// ffmpeg falso: guarda los argumentos y copia la entrada en la salida (último argumento)
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args.txt") + `"
+for arg; do
+	[ "$prev" = "-i" ] && [ -z "$input" ] && input=$arg
+	prev=$arg
+done
+cp "$input" "$arg"
+`
+	if err := os.WriteFile(fakeFFmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	audio := filepath.Join(dir, "abc.mp3")
+	os.WriteFile(audio, []byte("audio"), 0644)
+	if err := Embed(context.Background(), fakeFFmpeg, audio, Tags{Title: "Mix"}, fetched); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args.txt"))
+	if !strings.Contains(string(args), "abc.cover.png") || !strings.Contains(string(args), "title=Mix") {
+		t.Errorf("argumentos = %s", args)
+	}
+	if data, _ := os.ReadFile(audio); string(data) != "audio" {
+		t.Errorf("contenido = %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("quedan archivos temporales: %v", entries)
+	}
+
+	// Los formatos sin etiquetas no llaman a ffmpeg
+	wav := filepath.Join(dir, "abc.wav")
+	if err := Embed(context.Background(), filepath.Join(dir, "missing"), wav, Tags{Title: "Mix"}, nil); err != nil {
+		t.Errorf("error inesperado con wav: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package thumbnails
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"yt-converter-api/pkg/ffmpeg"
+)
+
+// La hoja de contactos tiene sheetColumns x sheetRows fotogramas repartidos por todo el video
+const (
+	sheetColumns = 4
+	sheetRows    = 4
+	sheetWidth   = 320 // Ancho de cada fotograma
+)
+
+// La vista previa muestra previewFrames fotogramas repartidos por todo el video a previewFPS por segundo
+const (
+	previewFrames = 24
+	previewFPS    = 4
+	previewWidth  = 320
+)
+
+// samplingRate devuelve el filtro fps que toma frames fotogramas repartidos en duration segundos
+func samplingRate(frames int, duration float64) string {
+	return "fps=" + strconv.Itoa(frames) + "/" + strconv.FormatFloat(duration, 'f', 3, 64)
+}
+
+// SheetArgs devuelve los argumentos de ffmpeg para generar la hoja de contactos del video input, de
+// duration segundos, en output (JPEG)
+func SheetArgs(input string, duration float64, output string) []string {
+	filter := fmt.Sprintf("%s,scale=%d:-2,tile=%dx%d", samplingRate(sheetColumns*sheetRows, duration), sheetWidth, sheetColumns, sheetRows)
+	return []string{"-i", input, "-vf", filter, "-frames:v", "1", "-q:v", "3", output}
+}
+
+// PreviewArgs devuelve los argumentos de ffmpeg para generar la vista previa animada del video input, de
+// duration segundos, en output (GIF). La paleta se calcula a partir de los propios fotogramas
+func PreviewArgs(input string, duration float64, output string) []string {
+	filter := fmt.Sprintf("%s,scale=%d:-2:flags=lanczos,setpts=N/%d/TB,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+		samplingRate(previewFrames, duration), previewWidth, previewFPS)
+	return []string{"-i", input, "-an", "-filter_complex", filter, "-r", strconv.Itoa(previewFPS), "-loop", "0", output}
+}
+
+// Generate genera la hoja de contactos y la vista previa animada del video input en dir, reemplazando las
+// anteriores
+func Generate(ctx context.Context, binary string, input string, duration float64, dir string) error {
+	if duration <= 0 {
+		return fmt.Errorf("se necesita la duración del video para generar la vista previa")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error al crear la carpeta de las miniaturas: %v", err)
+	}
+
+	outputs := []struct {
+		kind string
+		args func(string, float64, string) []string
+		ext  string
+	}{
+		{KindSheet, SheetArgs, ".jpg"},
+		{KindPreview, PreviewArgs, ".gif"},
+	}
+	for _, output := range outputs {
+		path := filepath.Join(dir, output.kind+output.ext)
+		// ffmpeg elige el formato por la extensión, el temporal la conserva
+		temp := filepath.Join(dir, output.kind+".tmp"+output.ext)
+		if err := ffmpeg.Run(ctx, binary, output.args(input, duration, temp), 0, nil); err != nil {
+			os.Remove(temp)
+			return fmt.Errorf("error al generar %s: %w", output.kind, err)
+		}
+		if err := os.Rename(temp, path); err != nil {
+			os.Remove(temp)
+			return fmt.Errorf("error al generar %s: %w", output.kind, err)
+		}
+		removeResized(dir, output.kind)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package thumbnails guarda localmente las miniaturas de los videos de YouTube para no enlazar i.ytimg.com
+// desde el frontend, genera sus versiones reducidas bajo demanda y, a partir de los videos procesados, una
+// hoja de contactos y una vista previa animada con ffmpeg.
+//
+// Cada video tiene su carpeta en <StoragePath>/thumbnails/<video_id> con la miniatura original
+// (thumbnail.jpg), la hoja de contactos (sheet.jpg), la vista previa (preview.gif) y las versiones
+// reducidas (thumbnail-small.jpg, sheet-medium.jpg...).
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Tipos de imagen de un video
+const (
+	KindThumbnail = "thumbnail" // Miniatura de YouTube
+	KindSheet     = "sheet"     // Hoja de contactos con fotogramas de todo el video
+	KindPreview   = "preview"   // GIF animado con fotogramas de todo el video
+)
+
+// Tamaños de las imágenes, large es la imagen original
+const (
+	SizeSmall  = "small"
+	SizeMedium = "medium"
+	SizeLarge  = "large"
+)
+
+// Ancho en píxeles de cada tamaño reducido
+var sizeWidths = map[string]int{
+	SizeSmall:  320,
+	SizeMedium: 640,
+}
+
+// Tamaño máximo de una miniatura descargada
+const maxThumbnailSize = 5 << 20
+
+// Calidad de los JPEG que se generan
+const jpegQuality = 85
+
+// ErrNotFound indica que la imagen pedida no se ha guardado o generado
+var ErrNotFound = errors.New("la imagen no existe")
+
+// Kinds devuelve los tipos de imagen disponibles
+func Kinds() []string {
+	return []string{KindThumbnail, KindSheet, KindPreview}
+}
+
+// Sizes devuelve los tamaños disponibles
+func Sizes() []string {
+	return []string{SizeSmall, SizeMedium, SizeLarge}
+}
+
+// Dir devuelve la carpeta de las imágenes de un video
+func Dir(storagePath string, videoID string) string {
+	return filepath.Join(storagePath, "thumbnails", videoID)
+}
+
+// Candidates devuelve las URLs de la miniatura de mayor a menor resolución. YouTube no genera
+// maxresdefault ni sddefault para todos los videos, thumbnailURL es la de los metadatos del video. Los
+// videos de otros sitios (youtubeID vacío) solo tienen la de los metadatos
+func Candidates(youtubeID string, thumbnailURL string) []string {
+	var urls []string
+	if youtubeID != "" {
+		urls = []string{
+			fmt.Sprintf("https://i.ytimg.com/vi/%s/maxresdefault.jpg", youtubeID),
+			fmt.Sprintf("https://i.ytimg.com/vi/%s/sddefault.jpg", youtubeID),
+			fmt.Sprintf("https://i.ytimg.com/vi/%s/hqdefault.jpg", youtubeID),
+		}
+	}
+	if thumbnailURL != "" && !slices.Contains(urls, thumbnailURL) {
+		urls = append(urls, thumbnailURL)
+	}
+	return urls
+}
+
+// Fetch descarga la primera miniatura disponible de urls, solo se aceptan imágenes JPEG o PNG
+func Fetch(ctx context.Context, client *http.Client, urls []string) ([]byte, error) {
+	var lastErr error
+	for _, url := range urls {
+		data, err := fetch(ctx, client, url)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no hay direcciones de la miniatura")
+	}
+	return nil, lastErr
+}
+
+// fetch descarga una miniatura
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al descargar la miniatura: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("la miniatura %s respondió con el código de estado %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxThumbnailSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error al descargar la miniatura: %v", err)
+	}
+	if len(data) > maxThumbnailSize {
+		return nil, fmt.Errorf("la miniatura ocupa más de %d MB", maxThumbnailSize>>20)
+	}
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png":
+		return data, nil
+	}
+	return nil, fmt.Errorf("la miniatura %s no es una imagen JPEG o PNG", url)
+}
+
+// Save guarda la miniatura original del video en dir como JPEG y borra las versiones reducidas anteriores
+func Save(dir string, data []byte) error {
+	if http.DetectContentType(data) != "image/jpeg" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("la miniatura no es una imagen válida: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	if err := writeFile(filepath.Join(dir, KindThumbnail+".jpg"), data); err != nil {
+		return err
+	}
+	removeResized(dir, KindThumbnail)
+	return nil
+}
+
+// Ensure devuelve la miniatura original del video, descargándola de la primera de urls disponible y
+// guardándola si todavía no existe
+func Ensure(ctx context.Context, client *http.Client, storagePath string, videoID string, urls []string) (string, error) {
+	dir := Dir(storagePath, videoID)
+	path := filepath.Join(dir, KindThumbnail+".jpg")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	data, err := Fetch(ctx, client, urls)
+	if err != nil {
+		return "", err
+	}
+	if err := Save(dir, data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Path devuelve el archivo de la imagen de ese tipo y tamaño, generando la versión reducida si no existe.
+// Devuelve ErrNotFound si la imagen original no se ha guardado o generado
+func Path(dir string, kind string, size string) (string, error) {
+	extension := ".jpg"
+	switch kind {
+	case KindThumbnail, KindSheet:
+	case KindPreview:
+		if size != SizeLarge {
+			return "", fmt.Errorf("la vista previa solo está disponible en tamaño %s", SizeLarge)
+		}
+		extension = ".gif"
+	default:
+		return "", fmt.Errorf("tipo de imagen no soportado: %s, los disponibles son %s", kind, strings.Join(Kinds(), ", "))
+	}
+
+	original := filepath.Join(dir, kind+extension)
+	if _, err := os.Stat(original); err != nil {
+		return "", ErrNotFound
+	}
+	if size == SizeLarge {
+		return original, nil
+	}
+	width, ok := sizeWidths[size]
+	if !ok {
+		return "", fmt.Errorf("tamaño no soportado: %s, los disponibles son %s", size, strings.Join(Sizes(), ", "))
+	}
+
+	path := filepath.Join(dir, kind+"-"+size+extension)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := resizeFile(original, path, width); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// resizeFile guarda en output la imagen de input reducida al ancho indicado
+func resizeFile(input string, output string, width int) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("error al leer la imagen %s: %v", filepath.Base(input), err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Resize(img, width), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return err
+	}
+	return writeFile(output, buf.Bytes())
+}
+
+// removeResized borra las versiones reducidas de un tipo de imagen, se vuelven a generar al pedirlas
+func removeResized(dir string, kind string) {
+	for size := range sizeWidths {
+		os.Remove(filepath.Join(dir, kind+"-"+size+".jpg"))
+	}
+}
+
+// writeFile escribe el archivo de forma atómica para no servir nunca una imagen a medias
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error al crear la carpeta de las miniaturas: %v", err)
+	}
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("error al guardar la imagen: %v", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("error al guardar la imagen: %v", err)
+	}
+	return nil
+}
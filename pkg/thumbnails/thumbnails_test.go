@@ -0,0 +1,172 @@
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testImage devuelve una imagen con la mitad izquierda negra y la derecha blanca
+func testImage(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x >= width/2 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, img image.Image, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name                  string
+		width, height         int
+		target                int
+		wantWidth, wantHeight int
+	}{
+		{"mitad", 1280, 720, 640, 640, 360},
+		{"no divisible", 1000, 750, 320, 320, 240},
+		{"más pequeña", 120, 90, 320, 120, 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resize(testImage(tt.width, tt.height), tt.target).Bounds()
+			if got.Dx() != tt.wantWidth || got.Dy() != tt.wantHeight {
+				t.Errorf("Resize() = %dx%d, se esperaba %dx%d", got.Dx(), got.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+
+	// La media conserva los colores de cada mitad
+	resized := Resize(testImage(8, 2), 2)
+	if r, _, _, _ := resized.At(0, 0).RGBA(); r != 0 {
+		t.Errorf("se esperaba negro a la izquierda, r = %d", r)
+	}
+	if r, _, _, _ := resized.At(1, 0).RGBA(); r != 0xffff {
+		t.Errorf("se esperaba blanco a la derecha, r = %d", r)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	jpg := encode(t, testImage(16, 9), "jpeg")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hq.jpg":
+			w.Write(jpg)
+		case "/text":
+			w.Write([]byte("no es una imagen"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	data, err := Fetch(context.Background(), server.Client(), []string{server.URL + "/maxres.jpg", server.URL + "/text", server.URL + "/hq.jpg"})
+	if err != nil || !bytes.Equal(data, jpg) {
+		t.Fatalf("Fetch() = %d bytes, %v", len(data), err)
+	}
+	if _, err := Fetch(context.Background(), server.Client(), []string{server.URL + "/maxres.jpg", server.URL + "/text"}); err == nil {
+		t.Error("se esperaba un error sin ninguna miniatura válida")
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	urls := Candidates("abc", "https://i.ytimg.com/vi/abc/hqdefault.jpg")
+	if len(urls) != 3 || !strings.HasSuffix(urls[0], "/abc/maxresdefault.jpg") {
+		t.Errorf("Candidates() = %v", urls)
+	}
+	if urls := Candidates("abc", "https://example.com/thumb.png"); len(urls) != 4 || urls[3] != "https://example.com/thumb.png" {
+		t.Errorf("Candidates() = %v, se esperaba la miniatura de los metadatos al final", urls)
+	}
+	if urls := Candidates("", "https://example.com/thumb.png"); len(urls) != 1 {
+		t.Errorf("Candidates() = %v, se esperaba solo la miniatura de los metadatos", urls)
+	}
+}
+
+func TestSaveAndPath(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Path(dir, KindThumbnail, SizeLarge); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("se esperaba ErrNotFound sin miniatura, error = %v", err)
+	}
+
+	// Los PNG se guardan como JPEG
+	if err := Save(dir, encode(t, testImage(1280, 720), "png")); err != nil {
+		t.Fatal(err)
+	}
+	original, err := Path(dir, KindThumbnail, SizeLarge)
+	if err != nil || original != filepath.Join(dir, "thumbnail.jpg") {
+		t.Fatalf("Path() = %s, %v", original, err)
+	}
+
+	small, err := Path(dir, KindThumbnail, SizeSmall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	config, format, err := image.DecodeConfig(file)
+	if err != nil || format != "jpeg" || config.Width != 320 || config.Height != 180 {
+		t.Errorf("miniatura small = %s %dx%d, %v", format, config.Width, config.Height, err)
+	}
+
+	// Al guardar otra miniatura se borran las versiones reducidas
+	if err := Save(dir, encode(t, testImage(640, 480), "jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(small); !os.IsNotExist(err) {
+		t.Error("se esperaba que se borrara la versión reducida anterior")
+	}
+
+	for _, tt := range []struct{ kind, size string }{{"poster", SizeLarge}, {KindThumbnail, "huge"}, {KindPreview, SizeSmall}} {
+		if _, err := Path(dir, tt.kind, tt.size); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Path(%s, %s): se esperaba un error de validación, error = %v", tt.kind, tt.size, err)
+		}
+	}
+}
+
+func TestPreviewArgs(t *testing.T) {
+	sheet := strings.Join(SheetArgs("in.mp4", 212, "sheet.jpg"), " ")
+	if want := "-i in.mp4 -vf fps=16/212.000,scale=320:-2,tile=4x4 -frames:v 1 -q:v 3 sheet.jpg"; sheet != want {
+		t.Errorf("SheetArgs() = %s\nse esperaba    %s", sheet, want)
+	}
+	preview := strings.Join(PreviewArgs("in.mp4", 30.5, "preview.gif"), " ")
+	if !strings.Contains(preview, "fps=24/30.500,scale=320:-2:flags=lanczos,setpts=N/4/TB") || !strings.HasSuffix(preview, "-r 4 -loop 0 preview.gif") {
+		t.Errorf("PreviewArgs() = %s", preview)
+	}
+	if err := Generate(context.Background(), "ffmpeg", "in.mp4", 0, t.TempDir()); err == nil {
+		t.Error("se esperaba un error sin duración")
+	}
+}
@@ -1,6 +1,10 @@
 package pkg
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
@@ -10,20 +14,18 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Tiempo de expiración del token
-const TokenExpiration = time.Hour * 24
-
-func GenerateToken(id string, role string) (string, error) {
-	// Convertir la clave JWT a bytes
-	secret := []byte(config.LoadConfig().JwtSecret)
-
+// GenerateToken firma un token de acceso del usuario que caduca en ttl. sessionID y jti identifican la
+// sesión y el token para poder revocarlos (pkg/sessions)
+func GenerateToken(secret []byte, id string, role string, sessionID int64, jti string, ttl time.Duration) (string, error) {
 	// Tiempo actual y expiración
 	now := time.Now()
-	expirationTime := now.Add(TokenExpiration)
+	expirationTime := now.Add(ttl)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": id,
 		"role":    role,
+		"sid":     sessionID,             // Sesión
+		"jti":     jti,                   // Identificador del token
 		"iat":     now.Unix(),            // Emitido en
 		"exp":     expirationTime.Unix(), // Expira en
 	})
@@ -76,3 +78,18 @@ func GetUserFromToken(tokenString string) (string, string, error) {
 
 	return "", "", jwt.ErrSignatureInvalid
 }
+
+// RandomToken genera un token aleatorio de size bytes codificado en base64 para URLs
+func RandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generando el token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken devuelve el hash SHA-256 con el que se guardan los tokens de refresco y las API keys
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
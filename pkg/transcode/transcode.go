@@ -0,0 +1,211 @@
+// Package transcode recodifica con ffmpeg los videos ya descargados según perfiles con nombre
+// (contenedor, códecs, calidad y altura máxima).
+//
+// Los perfiles por defecto están definidos aquí y se pueden ampliar o reemplazar con un archivo JSON
+// indicado en TRANSCODE_PROFILES.
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/ffmpeg"
+)
+
+// Profile describe cómo se recodifica un video
+type Profile struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Container    string   `json:"container"`               // mp4, webm o mkv
+	VideoCodec   string   `json:"video_codec"`             // Códec de ffmpeg (libx264, libvpx-vp9...) o copy
+	AudioCodec   string   `json:"audio_codec"`             // Códec de ffmpeg (aac, libopus...) o copy
+	MaxHeight    int      `json:"max_height,omitempty"`    // Reduce la resolución si el video es más alto
+	CRF          int      `json:"crf,omitempty"`           // Calidad constante del códec de video
+	Preset       string   `json:"preset,omitempty"`        // Preset de velocidad del códec de video
+	AudioBitrate int      `json:"audio_bitrate,omitempty"` // kbps
+	ExtraArgs    []string `json:"extra_args,omitempty"`    // Argumentos de salida adicionales
+}
+
+// Contenedores admitidos por los perfiles
+var containers = []string{"mp4", "webm", "mkv"}
+
+// Defaults devuelve los perfiles incluidos por defecto
+func Defaults() map[string]Profile {
+	profiles := []Profile{
+		{
+			Name:         "mp4-h264-compat",
+			Description:  "MP4 con H.264 y AAC, compatible con cualquier reproductor",
+			Container:    "mp4",
+			VideoCodec:   "libx264",
+			AudioCodec:   "aac",
+			CRF:          23,
+			Preset:       "medium",
+			AudioBitrate: 160,
+			ExtraArgs:    []string{"-pix_fmt", "yuv420p", "-profile:v", "high"},
+		},
+		{
+			Name:         "webm-vp9",
+			Description:  "WebM con VP9 y Opus",
+			Container:    "webm",
+			VideoCodec:   "libvpx-vp9",
+			AudioCodec:   "libopus",
+			CRF:          32,
+			AudioBitrate: 128,
+			ExtraArgs:    []string{"-b:v", "0", "-row-mt", "1"},
+		},
+		{
+			Name:        "mkv-copy",
+			Description: "MKV con los streams originales sin recodificar",
+			Container:   "mkv",
+			VideoCodec:  "copy",
+			AudioCodec:  "copy",
+		},
+		{
+			Name:         "mobile-480p",
+			Description:  "MP4 H.264 de 480p como máximo para móviles",
+			Container:    "mp4",
+			VideoCodec:   "libx264",
+			AudioCodec:   "aac",
+			MaxHeight:    480,
+			CRF:          28,
+			Preset:       "fast",
+			AudioBitrate: 96,
+			ExtraArgs:    []string{"-pix_fmt", "yuv420p"},
+		},
+	}
+
+	defaults := map[string]Profile{}
+	for _, profile := range profiles {
+		defaults[profile.Name] = profile
+	}
+	return defaults
+}
+
+// Profiles son los perfiles disponibles, se establecen con Init
+var Profiles = Defaults()
+
+// Init carga los perfiles por defecto y los del archivo de TRANSCODE_PROFILES si se ha configurado
+func Init(cfg config.Config) error {
+	profiles := Defaults()
+	if cfg.TranscodeProfiles != "" {
+		custom, err := Load(cfg.TranscodeProfiles)
+		if err != nil {
+			return err
+		}
+		for _, profile := range custom {
+			profiles[profile.Name] = profile
+		}
+	}
+	Profiles = profiles
+	return nil
+}
+
+// Load lee una lista de perfiles en JSON y los valida
+func Load(path string) ([]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer los perfiles de transcodificación: %w", err)
+	}
+	var profiles []Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("error al leer los perfiles de transcodificación de %s: %w", path, err)
+	}
+	for _, profile := range profiles {
+		if err := profile.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// Get devuelve el perfil con el nombre indicado
+func Get(name string) (Profile, bool) {
+	profile, ok := Profiles[name]
+	return profile, ok
+}
+
+// List devuelve los perfiles disponibles ordenados por nombre
+func List() []Profile {
+	list := make([]Profile, 0, len(Profiles))
+	for _, profile := range Profiles {
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Validate comprueba que el perfil tiene nombre, contenedor y códecs
+func (p Profile) Validate() error {
+	if p.Name == "" || strings.ContainsAny(p.Name, "@/\\ ") {
+		return fmt.Errorf("nombre de perfil no válido: %q", p.Name)
+	}
+	if !slices.Contains(containers, p.Container) {
+		return fmt.Errorf("el perfil %s usa un contenedor no soportado: %s, los disponibles son %s", p.Name, p.Container, strings.Join(containers, ", "))
+	}
+	if p.VideoCodec == "" || p.AudioCodec == "" {
+		return fmt.Errorf("el perfil %s debe indicar video_codec y audio_codec", p.Name)
+	}
+	if p.MaxHeight > 0 && p.VideoCodec == "copy" {
+		return fmt.Errorf("el perfil %s no puede cambiar la resolución sin recodificar el video", p.Name)
+	}
+	return nil
+}
+
+// Extension devuelve la extensión de los archivos del perfil, con punto
+func (p Profile) Extension() string {
+	return "." + p.Container
+}
+
+// Args devuelve los argumentos de ffmpeg para recodificar input en output
+func (p Profile) Args(input string, output string) []string {
+	args := []string{"-i", input, "-map", "0:v:0", "-map", "0:a:0?", "-c:v", p.VideoCodec}
+	if p.VideoCodec != "copy" {
+		if p.MaxHeight > 0 {
+			args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(ih,%d)'", p.MaxHeight))
+		}
+		if p.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(p.CRF))
+		}
+		if p.Preset != "" {
+			args = append(args, "-preset", p.Preset)
+		}
+	}
+	args = append(args, "-c:a", p.AudioCodec)
+	if p.AudioCodec != "copy" && p.AudioBitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", p.AudioBitrate))
+	}
+	args = append(args, p.ExtraArgs...)
+	if p.Container == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, output)
+}
+
+// Run recodifica el archivo con el perfil y devuelve la ruta del resultado, en la misma carpeta que input.
+// El archivo original se borra si la recodificación termina bien
+func Run(ctx context.Context, binary string, profile Profile, input string, duration time.Duration, onProgress func(models.Progress)) (string, error) {
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+	output := fmt.Sprintf("%s.%s%s", base, profile.Name, profile.Extension())
+
+	report := func(percent float64) {
+		if onProgress != nil {
+			onProgress(models.Progress{Phase: "transcode", Percent: &percent})
+		}
+	}
+	report(0)
+	if err := ffmpeg.Run(ctx, binary, profile.Args(input, output), duration, report); err != nil {
+		os.Remove(output)
+		return "", fmt.Errorf("error al recodificar con el perfil %s: %w", profile.Name, err)
+	}
+	os.Remove(input)
+	return output, nil
+}
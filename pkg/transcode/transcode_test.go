@@ -0,0 +1,150 @@
+package transcode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"yt-converter-api/config"
+	"yt-converter-api/models"
+)
+
+func TestDefaultsAreValid(t *testing.T) {
+	for name, profile := range Defaults() {
+		if profile.Name != name {
+			t.Errorf("el perfil %s se guarda con el nombre %s", profile.Name, name)
+		}
+		if err := profile.Validate(); err != nil {
+			t.Errorf("perfil por defecto no válido: %v", err)
+		}
+	}
+}
+
+func TestProfileArgs(t *testing.T) {
+	defaults := Defaults()
+
+	tests := []struct {
+		profile string
+		want    string
+	}{
+		{"mp4-h264-compat", "-i in.mp4 -map 0:v:0 -map 0:a:0? -c:v libx264 -crf 23 -preset medium -c:a aac -b:a 160k -pix_fmt yuv420p -profile:v high -movflags +faststart out.mp4"},
+		{"webm-vp9", "-i in.mp4 -map 0:v:0 -map 0:a:0? -c:v libvpx-vp9 -crf 32 -c:a libopus -b:a 128k -b:v 0 -row-mt 1 out.mp4"},
+		{"mkv-copy", "-i in.mp4 -map 0:v:0 -map 0:a:0? -c:v copy -c:a copy out.mp4"},
+		{"mobile-480p", "-i in.mp4 -map 0:v:0 -map 0:a:0? -c:v libx264 -vf scale=-2:'min(ih,480)' -crf 28 -preset fast -c:a aac -b:a 96k -pix_fmt yuv420p -movflags +faststart out.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			args := defaults[tt.profile].Args("in.mp4", "out.mp4")
+			if got := strings.Join(args, " "); got != tt.want {
+				t.Errorf("Args() = %s\nse esperaba   %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitLoadsCustomProfiles(t *testing.T) {
+	t.Cleanup(func() { Profiles = Defaults() })
+
+	if err := Init(config.Config{TranscodeProfiles: "testdata/profiles.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Get("mp4-h265"); !ok {
+		t.Error("no se cargó el perfil mp4-h265")
+	}
+	if profile, _ := Get("mkv-copy"); profile.AudioCodec != "libopus" {
+		t.Errorf("el perfil mkv-copy del archivo debería reemplazar al incluido: %+v", profile)
+	}
+	if _, ok := Get("webm-vp9"); !ok {
+		t.Error("se deberían conservar los perfiles incluidos")
+	}
+	names := []string{}
+	for _, profile := range List() {
+		names = append(names, profile.Name)
+	}
+	if !slices.IsSorted(names) || len(names) != 5 {
+		t.Errorf("List() = %v", names)
+	}
+
+	if err := Init(config.Config{TranscodeProfiles: "testdata/invalid.json"}); err == nil {
+		t.Error("se esperaba un error con un contenedor no soportado")
+	}
+	if err := Init(config.Config{TranscodeProfiles: "testdata/missing.json"}); err == nil {
+		t.Error("se esperaba un error con un archivo inexistente")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+	}{
+		{"sin nombre", Profile{Container: "mp4", VideoCodec: "copy", AudioCodec: "copy"}},
+		{"nombre con @", Profile{Name: "a@b", Container: "mp4", VideoCodec: "copy", AudioCodec: "copy"}},
+		{"sin códecs", Profile{Name: "mp4", Container: "mp4"}},
+		{"escalar sin recodificar", Profile{Name: "small", Container: "mkv", VideoCodec: "copy", AudioCodec: "copy", MaxHeight: 360}},
+	}
+	for _, tt := range tests {
+		if err := tt.profile.Validate(); err == nil {
+			t.Errorf("%s: se esperaba un error", tt.name)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// ffmpeg falso: informa de la mitad del progreso y copia la entrada en la salida (último argumento)
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	script := `#!/bin/sh
+for arg; do
+	[ "$prev" = "-i" ] && input=$arg
+	prev=$arg
+done
+echo out_time_us=5000000
+cp "$input" "$arg"
+`
+	if err := os.WriteFile(fakeFFmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	input := filepath.Join(dir, "abc-720p.mp4")
+	os.WriteFile(input, []byte("video"), 0644)
+
+	var percents []float64
+	output, err := Run(context.Background(), fakeFFmpeg, Defaults()["webm-vp9"], input, 10*time.Second, func(progress models.Progress) {
+		if progress.Phase != "transcode" {
+			t.Errorf("fase = %s, se esperaba transcode", progress.Phase)
+		}
+		percents = append(percents, *progress.Percent)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != filepath.Join(dir, "abc-720p.webm-vp9.webm") {
+		t.Errorf("output = %s", output)
+	}
+	if data, err := os.ReadFile(output); err != nil || string(data) != "video" {
+		t.Errorf("contenido = %q, %v", data, err)
+	}
+	if _, err := os.Stat(input); !os.IsNotExist(err) {
+		t.Error("se debería borrar el archivo original")
+	}
+	if !slices.Equal(percents, []float64{0, 50, 100}) {
+		t.Errorf("progreso = %v, se esperaba [0 50 100]", percents)
+	}
+
+	// Si ffmpeg falla se conserva el original
+	os.WriteFile(input, []byte("video"), 0644)
+	failing := filepath.Join(dir, "failing")
+	os.WriteFile(failing, []byte("#!/bin/sh\necho 'Unknown encoder' >&2\nexit 1\n"), 0755)
+	if _, err := Run(context.Background(), failing, Defaults()["webm-vp9"], input, 0, nil); err == nil || !strings.Contains(err.Error(), "Unknown encoder") {
+		t.Errorf("se esperaba el error de ffmpeg, se obtuvo %v", err)
+	}
+	if _, err := os.Stat(input); err != nil {
+		t.Error("no se debería borrar el archivo original si falla")
+	}
+}
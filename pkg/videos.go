@@ -1,147 +1,89 @@
 package pkg
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
 	"net/url"
-	"os/exec"
 	"regexp"
+	"slices"
 	"strings"
-	"yt-converter-api/config"
 )
 
-type YoutubeResponse struct {
-	Items []struct {
-		Snippet struct {
-			Title string `json:"title"`
-		} `json:"snippet"`
-	} `json:"items"`
-}
-
 // Comprueba que la URL es válida
 func IsUrl(str string) bool {
 	u, err := url.Parse(str)
 	return err == nil && u.Scheme != "" && u.Host != ""
 }
 
-// Función para comprobar si la URL de YouTube es válida y existe
-func IsYoutubeUrl(url string) (bool, error) {
-	// Validar que la URL es un enlace de YouTube
-	youtubeRegex := `^(https?://)?(www\.)?(youtube\.com|youtu\.be)/(watch\?v=|embed/|v/|e/|shorts/|live/)?([A-Za-z0-9_-]{11})`
-	re := regexp.MustCompile(youtubeRegex)
-
-	// Si la URL no coincide con el patrón de YouTube, devolver false
-	if !re.MatchString(url) {
-		return false, fmt.Errorf("URL no es un enlace de YouTube válido")
-	}
-
-	// Hacer una solicitud HTTP a la URL del video
-	resp, err := http.Get(url)
-	if err != nil {
-		return false, fmt.Errorf("error al hacer la solicitud HTTP: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Comprobar el código de estado HTTP
-	if resp.StatusCode == 200 {
-		// Si el código de estado es 200, el video existe
-		return true, nil
+// WithScheme añade https:// a las URLs escritas sin esquema (youtu.be/..., www.youtube.com/...)
+func WithScheme(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		return "https://" + rawURL
 	}
-
-	// Si el código de estado no es 200, el video no existe o hay algún error
-	return false, fmt.Errorf("el video no existe o no está disponible, código de estado: %d", resp.StatusCode)
+	return rawURL
 }
 
-// Obtener el ID del video
-func GetYoutubeVideoID(url string) string {
-	re := regexp.MustCompile(`(?:v=|\/)([0-9A-Za-z_-]{11}).*`)
-	matches := re.FindStringSubmatch(url)
-	if len(matches) > 1 {
-		return matches[1]
-	}
-	return ""
-}
+// Hosts de YouTube que sirven videos, sin distinguir mayúsculas
+var youtubeHosts = []string{"youtube.com", "www.youtube.com", "m.youtube.com", "music.youtube.com", "youtube-nocookie.com", "www.youtube-nocookie.com"}
 
-// Obtener el título del video en base a la URL (Usando Google Cloud API)
-func GetYoutubeVideoTitle(videoURL string) (string, error) {
-	videoID := GetYoutubeVideoID(videoURL)
-	apiURL := fmt.Sprintf("https://www.googleapis.com/youtube/v3/videos?part=snippet&id=%s&key=%s", videoID, config.LoadConfig().GoogleCloudApiKey)
+// Rutas de youtube.com con el ID del video como siguiente segmento
+var youtubeIDPaths = []string{"shorts", "live", "embed", "v", "e"}
 
-	// Hacer la solicitud HTTP a la API de YouTube
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return "", fmt.Errorf("Error al hacer la solicitud HTTP a la API de YouTube: %v", err)
-	}
-	defer resp.Body.Close()
+var youtubeVideoID = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
 
-	// Leer la respuesta de la API
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("Error al leer la respuesta: %v", err)
+// Obtener el ID del video de una URL de YouTube sin acceder a la red, devuelve "" si la URL no es un video.
+// Se admiten watch?v=, youtu.be/, shorts/, live/, embed/, v/ y e/ en youtube.com, m.youtube.com,
+// music.youtube.com y youtube-nocookie.com, con o sin esquema y con otros parámetros como t= o list=.
+// La existencia del video se comprueba después con los proveedores de metadatos
+func GetYoutubeVideoID(rawURL string) string {
+	u, err := url.Parse(WithScheme(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Port() != "" {
+		return ""
 	}
-
-	// Deserializar la respuesta JSON
-	var youtubeResp YoutubeResponse
-	if err := json.Unmarshal(body, &youtubeResp); err != nil {
-		return "", fmt.Errorf("Error al deserializar la respuesta: %v", err)
+	host := strings.ToLower(u.Hostname())
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	var id string
+	switch {
+	case host == "youtu.be" || host == "www.youtu.be":
+		if len(segments) == 1 {
+			id = segments[0]
+		}
+	case slices.Contains(youtubeHosts, host):
+		if len(segments) == 1 && segments[0] == "watch" {
+			id = u.Query().Get("v")
+		} else if len(segments) == 2 && slices.Contains(youtubeIDPaths, segments[0]) {
+			id = segments[1]
+		}
 	}
-
-	// Si encontramos un video en la respuesta, devolver el título
-	if len(youtubeResp.Items) > 0 {
-		return youtubeResp.Items[0].Snippet.Title, nil
+	if !youtubeVideoID.MatchString(id) {
+		return ""
 	}
-
-	// Si no se encuentra el video, devolver un error
-	return "", fmt.Errorf("No se pudo encontrar el video con ID %s", videoID)
+	return id
 }
 
-// Obtener las resoluciones de un video haciendo uso de pyConverter/main.py
-func GetYoutubeVideoResolutions(videoID string, cookiesPath string) ([]string, error) {
-	// Construir slice de argumentos base
-	args := []string{
-		config.LoadConfig().PyConverterPath,
-		videoID,
-		"video",
-		config.LoadConfig().StoragePath,
-	}
-
-	// Agregar --cookies si cookiesPath no está vacío
-	if cookiesPath != "" {
-		fmt.Println("Usando archivo de cookies en:", cookiesPath)
-		args = append(args, "--cookies", cookiesPath)
-	} else {
-		fmt.Println("No se está usando archivo de cookies")
-	}
-
-	// Construir el comando con /usr/bin/python3 y los argumentos
-	cmd := exec.Command("/usr/bin/python3", args...)
-
-	// Capturar la salida del comando
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("error al ejecutar el script de Python, comprueba la dirección URL del video u otros factores: %v, output: %v", err, string(output))
-	}
-
-	// Dividir la salida en líneas y obtener la última línea
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(lines) == 0 {
-		return nil, fmt.Errorf("no se obtuvo salida del script de Python")
+// Obtener el ID de la lista de reproducción de una URL youtube.com/playlist?list=, devuelve "" si la URL no
+// es una lista. Los videos abiertos desde una lista (watch?v=...&list=...) se siguen tratando como videos
+func GetYoutubePlaylistID(url string) string {
+	re := regexp.MustCompile(`^(https?://)?(www\.|m\.|music\.)?youtube\.com/playlist\?(?:[^#]*&)?list=([A-Za-z0-9_-]{10,})(?:[&#]|$)`)
+	matches := re.FindStringSubmatch(url)
+	if len(matches) > 3 {
+		return matches[3]
 	}
-	lastLine := lines[len(lines)-1]
-
-	// Limpiar la cadena de caracteres innecesarios
-	lastLine = strings.TrimPrefix(lastLine, "[")
-	lastLine = strings.TrimSuffix(lastLine, "]")
-	lastLine = strings.ReplaceAll(lastLine, "'", "")
-	lastLine = strings.ReplaceAll(lastLine, " ", "")
+	return ""
+}
 
-	// Convertir la cadena en una lista de formatos
-	formatList := strings.Split(lastLine, ",")
-	if len(formatList) == 0 {
-		return nil, fmt.Errorf("no se encontraron formatos disponibles")
+// Obtener el ID del canal de una URL youtube.com/channel/UC..., devuelve "" si la URL no es un canal. Los
+// alias (@usuario, /c/, /user/) no incluyen el ID y no se admiten
+func GetYoutubeChannelID(url string) string {
+	re := regexp.MustCompile(`^(https?://)?(www\.|m\.)?youtube\.com/channel/(UC[A-Za-z0-9_-]{22})(?:[/?#]|$)`)
+	matches := re.FindStringSubmatch(url)
+	if len(matches) > 3 {
+		return matches[3]
 	}
+	return ""
+}
 
-	return formatList, nil
+// Obtener la lista de reproducción con los videos subidos por un canal, YouTube la genera cambiando el
+// prefijo UC del ID del canal por UU
+func GetChannelUploadsPlaylistID(channelID string) string {
+	return "UU" + strings.TrimPrefix(channelID, "UC")
 }
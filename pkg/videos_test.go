@@ -0,0 +1,125 @@
+package pkg
+
+import "testing"
+
+func TestGetYoutubeVideoID(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		// watch en todos los hosts, con y sin esquema
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"http://youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ&feature=share", "dQw4w9WgXcQ"},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"HTTPS://WWW.YOUTUBE.COM/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		// Marcas de tiempo, listas y otros parámetros
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?feature=youtu.be&v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf&index=2", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ#t=1m", "dQw4w9WgXcQ"},
+		// Enlaces cortos
+		{"https://youtu.be/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc&t=42", "dQw4w9WgXcQ"},
+		{"youtu.be/dQw4w9WgXcQ/", "dQw4w9WgXcQ"},
+		// Shorts, directos e inserciones
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://m.youtube.com/shorts/dQw4w9WgXcQ?feature=share", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ?si=abc", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ?start=10", "dQw4w9WgXcQ"},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/v/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/e/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		// IDs mal formados
+		{"https://www.youtube.com/watch?v=dQw4w9WgXc", ""},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQQ", ""},
+		{"https://www.youtube.com/watch?v=dQw4w9WgX$Q", ""},
+		{"https://youtu.be/", ""},
+		// Otras páginas de YouTube
+		{"https://www.youtube.com/", ""},
+		{"https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", ""},
+		{"https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", ""},
+		{"https://www.youtube.com/@GoogleDevelopers", ""},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ/extra", ""},
+		// Otros hosts, esquemas, puertos y credenciales
+		{"https://example.com/watch?v=dQw4w9WgXcQ", ""},
+		{"https://youtube.com.example.com/watch?v=dQw4w9WgXcQ", ""},
+		{"https://example.com/youtube.com/watch?v=dQw4w9WgXcQ", ""},
+		{"https://www.youtube.com@example.com/watch?v=dQw4w9WgXcQ", ""},
+		{"https://www.youtube.com:8080/watch?v=dQw4w9WgXcQ", ""},
+		{"ftp://www.youtube.com/watch?v=dQw4w9WgXcQ", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := GetYoutubeVideoID(tt.url); got != tt.want {
+			t.Errorf("GetYoutubeVideoID(%q) = %q, se esperaba %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestWithScheme(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"youtu.be/dQw4w9WgXcQ", "https://youtu.be/dQw4w9WgXcQ"},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"http://youtu.be/dQw4w9WgXcQ", "http://youtu.be/dQw4w9WgXcQ"},
+		{"ftp://www.youtube.com/watch?v=dQw4w9WgXcQ", "ftp://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	}
+	for _, tt := range tests {
+		if got := WithScheme(tt.url); got != tt.want || !IsUrl(got) {
+			t.Errorf("WithScheme(%q) = %q, se esperaba la URL válida %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestGetYoutubePlaylistID(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+		{"https://youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf&si=abc", "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+		{"https://m.youtube.com/playlist?feature=share&list=OLAK5uy_k1234567890", "OLAK5uy_k1234567890"},
+		{"music.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+		// Un video abierto desde una lista sigue siendo un video
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", ""},
+		{"https://www.youtube.com/playlist?list=WL", ""},
+		{"https://www.youtube.com/playlist?list=PLrAXtmErZ$gOe", ""},
+		{"https://example.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", ""},
+	}
+	for _, tt := range tests {
+		if got := GetYoutubePlaylistID(tt.url); got != tt.want {
+			t.Errorf("GetYoutubePlaylistID(%q) = %q, se esperaba %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestGetYoutubeChannelID(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", "UC_x5XG1OV2P6uZZ5FSM9Ttw"},
+		{"https://youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw/videos", "UC_x5XG1OV2P6uZZ5FSM9Ttw"},
+		{"m.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw?si=abc", "UC_x5XG1OV2P6uZZ5FSM9Ttw"},
+		// Los alias (@usuario) necesitan la red para conocer el ID del canal
+		{"https://www.youtube.com/@GoogleDevelopers", ""},
+		{"https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttwxx", ""},
+		{"https://www.youtube.com/channel/PL_x5XG1OV2P6uZZ5FSM9Ttw", ""},
+		{"https://example.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", ""},
+	}
+	for _, tt := range tests {
+		if got := GetYoutubeChannelID(tt.url); got != tt.want {
+			t.Errorf("GetYoutubeChannelID(%q) = %q, se esperaba %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestGetChannelUploadsPlaylistID(t *testing.T) {
+	if got := GetChannelUploadsPlaylistID("UC_x5XG1OV2P6uZZ5FSM9Ttw"); got != "UU_x5XG1OV2P6uZZ5FSM9Ttw" {
+		t.Errorf("GetChannelUploadsPlaylistID = %q, se esperaba %q", got, "UU_x5XG1OV2P6uZZ5FSM9Ttw")
+	}
+}
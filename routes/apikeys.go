@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"yt-converter-api/pkg/apikeys"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type createAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 para que no caduque
+}
+
+// GetCurrentUserAPIKeys obtiene las API keys del usuario autenticado, sin la clave
+func GetCurrentUserAPIKeys(c *fiber.Ctx) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	keys, err := apikeys.List(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener las API keys",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(keys)
+}
+
+// CreateCurrentUserAPIKey crea una API key del usuario autenticado, la clave solo se devuelve en esta respuesta
+func CreateCurrentUserAPIKey(c *fiber.Ctx) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	var request createAPIKeyRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error":      "Error al analizar el cuerpo de la solicitud",
+			"errorTrace": err.Error(),
+		})
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Se debe indicar un nombre (name) de 100 caracteres como máximo",
+		})
+	}
+	scopes, err := apikeys.ParseScopes(request.Scopes)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if request.ExpiresInDays < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_in_days no puede ser negativo",
+		})
+	}
+	// El permiso admin solo lo pueden dar los administradores
+	if slices.Contains(scopes, apikeys.ScopeAdmin) && !isAdminContext(c) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "Solo los administradores pueden crear API keys con el permiso " + apikeys.ScopeAdmin,
+		})
+	}
+
+	apiKey, key, err := apikeys.Create(userID, request.Name, scopes, request.ExpiresInDays)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al crear la API key",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "API key creada correctamente, guárdala porque no se volverá a mostrar",
+		"key":     key,
+		"apiKey":  apiKey,
+	})
+}
+
+// DeleteCurrentUserAPIKey borra una API key del usuario autenticado
+func DeleteCurrentUserAPIKey(c *fiber.Ctx) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+	keyID, err := strconv.ParseInt(c.Params("key_id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "ID de API key no válido",
+		})
+	}
+
+	err = apikeys.Delete(userID, keyID)
+	if errors.Is(err, apikeys.ErrNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "La API key no existe",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al borrar la API key",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "API key borrada correctamente",
+	})
+}
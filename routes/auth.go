@@ -1,10 +1,12 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"yt-converter-api/db"
 	"yt-converter-api/models"
 	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/sessions"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -20,8 +22,8 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
-type authResponse struct {
-	Token string `json:"token"`
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
 }
 
 // Register registra un nuevo usuario en base a usuario y contraseña
@@ -70,8 +72,8 @@ func Login(c *fiber.Ctx) error {
 			"error": "Usuario o contraseña incorrectos",
 		})
 	}
-	// Generar un token JWT
-	token, err := pkg.GenerateToken(user.ID, user.Role)
+	// Iniciar la sesión y generar sus tokens
+	tokens, err := sessions.Create(user.ID, user.Role, c.IP(), c.Get(fiber.HeaderUserAgent))
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error":      "Error al generar el token",
@@ -80,11 +82,50 @@ func Login(c *fiber.Ctx) error {
 	}
 	// Actualizar el campo last_login_at del usuario
 	_, _ = db.DB.Exec("UPDATE users SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?", user.ID)
-	return c.JSON(authResponse{Token: token})
+	return c.JSON(tokens)
 }
 
+// Refresh cambia un token de refresco por un nuevo token de acceso y un nuevo token de refresco
+func Refresh(c *fiber.Ctx) error {
+	var request refreshRequest
+	if err := c.BodyParser(&request); err != nil || request.RefreshToken == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Se debe indicar el refresh_token",
+		})
+	}
+
+	tokens, err := sessions.Refresh(request.RefreshToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if errors.Is(err, sessions.ErrInvalidToken) || errors.Is(err, sessions.ErrTokenReused) || errors.Is(err, sessions.ErrUserInactive) {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error":      "No se ha podido refrescar la sesión, por favor inicia sesión nuevamente",
+			"errorTrace": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al refrescar la sesión",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(tokens)
+}
+
+// Logout cierra la sesión del token: ni el token de acceso ni el de refresco se pueden volver a usar
 func Logout(c *fiber.Ctx) error {
-	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-		"error": "Error al generar el token",
+	sessionID := getSessionIDFromContext(c)
+	if sessionID == 0 {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	if err := sessions.Revoke(sessionID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al cerrar la sesión",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Sesión cerrada correctamente",
 	})
 }
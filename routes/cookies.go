@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/cache"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -52,6 +53,11 @@ func UploadCookies(c *fiber.Ctx) error {
 		})
 	}
 
+	// Los formatos en caché sin cookies propias se obtuvieron con el archivo anterior
+	if _, err := cache.InvalidateProfile(cache.DefaultProfile); err != nil {
+		fmt.Println("Error invalidando la caché:", err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Cookies Uploaded Succesfully",
 	})
@@ -88,6 +94,10 @@ func DeleteCookiesFile(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, err := cache.InvalidateProfile(cache.DefaultProfile); err != nil {
+		fmt.Println("Error invalidando la caché:", err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Archivo de cookies eliminado correctamente",
 	})
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"yt-converter-api/db"
+	"yt-converter-api/jobs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Cada cuánto se envía un comentario vacío para que proxies y clientes no cierren la conexión
+const sseHeartbeatInterval = 15 * time.Second
+
+// GetVideoEvents envía por Server-Sent Events el progreso y los cambios de estado del procesamiento de un video
+func GetVideoEvents(c *fiber.Ctx) error {
+	videoID := c.Params("video_id")
+
+	// Verificar existencia del video
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM videos WHERE video_id = ?", videoID).Scan(&count); err != nil || count == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "El video no existe en la base de datos",
+		})
+	}
+
+	// Suscribirse antes de leer el estado actual para no perder eventos entre medias
+	events, unsubscribe := jobs.Subscribe(videoID)
+
+	statuses, err := getVideoStatuses(videoID)
+	if err != nil {
+		unsubscribe()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener el estado del video",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		// Estado inicial de cada resolución con el último progreso conocido
+		for _, status := range statuses {
+			event := jobs.Event{Type: jobs.EventStatus, VideoID: status.VideoID, Resolution: status.Resolution, Status: status.Status, Progress: status.Progress}
+			if writeSSE(w, event) != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if writeSSE(w, event) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				// Si el cliente se ha desconectado el Flush devuelve error
+				fmt.Fprint(w, ": ping\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	}))
+
+	return nil
+}
+
+// writeSSE escribe un evento con el formato de Server-Sent Events
+func writeSSE(w *bufio.Writer, event jobs.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return w.Flush()
+}
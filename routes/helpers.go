@@ -0,0 +1,370 @@
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"yt-converter-api/config"
+	"yt-converter-api/jobs"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/subtitles"
+	"yt-converter-api/pkg/tags"
+	"yt-converter-api/pkg/transcode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// getUserIDFromContext obtiene el ID del usuario autenticado a partir del token JWT del contexto
+func getUserIDFromContext(c *fiber.Ctx) (int, error) {
+	token, ok := c.Locals("jwt").(*jwt.Token)
+	if !ok {
+		return 0, fmt.Errorf("token no encontrado")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0, fmt.Errorf("token inválido")
+	}
+
+	userID, _ := claims["user_id"].(string)
+	return strconv.Atoi(userID)
+}
+
+// getSessionIDFromContext obtiene el ID de la sesión del token JWT del contexto, 0 si no tiene
+func getSessionIDFromContext(c *fiber.Ctx) int64 {
+	token, ok := c.Locals("jwt").(*jwt.Token)
+	if !ok {
+		return 0
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0
+	}
+
+	sessionID, _ := claims["sid"].(float64)
+	return int64(sessionID)
+}
+
+// isAdminContext indica si el usuario autenticado es administrador
+func isAdminContext(c *fiber.Ctx) bool {
+	token, ok := c.Locals("jwt").(*jwt.Token)
+	if !ok {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return false
+	}
+
+	role, _ := claims["role"].(string)
+	return role == "admin"
+}
+
+// Columnas de videos en el orden que espera scanVideo, los metadatos pueden ser NULL en los videos
+// agregados antes de guardarse
+const videoColumns = `id, user_id, video_id, provider, COALESCE(external_id, video_id), title, requested_by_ip, created_at, updated_at,
+	COALESCE(duration, 0), COALESCE(channel_name, ''), COALESCE(channel_id, ''), COALESCE(upload_date, ''),
+	COALESCE(description, ''), view_count, COALESCE(thumbnail_url, ''), COALESCE(is_live, FALSE),
+	COALESCE(is_short, FALSE), COALESCE(age_restricted, FALSE), COALESCE(metadata_provider, ''), metadata_updated_at`
+
+// scanVideo lee una fila seleccionada con videoColumns
+func scanVideo(row interface{ Scan(...any) error }) (models.Video, error) {
+	var video models.Video
+	err := row.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Provider, &video.ExternalID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt,
+		&video.Duration, &video.ChannelName, &video.ChannelID, &video.UploadDate,
+		&video.Description, &video.ViewCount, &video.ThumbnailURL, &video.IsLive,
+		&video.IsShort, &video.AgeRestricted, &video.MetadataProvider, &video.MetadataUpdatedAt)
+	return video, err
+}
+
+// parseAudioOptions lee las opciones de audio del formulario de POST /process y las valida
+func parseAudioOptions(c *fiber.Ctx) (converter.AudioOptions, error) {
+	audio := converter.AudioOptions{Format: c.FormValue("AudioFormat")}
+
+	var err error
+	if value := c.FormValue("AudioBitrate"); value != "" {
+		if audio.Bitrate, err = strconv.Atoi(value); err != nil {
+			return audio, fmt.Errorf("AudioBitrate debe ser un número de kbps")
+		}
+	}
+	if value := c.FormValue("AudioQuality"); value != "" {
+		quality, err := strconv.Atoi(value)
+		if err != nil {
+			return audio, fmt.Errorf("AudioQuality debe ser un número")
+		}
+		audio.Quality = &quality
+	}
+	if value := c.FormValue("SampleRate"); value != "" {
+		if audio.SampleRate, err = strconv.Atoi(value); err != nil {
+			return audio, fmt.Errorf("SampleRate debe ser un número de Hz")
+		}
+	}
+	// Normalize=true normaliza a LOUDNESS_TARGET, LoudnessTarget indica otro objetivo
+	if value := c.FormValue("LoudnessTarget"); value != "" {
+		if audio.Loudness, err = strconv.ParseFloat(value, 64); err != nil {
+			return audio, fmt.Errorf("LoudnessTarget debe ser un número de LUFS")
+		}
+	} else if c.FormValue("Normalize", "false") == "true" {
+		audio.Loudness = config.LoadConfig().LoudnessTarget
+	}
+	return audio, audio.Validate()
+}
+
+// parseTagOverrides lee del formulario de POST /process las etiquetas que reemplazan a las del video,
+// devuelve nil si no se indica ninguna
+func parseTagOverrides(c *fiber.Ctx) (*tags.Tags, error) {
+	overrides := tags.Tags{
+		Title:  c.FormValue("TagTitle"),
+		Artist: c.FormValue("TagArtist"),
+		Album:  c.FormValue("TagAlbum"),
+		Date:   c.FormValue("TagDate"),
+	}
+	if overrides == (tags.Tags{}) {
+		return nil, nil
+	}
+	return &overrides, overrides.Validate()
+}
+
+// processOptions son las opciones del formulario de POST /process, comunes a un video y a una lista de
+// reproducción
+type processOptions struct {
+	Resolution     string // Resolución del video o, en el audio, la variante de sus opciones: mp3, opus-128k...
+	IsAudio        bool
+	Audio          converter.AudioOptions
+	Format         string // Descriptor (1080p60-av1) o ID de formato de yt-dlp, tiene prioridad sobre Resolution
+	Clip           *converter.Clip
+	Chapters       bool
+	EmbedTags      bool
+	Tags           *tags.Tags
+	Profile        string
+	Subtitles      []string
+	SubtitlesOnly  bool
+	SubtitleFormat string
+	Previews       bool
+}
+
+// parseProcessOptions lee las opciones del formulario de POST /process y comprueba que se puedan combinar,
+// los errores se pueden devolver tal cual al cliente
+func parseProcessOptions(c *fiber.Ctx) (processOptions, error) {
+	options := processOptions{
+		Resolution: c.FormValue("Resolution", "720p"), // valor por defecto
+		IsAudio:    c.FormValue("IsAudio", "false") == "true",
+		Format:     c.FormValue("Format"),
+	}
+
+	// Opciones del audio, indicar AudioFormat o normalizar implica IsAudio
+	var err error
+	if options.Audio, err = parseAudioOptions(c); err != nil {
+		return options, err
+	}
+	if options.Audio.Format != "" || options.Audio.Loudness != 0 {
+		options.IsAudio = true
+	}
+
+	// Fragmento opcional del video, en segundos o HH:MM:SS
+	if options.Clip, err = converter.ParseClip(c.FormValue("Start", c.FormValue("start")), c.FormValue("End", c.FormValue("end"))); err != nil {
+		return options, err
+	}
+
+	// Dividir el audio en una pista por capítulo, implica IsAudio y no se puede combinar con un fragmento
+	options.Chapters = c.FormValue("SplitChapters", "false") == "true"
+	if options.Chapters {
+		if options.Clip != nil {
+			return options, fmt.Errorf("No se puede dividir por capítulos un fragmento del video")
+		}
+		options.IsAudio = true
+	}
+
+	// Los formatos concretos son de video, con audio (IsAudio, AudioFormat o SplitChapters) se ignorarían sin avisar
+	if options.Format != "" && options.IsAudio {
+		return options, fmt.Errorf("Los formatos concretos solo se pueden usar con video")
+	}
+
+	// Etiquetas y carátula del audio, se escriben salvo EmbedTags=false y se pueden reemplazar con TagTitle,
+	// TagArtist, TagAlbum y TagDate
+	options.EmbedTags = c.FormValue("EmbedTags", "true") != "false"
+	if options.Tags, err = parseTagOverrides(c); err != nil {
+		return options, err
+	}
+	if options.Tags != nil && (!options.IsAudio || !options.EmbedTags) {
+		return options, fmt.Errorf("Las etiquetas solo se pueden indicar al procesar audio con EmbedTags")
+	}
+
+	// Perfil de transcodificación opcional, solo para video
+	options.Profile = c.FormValue("Profile")
+	if options.Profile != "" {
+		if options.IsAudio {
+			return options, fmt.Errorf("Los perfiles de transcodificación solo se pueden usar con video")
+		}
+		if _, ok := transcode.Get(options.Profile); !ok {
+			return options, fmt.Errorf("El perfil de transcodificación %s no existe", options.Profile)
+		}
+	}
+
+	// Subtítulos (IDs de GET /subtitles separados por comas): con SubtitlesOnly=true solo se guardan los
+	// archivos en SubtitleFormat, si no se incrustan en el video, que tiene que ser MP4 o MKV
+	if options.Subtitles, err = parseSubtitleIDs(c.FormValue("Subtitles")); err != nil {
+		return options, err
+	}
+	options.SubtitlesOnly = c.FormValue("SubtitlesOnly", "false") == "true"
+	if options.SubtitlesOnly {
+		options.SubtitleFormat = c.FormValue("SubtitleFormat", subtitles.FormatSRT)
+		if len(options.Subtitles) == 0 {
+			return options, fmt.Errorf("Indica los subtítulos a descargar en Subtitles")
+		}
+		if options.IsAudio || options.Profile != "" || options.Format != "" {
+			return options, fmt.Errorf("SubtitlesOnly no se puede combinar con audio, formatos ni perfiles")
+		}
+		if !subtitles.ValidFormat(options.SubtitleFormat) {
+			return options, fmt.Errorf("Formato de subtítulos no soportado: %s, los disponibles son %s", options.SubtitleFormat, strings.Join(subtitles.Formats(), ", "))
+		}
+		options.Resolution = options.SubtitleFormat
+	} else if len(options.Subtitles) > 0 {
+		if options.IsAudio {
+			return options, fmt.Errorf("Los subtítulos solo se pueden incrustar en video, usa SubtitlesOnly para descargarlos sueltos")
+		}
+		container := "mp4"
+		if profile, ok := transcode.Get(options.Profile); ok {
+			container = profile.Container
+		}
+		if !subtitles.CanEmbed("." + container) {
+			return options, fmt.Errorf("Solo se pueden incrustar subtítulos en MP4 o MKV, el perfil %s usa %s", options.Profile, container)
+		}
+	}
+
+	// Hoja de contactos y vista previa animada, solo a partir de un video
+	options.Previews = c.FormValue("Previews", "false") == "true"
+	if options.Previews && (options.IsAudio || options.SubtitlesOnly) {
+		return options, fmt.Errorf("La vista previa solo se puede generar al procesar un video")
+	}
+
+	// El audio se guarda con la variante de sus opciones como resolución: mp3, opus-128k, flac-48000hz...
+	if options.IsAudio {
+		if options.Audio.Format == "" {
+			options.Audio.Format = converter.AudioMP3
+		}
+		options.Resolution = options.Audio.Key()
+	}
+	return options, nil
+}
+
+// validateBulkOptions comprueba las opciones al procesar varios videos a la vez (listas y suscripciones):
+// los formatos concretos, los fragmentos y las etiquetas dependen de cada video y las cookies por petición
+// se borran al terminar el primer trabajo
+func validateBulkOptions(c *fiber.Ctx, options processOptions) error {
+	if options.Format != "" || options.Clip != nil || options.Tags != nil {
+		return fmt.Errorf("Format, Start, End y las etiquetas no se pueden usar al procesar varios videos")
+	}
+	if fileHeader, err := c.FormFile("cookies"); err == nil && fileHeader != nil {
+		return fmt.Errorf("No se admiten cookies por petición al procesar varios videos, súbelas con POST /api/cookies")
+	}
+	return nil
+}
+
+// key devuelve la variante con la que se guarda el resultado. Cada fragmento, cada perfil, el audio por
+// capítulos, los subtítulos y el audio con otras etiquetas se guardan como una variante distinta: 720p~90-120,
+// 720p@webm-vp9, mp3~chapters, 720p~subs-en.es, srt~subs-en-auto, mp3~tags-1a2b3c4d...
+func (o processOptions) key() string {
+	tagsKey := ""
+	if o.IsAudio {
+		tagsKey = tagsVariant(o.EmbedTags, o.Tags)
+	}
+	return variantKey(o.Resolution, o.Clip, o.Chapters, o.Subtitles, tagsKey, o.Profile)
+}
+
+// payload devuelve el trabajo que procesa las opciones, sin cookies ni formato concreto
+func (o processOptions) payload() jobs.Payload {
+	payload := jobs.Payload{
+		IsAudio:   o.IsAudio,
+		Profile:   o.Profile,
+		Clip:      o.Clip,
+		Chapters:  o.Chapters,
+		Tags:      o.Tags,
+		SkipTags:  !o.EmbedTags,
+		Subtitles: o.Subtitles,
+		Previews:  o.Previews,
+	}
+	if o.SubtitlesOnly {
+		payload.SubtitlesOnly = true
+		payload.SubtitleFormat = o.SubtitleFormat
+	}
+	if o.IsAudio {
+		audio := o.Audio
+		payload.Audio = &audio
+	}
+	return payload
+}
+
+// variantKey devuelve la clave con la que se guarda una variante en video_status: los fragmentos se guardan
+// como <resolución>~<inicio>-<fin>, el audio por capítulos como <formato>~chapters, los subtítulos como
+// <resolución o formato>~subs-<ids separados por puntos>, el audio con otras etiquetas añade ~<tagsKey> (ver
+// tagsVariant) y los videos recodificados con un perfil añaden @<perfil>
+func variantKey(resolution string, clip *converter.Clip, chapters bool, subtitles []string, tagsKey string, profile string) string {
+	if resolution == "" {
+		return ""
+	}
+	if clip != nil {
+		resolution += "~" + clip.Key()
+	}
+	if chapters {
+		resolution += "~chapters"
+	}
+	if len(subtitles) > 0 {
+		resolution += "~subs-" + strings.Join(subtitles, ".")
+	}
+	if tagsKey != "" {
+		resolution += "~" + tagsKey
+	}
+	if profile != "" {
+		resolution += "@" + profile
+	}
+	return resolution
+}
+
+// tagsVariant devuelve la parte de la clave de la variante que depende de las etiquetas del audio: notags si
+// no se escriben, tags-<hash> si se reemplazan y nada con las etiquetas por defecto
+func tagsVariant(embedTags bool, overrides *tags.Tags) string {
+	if !embedTags {
+		return "notags"
+	}
+	if overrides != nil {
+		return "tags-" + overrides.Key()
+	}
+	return ""
+}
+
+// variantFromQuery obtiene la variante de ?resolution=, opcionalmente con ?start=, ?end=, ?chapters=true,
+// ?subtitles= y ?profile=
+func variantFromQuery(c *fiber.Ctx) (string, error) {
+	clip, err := converter.ParseClip(c.Query("start"), c.Query("end"))
+	if err != nil {
+		return "", err
+	}
+	subtitles, err := parseSubtitleIDs(c.Query("subtitles"))
+	if err != nil {
+		return "", err
+	}
+	return variantKey(c.Query("resolution"), clip, c.QueryBool("chapters"), subtitles, "", c.Query("profile")), nil
+}
+
+var subtitleIDPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// parseSubtitleIDs lee una lista de IDs de subtítulos separados por comas (en,es-419,en-auto), en
+// minúsculas y sin repetir
+func parseSubtitleIDs(value string) ([]string, error) {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" || slices.Contains(ids, id) {
+			continue
+		}
+		if !subtitleIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("el ID de subtítulos %q no es válido", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
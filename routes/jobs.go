@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"yt-converter-api/jobs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJobs obtiene los trabajos de la cola, se puede filtrar por estado con ?status=
+func GetJobs(c *fiber.Ctx) error {
+	list, err := jobs.GetJobs(c.Query("status"))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los trabajos",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	return c.JSON(list)
+}
+
+// CancelJob cancela cualquier trabajo en cola o en proceso por su ID
+func CancelJob(c *fiber.Ctx) error {
+	jobID, err := strconv.ParseInt(c.Params("job_id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "ID de trabajo no válido",
+		})
+	}
+
+	if _, err := jobs.GetJob(jobID); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "Trabajo no encontrado",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener el trabajo",
+		})
+	}
+
+	return cancelJob(c, jobID)
+}
+
+// cancelJob cancela el trabajo y devuelve la respuesta adecuada
+func cancelJob(c *fiber.Ctx, jobID int64) error {
+	err := jobs.Cancel(jobID)
+	if errors.Is(err, jobs.ErrNotCancellable) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error": "El trabajo ya ha terminado y no se puede cancelar",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al cancelar el trabajo",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Trabajo cancelado",
+		"jobID":   jobID,
+	})
+}
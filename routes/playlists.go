@@ -0,0 +1,433 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/jobs"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/sources"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Columnas de playlists en el orden que espera scanPlaylist, con el número de videos de cada lista
+const playlistColumns = `id, COALESCE(user_id, 0), playlist_id, title, COALESCE(channel_name, ''), requested_by_ip, created_at, updated_at,
+	(SELECT COUNT(*) FROM playlist_videos WHERE playlist_videos.playlist_id = playlists.id)`
+
+// scanPlaylist lee una fila seleccionada con playlistColumns
+func scanPlaylist(row interface{ Scan(...any) error }) (models.Playlist, error) {
+	var playlist models.Playlist
+	err := row.Scan(&playlist.ID, &playlist.UserID, &playlist.PlaylistID, &playlist.Title, &playlist.ChannelName, &playlist.RequestedByIP,
+		&playlist.CreatedAt, &playlist.UpdatedAt, &playlist.VideoCount)
+	return playlist, err
+}
+
+// addPlaylist agrega los videos de una lista de reproducción que todavía no existen y guarda la lista con
+// sus videos en orden. Si la lista ya existía se actualiza su orden con el actual de YouTube
+func addPlaylist(c *fiber.Ctx, userID int, playlistID string) error {
+	playlist, err := converter.Current.ListPlaylist(context.Background(), playlistID, "")
+	if errors.Is(err, converter.ErrPlaylistUnavailable) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "La lista de reproducción no existe o no está disponible",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los videos de la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+	if len(playlist.Entries) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "La lista de reproducción no tiene videos disponibles",
+		})
+	}
+
+	// Las listas muy largas se recortan a PLAYLIST_MAX_ENTRIES videos
+	entries := playlist.Entries
+	maxEntries := config.LoadConfig().PlaylistMaxEntries
+	truncated := maxEntries > 0 && len(entries) > maxEntries
+	if truncated {
+		entries = entries[:maxEntries]
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al guardar la lista de reproducción",
+		})
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO playlists (user_id, playlist_id, title, channel_name, requested_by_ip) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(playlist_id) DO UPDATE SET title = excluded.title, channel_name = excluded.channel_name, updated_at = CURRENT_TIMESTAMP
+		RETURNING id`, userID, playlistID, playlist.Title, playlist.Channel, c.IP()).Scan(&id)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM playlist_videos WHERE playlist_id = ?", id)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al guardar la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	// Los videos nuevos se guardan con la información del listado, el resto de metadatos se puede obtener
+	// con refresh-metadata
+	var added []string
+	for i, entry := range entries {
+		var exists int
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM videos WHERE video_id = ?)", entry.ID).Scan(&exists)
+		if err == nil && exists == 1 {
+			_, err = tx.Exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ?", entry.ID)
+		} else if err == nil {
+			_, err = tx.Exec("INSERT INTO videos (user_id, video_id, provider, external_id, title, requested_by_ip, duration, channel_name) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+				userID, entry.ID, sources.ProviderYoutube, entry.ID, entry.Title, c.IP(), int(math.Round(entry.Duration)), entry.Channel)
+			added = append(added, entry.ID)
+		}
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO playlist_videos (playlist_id, video_id, position) VALUES (?, ?, ?)", id, entry.ID, i+1)
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error":      "Error al insertar los videos de la lista de reproducción",
+				"errorTrace": err.Error(),
+			})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al guardar la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	// Guardar las miniaturas de los videos nuevos en segundo plano, de una en una para no saturar YouTube
+	go func(videoIDs []string) {
+		for _, videoID := range videoIDs {
+			if _, err := jobs.EnsureThumbnail(context.Background(), videoID, ""); err != nil {
+				fmt.Printf("No se pudo guardar la miniatura de %s: %v\n", videoID, err)
+			}
+		}
+	}(added)
+
+	return c.JSON(fiber.Map{
+		"message":    "Lista de reproducción agregada correctamente",
+		"playlistID": playlistID,
+		"title":      playlist.Title,
+		"videos":     len(entries),
+		"added":      len(added),
+		"existing":   len(entries) - len(added),
+		"truncated":  truncated,
+	})
+}
+
+// GetPlaylists obtiene todas las listas de reproducción con su número de videos
+func GetPlaylists(c *fiber.Ctx) error {
+	rows, err := db.DB.Query("SELECT " + playlistColumns + " FROM playlists ORDER BY id")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener las listas de reproducción",
+		})
+	}
+	defer rows.Close()
+
+	playlists := []models.Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error":      "Error al leer las listas de reproducción",
+				"errorTrace": err.Error(),
+			})
+		}
+		playlists = append(playlists, playlist)
+	}
+
+	return c.JSON(playlists)
+}
+
+// GetPlaylist obtiene una lista de reproducción con sus videos en orden
+func GetPlaylist(c *fiber.Ctx) error {
+	playlist, err := scanPlaylist(db.DB.QueryRow("SELECT "+playlistColumns+" FROM playlists WHERE playlist_id = ?", c.Params("playlist_id")))
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Lista de reproducción no encontrada",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener la lista de reproducción",
+		})
+	}
+
+	playlist.Videos, err = getPlaylistVideos(playlist.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los videos de la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(playlist)
+}
+
+// getPlaylistVideos obtiene los videos de una lista ordenados por posición
+func getPlaylistVideos(id int) ([]models.PlaylistVideo, error) {
+	rows, err := db.DB.Query(`SELECT playlist_videos.position, videos.video_id, videos.title, COALESCE(videos.duration, 0)
+		FROM playlist_videos JOIN videos ON videos.video_id = playlist_videos.video_id
+		WHERE playlist_videos.playlist_id = ? ORDER BY playlist_videos.position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []models.PlaylistVideo
+	for rows.Next() {
+		var video models.PlaylistVideo
+		if err := rows.Scan(&video.Position, &video.VideoID, &video.Title, &video.Duration); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// ProcessPlaylist encola el procesamiento de todos los videos de una lista con las mismas opciones que
+// POST /api/videos/:video_id/process. Los videos que ya tienen la variante o un trabajo pendiente se omiten
+func ProcessPlaylist(c *fiber.Ctx) error {
+	playlistID := c.Params("playlist_id")
+
+	options, err := parseProcessOptions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := validateBulkOptions(c, options); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	var id int
+	err = db.DB.QueryRow("SELECT id FROM playlists WHERE playlist_id = ?", playlistID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "La lista de reproducción no existe en la base de datos",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener la lista de reproducción",
+		})
+	}
+	videos, err := getPlaylistVideos(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los videos de la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	// Encolar un trabajo por video, un error en uno no impide encolar el resto
+	type Result struct {
+		Position int    `json:"position"`
+		VideoID  string `json:"video_id"`
+		Status   string `json:"status"`
+		JobID    int64  `json:"job_id,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}
+	resolution := options.key()
+	payload := options.payload()
+	results := []Result{}
+	queued := 0
+	for _, video := range videos {
+		result := Result{Position: video.Position, VideoID: video.VideoID}
+
+		if jobs.IsCompleted(video.VideoID, resolution) {
+			result.Status = models.Completed
+			results = append(results, result)
+			continue
+		}
+
+		result.JobID, err = jobs.Enqueue(userID, video.VideoID, resolution, payload)
+		switch {
+		case err == nil:
+			result.Status = models.Queued
+			queued++
+		case errors.Is(err, jobs.ErrAlreadyQueued):
+			result.Status = "already_queued"
+		default:
+			result.Status = models.Failed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Procesamiento de la lista encolado",
+		"playlistID": playlistID,
+		"resolution": resolution,
+		"queued":     queued,
+		"skipped":    len(results) - queued,
+		"audio":      payload.Audio,
+		"profile":    options.Profile,
+		"chapters":   options.Chapters,
+		"subtitles":  options.Subtitles,
+		"previews":   options.Previews,
+		"videos":     results,
+	})
+}
+
+// GetPlaylistStatus obtiene el estado de una variante (?resolution=, con las mismas opciones que el estado
+// de un video) en todos los videos de la lista, con el número de videos en cada estado y el avance total
+func GetPlaylistStatus(c *fiber.Ctx) error {
+	playlistID := c.Params("playlist_id")
+	resolution, err := variantFromQuery(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if resolution == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Debes indicar la resolución en ?resolution=",
+		})
+	}
+
+	var id int
+	err = db.DB.QueryRow("SELECT id FROM playlists WHERE playlist_id = ?", playlistID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Lista de reproducción no encontrada",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener la lista de reproducción",
+		})
+	}
+
+	status, err := getPlaylistStatus(id, resolution)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al leer el estado de la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+	status.PlaylistID = playlistID
+	return c.JSON(status)
+}
+
+// getPlaylistStatus calcula el estado de la variante en los videos de la lista. Un trabajo en cola tiene
+// prioridad sobre el estado anterior del video, por ejemplo al reintentar un procesamiento fallido
+func getPlaylistStatus(id int, resolution string) (models.PlaylistStatus, error) {
+	status := models.PlaylistStatus{
+		Resolution: resolution,
+		Counts:     map[string]int{},
+		Videos:     []models.PlaylistVideoStatus{},
+	}
+	rows, err := db.DB.Query(`SELECT playlist_videos.position, videos.video_id, videos.title,
+		CASE WHEN EXISTS(SELECT 1 FROM jobs WHERE jobs.video_id = videos.video_id AND jobs.resolution = ? AND jobs.status = ?) THEN ?
+			ELSE COALESCE(video_status.status, ?) END,
+		video_status.progress,
+		(SELECT COALESCE(jobs.error, '') FROM jobs WHERE jobs.video_id = videos.video_id AND jobs.resolution = ? ORDER BY jobs.id DESC LIMIT 1)
+		FROM playlist_videos JOIN videos ON videos.video_id = playlist_videos.video_id
+		LEFT JOIN video_status ON video_status.video_id = videos.video_id AND video_status.resolution = ?
+		WHERE playlist_videos.playlist_id = ? ORDER BY playlist_videos.position`,
+		resolution, models.Queued, models.Queued, models.NotRequested, resolution, resolution, id)
+	if err != nil {
+		return status, err
+	}
+	defer rows.Close()
+
+	var percent float64
+	for rows.Next() {
+		var video models.PlaylistVideoStatus
+		var progress *string
+		var jobError *string
+		if err := rows.Scan(&video.Position, &video.VideoID, &video.Title, &video.Status, &progress, &jobError); err != nil {
+			return status, err
+		}
+		if progress != nil && video.Status == models.Processing {
+			video.Progress = &models.Progress{}
+			if err := json.Unmarshal([]byte(*progress), video.Progress); err != nil {
+				video.Progress = nil
+			}
+		}
+		if jobError != nil && video.Status == models.Failed {
+			video.Error = *jobError
+		}
+
+		switch {
+		case video.Status == models.Completed:
+			percent += 100
+		case video.Progress != nil && video.Progress.Percent != nil:
+			percent += *video.Progress.Percent
+		}
+		status.Counts[video.Status]++
+		status.Videos = append(status.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return status, err
+	}
+
+	status.Total = len(status.Videos)
+	if status.Total > 0 {
+		status.Percent = math.Round(percent/float64(status.Total)*10) / 10
+	}
+	status.Finished = status.Total > 0 && status.Counts[models.Queued] == 0 && status.Counts[models.Processing] == 0
+	return status, nil
+}
+
+// DeletePlaylist elimina una lista de reproducción, sus videos y los archivos procesados se conservan
+func DeletePlaylist(c *fiber.Ctx) error {
+	var id int
+	err := db.DB.QueryRow("SELECT id FROM playlists WHERE playlist_id = ?", c.Params("playlist_id")).Scan(&id)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Lista de reproducción no encontrada",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener la lista de reproducción",
+		})
+	}
+
+	tx, err := db.DB.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		if _, err = tx.Exec("DELETE FROM playlist_videos WHERE playlist_id = ?", id); err == nil {
+			if _, err = tx.Exec("DELETE FROM playlists WHERE id = ?", id); err == nil {
+				err = tx.Commit()
+			}
+		}
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al eliminar la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Lista de reproducción eliminada correctamente",
+	})
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"yt-converter-api/db"
+	"yt-converter-api/pkg/sessions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCurrentUserSessions obtiene las sesiones abiertas del usuario autenticado, la del token de la petición
+// se marca con current
+func GetCurrentUserSessions(c *fiber.Ctx) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	list, err := sessions.List(strconv.Itoa(userID))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener las sesiones",
+			"errorTrace": err.Error(),
+		})
+	}
+	currentID := getSessionIDFromContext(c)
+	for i := range list {
+		list[i].Current = list[i].ID == currentID
+	}
+	return c.JSON(list)
+}
+
+// DeleteCurrentUserSession cierra una sesión del usuario autenticado
+func DeleteCurrentUserSession(c *fiber.Ctx) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+	sessionID, err := strconv.ParseInt(c.Params("session_id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "ID de sesión no válido",
+		})
+	}
+
+	// Solo se pueden cerrar las sesiones abiertas del propio usuario
+	list, err := sessions.List(strconv.Itoa(userID))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener las sesiones",
+			"errorTrace": err.Error(),
+		})
+	}
+	found := false
+	for _, session := range list {
+		if session.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "La sesión no existe o ya está cerrada",
+		})
+	}
+
+	if err := sessions.Revoke(sessionID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al cerrar la sesión",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Sesión cerrada correctamente",
+		"current": sessionID == getSessionIDFromContext(c),
+	})
+}
+
+// RevokeUserSessions cierra todas las sesiones de un usuario
+func RevokeUserSessions(c *fiber.Ctx) error {
+	userID := c.Params("user_id")
+
+	userExists := false
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&userExists)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al comprobar si el usuario existe",
+		})
+	}
+	if !userExists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "El usuario no existe",
+		})
+	}
+
+	revoked, err := sessions.RevokeUser(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al cerrar las sesiones del usuario",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Sesiones del usuario cerradas correctamente",
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,332 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/jobs"
+	"yt-converter-api/models"
+	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/sources"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Intervalo mínimo entre comprobaciones de una suscripción, en minutos
+const minSubscriptionInterval = 5
+
+// Número máximo de comprobaciones y videos que devuelve el historial
+const maxSubscriptionHistory = 500
+
+// CreateSubscription suscribe al usuario a un canal o a una lista de reproducción: cada IntervalMinutes se
+// comprueba la fuente y sus videos nuevos se agregan y se procesan con las opciones del formulario
+func CreateSubscription(c *fiber.Ctx) error {
+	url := c.FormValue("URL", c.FormValue("url"))
+	kind, sourceID := models.SubscriptionChannel, pkg.GetYoutubeChannelID(url)
+	if sourceID == "" {
+		kind, sourceID = models.SubscriptionPlaylist, pkg.GetYoutubePlaylistID(url)
+	}
+	if sourceID == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "La URL debe ser un canal (youtube.com/channel/UC...) o una lista de reproducción (youtube.com/playlist?list=...) de YouTube",
+		})
+	}
+	if !sources.Current.Enabled(sources.ProviderYoutube) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Los videos de YouTube no están habilitados en SOURCE_PROVIDERS",
+		})
+	}
+
+	interval := config.LoadConfig().SubscriptionInterval
+	if value := c.FormValue("IntervalMinutes"); value != "" {
+		var err error
+		if interval, err = strconv.Atoi(value); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "IntervalMinutes debe ser un número de minutos",
+			})
+		}
+	}
+	if interval < minSubscriptionInterval {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "El intervalo de comprobación debe ser de al menos " + strconv.Itoa(minSubscriptionInterval) + " minutos",
+		})
+	}
+	backfill := c.FormValue("Backfill", "false") == "true"
+
+	// Opciones con las que se procesan los videos, las mismas que al procesar una lista
+	options, err := parseProcessOptions(c)
+	if err == nil {
+		err = validateBulkOptions(c, options)
+	}
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	payload, err := json.Marshal(options.payload())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al guardar las opciones de procesamiento",
+		})
+	}
+
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	// Listar la fuente comprueba que existe y da los videos que ya tiene
+	playlist, err := jobs.ListSubscriptionSource(context.Background(), kind, sourceID)
+	if errors.Is(err, converter.ErrPlaylistUnavailable) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "El canal o la lista de reproducción no existe o no está disponible",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los videos del canal o de la lista de reproducción",
+			"errorTrace": err.Error(),
+		})
+	}
+	title := playlist.Title
+	if kind == models.SubscriptionChannel && playlist.Channel != "" {
+		title = playlist.Channel
+	}
+
+	res, err := db.DB.Exec(`INSERT INTO subscriptions (user_id, kind, source_id, title, resolution, payload, interval_minutes, requested_by_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, userID, kind, sourceID, title, options.key(), string(payload), interval, c.IP())
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{
+				"error": "Ya tienes una suscripción a esta fuente con la misma variante",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al crear la suscripción",
+			"errorTrace": err.Error(),
+		})
+	}
+	id, _ := res.LastInsertId()
+
+	// Los videos que ya tiene la fuente solo se procesan con Backfill
+	run, err := jobs.StartSubscription(id, playlist, backfill)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "La suscripción se ha creado pero no se han podido guardar sus videos actuales",
+			"errorTrace": err.Error(),
+		})
+	}
+	subscription, err := jobs.GetSubscription(id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener la suscripción",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":      "Suscripción creada correctamente",
+		"subscription": subscription,
+		"run":          run,
+	})
+}
+
+// GetSubscriptions obtiene las suscripciones del usuario, los administradores ven las de todos
+func GetSubscriptions(c *fiber.Ctx) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+	if isAdminContext(c) {
+		userID = 0
+	}
+
+	subscriptions, err := jobs.GetSubscriptions(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener las suscripciones",
+			"errorTrace": err.Error(),
+		})
+	}
+	return c.JSON(subscriptions)
+}
+
+// GetSubscription obtiene una suscripción
+func GetSubscription(c *fiber.Ctx) error {
+	subscription, status, message := subscriptionFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	return c.JSON(subscription)
+}
+
+// GetSubscriptionHistory obtiene las últimas comprobaciones (?limit=, 50 por defecto) de una suscripción y
+// los videos que ha encontrado
+func GetSubscriptionHistory(c *fiber.Ctx) error {
+	subscription, status, message := subscriptionFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > maxSubscriptionHistory {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit debe estar entre 1 y " + strconv.Itoa(maxSubscriptionHistory),
+		})
+	}
+
+	runs, err := jobs.GetSubscriptionRuns(subscription.ID, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener el historial de la suscripción",
+			"errorTrace": err.Error(),
+		})
+	}
+	videos, err := jobs.GetSubscriptionVideos(subscription.ID, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los videos de la suscripción",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"subscription": subscription,
+		"runs":         runs,
+		"videos":       videos,
+	})
+}
+
+// PauseSubscription deja de comprobar una suscripción hasta que se reanude
+func PauseSubscription(c *fiber.Ctx) error {
+	return setSubscriptionActive(c, false, "Suscripción pausada correctamente")
+}
+
+// ResumeSubscription vuelve a comprobar una suscripción pausada, los videos subidos mientras estaba pausada
+// se procesan en la siguiente comprobación
+func ResumeSubscription(c *fiber.Ctx) error {
+	return setSubscriptionActive(c, true, "Suscripción reanudada correctamente")
+}
+
+func setSubscriptionActive(c *fiber.Ctx, active bool, message string) error {
+	subscription, status, errMessage := subscriptionFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": errMessage,
+		})
+	}
+
+	_, err := db.DB.Exec("UPDATE subscriptions SET active = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", active, subscription.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al actualizar la suscripción",
+			"errorTrace": err.Error(),
+		})
+	}
+	subscription.Active = active
+
+	return c.JSON(fiber.Map{
+		"message":      message,
+		"subscription": subscription,
+	})
+}
+
+// CheckSubscription comprueba una suscripción en el momento, aunque esté pausada o no haya pasado su intervalo
+func CheckSubscription(c *fiber.Ctx) error {
+	subscription, status, message := subscriptionFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	run, err := jobs.CheckSubscription(context.Background(), subscription.ID)
+	if err != nil {
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{
+			"error":      "Error al comprobar la suscripción",
+			"errorTrace": err.Error(),
+			"run":        run,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Suscripción comprobada correctamente",
+		"run":     run,
+	})
+}
+
+// DeleteSubscription elimina una suscripción y su historial, los videos que ha agregado se conservan
+func DeleteSubscription(c *fiber.Ctx) error {
+	subscription, status, message := subscriptionFromParams(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	tx, err := db.DB.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		for _, query := range []string{
+			"DELETE FROM subscription_runs WHERE subscription_id = ?",
+			"DELETE FROM subscription_videos WHERE subscription_id = ?",
+			"DELETE FROM subscriptions WHERE id = ?",
+		} {
+			if _, err = tx.Exec(query, subscription.ID); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al eliminar la suscripción",
+			"errorTrace": err.Error(),
+		})
+	}
+	jobs.ForgetSubscription(subscription.ID)
+
+	return c.JSON(fiber.Map{
+		"message": "Suscripción eliminada correctamente",
+	})
+}
+
+// subscriptionFromParams obtiene la suscripción de :subscription_id, solo su usuario o un administrador
+// pueden acceder a ella. Si no se puede devuelve el código y el mensaje de error de la respuesta
+func subscriptionFromParams(c *fiber.Ctx) (*models.Subscription, int, string) {
+	id, err := strconv.ParseInt(c.Params("subscription_id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, "ID de suscripción no válido"
+	}
+	subscription, err := jobs.GetSubscription(id)
+	if err == sql.ErrNoRows {
+		return nil, http.StatusNotFound, "Suscripción no encontrada"
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Error al obtener la suscripción"
+	}
+
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Token inválido"
+	}
+	if subscription.UserID != userID && !isAdminContext(c) {
+		return nil, http.StatusForbidden, "Solo puedes acceder a tus suscripciones"
+	}
+	return subscription, 0, ""
+}
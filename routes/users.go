@@ -9,8 +9,11 @@ import (
 
 	"yt-converter-api/config"
 	"yt-converter-api/db"
+	"yt-converter-api/jobs"
 	"yt-converter-api/models"
 	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/sessions"
+	"yt-converter-api/pkg/thumbnails"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -94,7 +97,7 @@ func DeleteUser(c *fiber.Ctx) error {
 	message := "Usuario eliminado (desactivado) correctamente, si quiere eliminar el usuario, utiliza el parámetro 'forceDelete=true' en la URL, esto borrará el usuario y todos los videos convertidos de este usuario"
 	if forceDelete {
 		// Conseguir el path de todos los videos procesados de este usuario para borrarlos mas adelante
-		rows, err := db.DB.Query("SELECT s.id, s.video_id, s.resolution, s.path, s.status, s.created_at, s.updated_at FROM video_status s JOIN videos v ON v.video_id = s.video_id WHERE v.user_id = ?", id)
+		rows, err := db.DB.Query("SELECT s.id, s.video_id, s.resolution, COALESCE(s.path, ''), s.status, s.created_at, s.updated_at FROM video_status s JOIN videos v ON v.video_id = s.video_id WHERE v.user_id = ?", id)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Error al obtener las rutas de lo archivos de este usuario",
@@ -114,11 +117,40 @@ func DeleteUser(c *fiber.Ctx) error {
 			}
 			processed_videos = append(processed_videos, processed_video)
 		}
+		// Detener los procesamientos en curso de sus videos antes de borrar nada, con la misma lista se borran
+		// después sus miniaturas
+		videoRows, err := db.DB.Query("SELECT video_id FROM videos WHERE user_id = ?", id)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error":      "Error al obtener los videos del usuario",
+				"errorTrace": err.Error(),
+			})
+		}
+		var videoIDs []string
+		for videoRows.Next() {
+			var videoID string
+			if err := videoRows.Scan(&videoID); err != nil {
+				videoRows.Close()
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+					"error":      "Error al obtener los videos del usuario",
+					"errorTrace": err.Error(),
+				})
+			}
+			videoIDs = append(videoIDs, videoID)
+		}
+		videoRows.Close()
+		for _, videoID := range videoIDs {
+			jobs.CancelVideo(videoID)
+		}
+
 		// Borrar videos procesados
 		tx, _ := db.DB.Begin()
-		_, err = tx.Exec(`
+		_, err = tx.Exec("DELETE FROM video_status_files WHERE video_id IN (SELECT video_id FROM videos WHERE user_id = ?)", id)
+		if err == nil {
+			_, err = tx.Exec(`
     DELETE FROM video_status 
     WHERE video_id IN (SELECT video_id FROM videos WHERE user_id = ?)`, id)
+		}
 
 		if err != nil {
 			tx.Rollback()
@@ -126,6 +158,54 @@ func DeleteUser(c *fiber.Ctx) error {
 				"error": "Error al eliminar los videos procesados del usuario",
 			})
 		}
+		// Borrar trabajos de sus videos y los que haya solicitado
+		_, err = tx.Exec("DELETE FROM jobs WHERE user_id = ? OR video_id IN (SELECT video_id FROM videos WHERE user_id = ?)", id, id)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error al eliminar los trabajos del usuario",
+			})
+		}
+		// Borrar sus listas de reproducción y quitar sus videos de las del resto
+		_, err = tx.Exec("DELETE FROM playlist_videos WHERE playlist_id IN (SELECT id FROM playlists WHERE user_id = ?) OR video_id IN (SELECT video_id FROM videos WHERE user_id = ?)", id, id)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM playlists WHERE user_id = ?", id)
+		}
+		if err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error al eliminar las listas de reproducción del usuario",
+			})
+		}
+		// Borrar sus suscripciones y su historial
+		_, err = tx.Exec("DELETE FROM subscription_runs WHERE subscription_id IN (SELECT id FROM subscriptions WHERE user_id = ?)", id)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM subscription_videos WHERE subscription_id IN (SELECT id FROM subscriptions WHERE user_id = ?)", id)
+		}
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM subscriptions WHERE user_id = ?", id)
+		}
+		if err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error al eliminar las suscripciones del usuario",
+			})
+		}
+		// Borrar sus sesiones, sus tokens de acceso dejan de valer aunque no hayan caducado
+		if err := sessions.DeleteUserTx(tx, id); err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error al eliminar las sesiones del usuario",
+			})
+		}
+		// Borrar sus API keys
+		_, err = tx.Exec("DELETE FROM api_keys WHERE user_id = ?", id)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error al eliminar las API keys del usuario",
+			})
+		}
 		// Borrar videos
 		_, err = tx.Exec("DELETE FROM videos WHERE user_id = ?", id)
 		if err != nil {
@@ -145,8 +225,13 @@ func DeleteUser(c *fiber.Ctx) error {
 		// Borrar videos procesados de este usuario
 		if len(processed_videos) != 0 {
 			for _, video := range processed_videos {
+				// Los procesamientos fallidos o cancelados no tienen archivo
+				if video.Path == "" {
+					continue
+				}
 				if _, err := os.Stat(video.Path); err == nil {
-					err := os.Remove(video.Path)
+					// Las variantes por capítulos son una carpeta con una pista por capítulo
+					err := os.RemoveAll(video.Path)
 					if err != nil {
 						tx.Rollback()
 						return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -164,6 +249,12 @@ func DeleteUser(c *fiber.Ctx) error {
 			}
 		}
 		tx.Commit()
+		storagePath := config.LoadConfig().StoragePath
+		for _, videoID := range videoIDs {
+			if err := os.RemoveAll(thumbnails.Dir(storagePath, videoID)); err != nil {
+				fmt.Println("Error borrando las miniaturas del video:", err)
+			}
+		}
 		message = "Usuario eliminado correctamente"
 	} else {
 		_, err := db.DB.Exec("UPDATE users SET active = false, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
@@ -172,6 +263,13 @@ func DeleteUser(c *fiber.Ctx) error {
 				"error": "Error al eliminar el usuario",
 			})
 		}
+		// Cerrar sus sesiones, sus tokens dejan de valer aunque no hayan caducado
+		if _, err := sessions.RevokeUser(id); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error":      "Usuario desactivado, pero ha ocurrido un error al cerrar sus sesiones",
+				"errorTrace": err.Error(),
+			})
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -233,7 +331,7 @@ func GetUserVideos(c *fiber.Ctx) error {
 	}
 
 	// Obtener los videos del usuario
-	rows, err := db.DB.Query("SELECT * FROM videos WHERE user_id = ?", userIDInt)
+	rows, err := db.DB.Query("SELECT "+videoColumns+" FROM videos WHERE user_id = ?", userIDInt)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al obtener los videos del usuario",
@@ -243,8 +341,7 @@ func GetUserVideos(c *fiber.Ctx) error {
 
 	var videos []models.Video
 	for rows.Next() {
-		var video models.Video
-		err := rows.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt)
+		video, err := scanVideo(rows)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Error al obtener los videos del usuario",
@@ -290,7 +387,7 @@ func GetCurrentUser(c *fiber.Ctx) error {
 		}
 	}
 
-	rows, err = db.DB.Query("SELECT * FROM videos WHERE user_id = ?", userID)
+	rows, err = db.DB.Query("SELECT "+videoColumns+" FROM videos WHERE user_id = ?", userID)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al obtener los videos del usuario",
@@ -300,8 +397,7 @@ func GetCurrentUser(c *fiber.Ctx) error {
 
 	var videos []models.Video
 	for rows.Next() {
-		var video models.Video
-		err := rows.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt)
+		video, err := scanVideo(rows)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Error al obtener los videos del usuario",
@@ -321,7 +417,7 @@ func GetCurrentUser(c *fiber.Ctx) error {
 // GetVideoByUser Obtiene los videos de un usuario
 func GetVideoByUser(c *fiber.Ctx) error {
 	userID := c.Params("user_id")
-	rows, err := db.DB.Query("SELECT * FROM videos WHERE user_id = ?", userID)
+	rows, err := db.DB.Query("SELECT "+videoColumns+" FROM videos WHERE user_id = ?", userID)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al obtener los videos",
@@ -331,8 +427,7 @@ func GetVideoByUser(c *fiber.Ctx) error {
 
 	var videos []models.Video
 	for rows.Next() {
-		var video models.Video
-		err := rows.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt)
+		video, err := scanVideo(rows)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{})
 		}
@@ -414,6 +509,16 @@ func UpdateUser(c *fiber.Ctx) error {
 		user.Active = true
 	}
 
+	// Leer los datos actuales para cerrar sus sesiones si cambia la contraseña o el rol o se desactiva
+	var previous models.User
+	err = db.DB.QueryRow("SELECT password, role, active FROM users WHERE id = ?", userID).Scan(&previous.Password, &previous.Role, &previous.Active)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener el usuario",
+		})
+	}
+	revokeSessions := previous.Role != user.Role || (previous.Active && !user.Active) || !pkg.ComparePassword(previous.Password, user.Password)
+
 	// Hashear contraseña y agregarlo a la base de datos
 	user.Password = pkg.GeneratePassword(user.Password)
 
@@ -425,7 +530,17 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	if revokeSessions {
+		if _, err := sessions.RevokeUser(userID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error":      "Usuario actualizado, pero ha ocurrido un error al cerrar sus sesiones",
+				"errorTrace": err.Error(),
+			})
+		}
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "Usuario actualizado correctamente",
+		"message":         "Usuario actualizado correctamente",
+		"sessionsRevoked": revokeSessions,
 	})
 }
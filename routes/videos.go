@@ -1,18 +1,31 @@
 package routes
 
 import (
+	"archive/zip"
+	"bufio"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
-	"os/exec"
-	"slices"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"yt-converter-api/config"
 	"yt-converter-api/db"
+	"yt-converter-api/jobs"
 	"yt-converter-api/models"
 	"yt-converter-api/pkg"
+	"yt-converter-api/pkg/cache"
+	"yt-converter-api/pkg/converter"
+	"yt-converter-api/pkg/metadata"
+	"yt-converter-api/pkg/sources"
+	"yt-converter-api/pkg/subtitles"
+	"yt-converter-api/pkg/thumbnails"
+	"yt-converter-api/pkg/transcode"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -20,7 +33,7 @@ import (
 
 // GetVideos obtiene la lista de videos íntegra
 func GetVideos(c *fiber.Ctx) error {
-	rows, err := db.DB.Query("SELECT * FROM videos")
+	rows, err := db.DB.Query("SELECT " + videoColumns + " FROM videos")
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al obtener los videos",
@@ -30,8 +43,7 @@ func GetVideos(c *fiber.Ctx) error {
 
 	var videos []models.Video
 	for rows.Next() {
-		var video models.Video
-		err := rows.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt)
+		video, err := scanVideo(rows)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{})
 		}
@@ -41,7 +53,8 @@ func GetVideos(c *fiber.Ctx) error {
 	return c.JSON(videos)
 }
 
-// AddVideo agrega un nuevo video si no existe
+// AddVideo agrega un nuevo video si no existe, de YouTube o de cualquiera de los sitios habilitados en
+// SOURCE_PROVIDERS. Las listas de reproducción de YouTube agregan todos sus videos
 func AddVideo(c *fiber.Ctx) error {
 	type Request struct {
 		URL string `json:"url"`
@@ -73,65 +86,79 @@ func AddVideo(c *fiber.Ctx) error {
 		})
 	}
 
-	// Comprobar la validez de la URL
+	// Comprobar la validez de la URL, que se puede escribir sin esquema como youtu.be/dQw4w9WgXcQ
+	request.URL = pkg.WithScheme(strings.TrimSpace(request.URL))
 	if !pkg.IsUrl(request.URL) {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
 			"error": "URL no válida",
 		})
 	}
 
-	// Comprobar si la URL es un video de Youtube
-	valid, err := pkg.IsYoutubeUrl(request.URL)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "La URL no es una URL válida de Youtube",
-		})
+	// Las listas de reproducción se expanden en un video por entrada
+	if playlistID := pkg.GetYoutubePlaylistID(request.URL); playlistID != "" && sources.Current.Enabled(sources.ProviderYoutube) {
+		return addPlaylist(c, userIDInt, playlistID)
 	}
 
-	if !valid {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "URL no es un video de Youtube",
-		})
-	}
-
-	// Obtener el ID del video y el título
-	videoTitle, err := pkg.GetYoutubeVideoTitle(request.URL)
+	// Reconocer el sitio del video con los proveedores habilitados en SOURCE_PROVIDERS
+	source, err := sources.Current.Parse(request.URL)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error al obtener el título del video",
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "La URL no es un video de ninguno de los sitios habilitados (" + sources.Current.Name() + ")",
 		})
 	}
 
-	// Insertar el video en la base de datos
-	video := models.Video{
-		UserID:        userIDInt,
-		VideoID:       pkg.GetYoutubeVideoID(request.URL),
-		Title:         videoTitle,
-		RequestedByIP: c.IP(),
-	}
-
-	// Comprobar si el video ya existe en la base de datos
+	// Comprobar si el video ya existe en la base de datos antes de consultar a los proveedores
+	videoID := source.VideoID()
 	var exists int
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM videos WHERE video_id = ?)", video.VideoID).Scan(&exists)
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM videos WHERE video_id = ?)", videoID).Scan(&exists)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al verificar si el video existe",
 		})
 	}
 	if exists == 1 {
-		_, err = db.DB.Exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ?", pkg.GetYoutubeVideoID(request.URL))
+		_, err = db.DB.Exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ?", videoID)
 		msg := ""
 		if err != nil {
 			msg = "Ademas ha ocurrido un error al intentar actualizar la fecha actual del video que se quería agregar"
 		}
 		return c.JSON(fiber.Map{
 			"error":     "El video ya existe en la base de datos",
-			"videoID":   video.VideoID,
+			"videoID":   videoID,
 			"extraInfo": msg,
 		})
 	}
 
-	_, err = db.DB.Exec("INSERT INTO videos (user_id, video_id, title, requested_by_ip) VALUES (?, ?, ?, ?)", video.UserID, video.VideoID, video.Title, video.RequestedByIP)
+	// Obtener el título y el resto de metadatos con los proveedores configurados, que también comprueban que
+	// el video existe sin descargar la URL indicada
+	videoInfo, err := metadata.Current.Fetch(context.Background(), source.Ref())
+	if errors.Is(err, metadata.ErrNotFound) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "El video no existe o no está disponible",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener el título del video",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	// Insertar el video en la base de datos
+	video := models.Video{
+		UserID:        userIDInt,
+		VideoID:       videoID,
+		Provider:      source.Provider,
+		ExternalID:    source.ExternalID,
+		Title:         videoInfo.Title,
+		RequestedByIP: c.IP(),
+	}
+
+	_, err = db.DB.Exec(`INSERT INTO videos (user_id, video_id, provider, external_id, title, requested_by_ip, duration, channel_name, channel_id, upload_date,
+		description, view_count, thumbnail_url, is_live, is_short, age_restricted, metadata_provider, metadata_updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		video.UserID, video.VideoID, video.Provider, video.ExternalID, video.Title, video.RequestedByIP, videoInfo.Duration, videoInfo.ChannelName, videoInfo.ChannelID, videoInfo.UploadDate,
+		videoInfo.Description, videoInfo.ViewCount, videoInfo.ThumbnailURL, videoInfo.IsLive, videoInfo.IsShort, videoInfo.AgeRestricted, videoInfo.Provider)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error":      "Error al insertar el video",
@@ -139,39 +166,111 @@ func AddVideo(c *fiber.Ctx) error {
 		})
 	}
 
+	// Guardar la miniatura en segundo plano, si falla se vuelve a intentar al pedirla
+	go func(videoID string, thumbnailURL string) {
+		if _, err := jobs.EnsureThumbnail(context.Background(), videoID, thumbnailURL); err != nil {
+			fmt.Printf("No se pudo guardar la miniatura de %s: %v\n", videoID, err)
+		}
+	}(video.VideoID, videoInfo.ThumbnailURL)
+
 	return c.JSON(fiber.Map{
-		"message": "Video agregado correctamente",
-		"videoID": video.VideoID,
+		"message":  "Video agregado correctamente",
+		"videoID":  video.VideoID,
+		"provider": video.Provider,
 	})
 }
 
-// GetVideo Obtiene un video en base del video_id
+// GetVideo Obtiene un video en base del video_id, incluyendo sus metadatos
 func GetVideo(c *fiber.Ctx) error {
 	videoID := c.Params("video_id")
-	rows, err := db.DB.Query("SELECT * FROM videos WHERE video_id = ?", videoID)
+	video, err := scanVideo(db.DB.QueryRow("SELECT "+videoColumns+" FROM videos WHERE video_id = ?", videoID))
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Video no encontrado",
+		})
+	}
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Error al obtener los videos",
 		})
 	}
-	defer rows.Close()
 
-	var video models.Video
-	rows.Next()
-	err = rows.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt)
+	return c.JSON(video)
+}
+
+// RefreshVideoMetadata vuelve a obtener los metadatos de un video con los proveedores configurados
+func RefreshVideoMetadata(c *fiber.Ctx) error {
+	videoID := c.Params("video_id")
+
+	// Verificar existencia del video
+	var exists int
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM videos WHERE video_id = ?)", videoID).Scan(&exists); err != nil || exists == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Video no encontrado",
+		})
+	}
+
+	// Descartar los metadatos guardados en caché para consultar de nuevo a los proveedores
+	ref := jobs.VideoSource(videoID).Ref()
+	if _, err := cache.Invalidate(ref, cache.KindMetadata); err != nil {
+		fmt.Println("Error invalidando la caché de metadatos:", err)
+	}
+
+	videoInfo, err := metadata.Current.Fetch(context.Background(), ref)
+	if errors.Is(err, metadata.ErrNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "El video ya no existe o no está disponible",
+		})
+	}
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{})
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{
+			"error":      "Error al obtener los metadatos del video",
+			"errorTrace": err.Error(),
+		})
 	}
 
-	return c.JSON(video)
+	_, err = db.DB.Exec(`UPDATE videos SET title = ?, duration = ?, channel_name = ?, channel_id = ?, upload_date = ?, description = ?,
+		view_count = ?, thumbnail_url = ?, is_live = ?, is_short = ?, age_restricted = ?, metadata_provider = ?,
+		metadata_updated_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE video_id = ?`,
+		videoInfo.Title, videoInfo.Duration, videoInfo.ChannelName, videoInfo.ChannelID, videoInfo.UploadDate, videoInfo.Description,
+		videoInfo.ViewCount, videoInfo.ThumbnailURL, videoInfo.IsLive, videoInfo.IsShort, videoInfo.AgeRestricted, videoInfo.Provider, videoID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al actualizar los metadatos del video",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	return GetVideo(c)
+}
+
+// InvalidateVideoCache borra los formatos y metadatos de un video guardados en caché
+func InvalidateVideoCache(c *fiber.Ctx) error {
+	videoID := c.Params("video_id")
+
+	deleted, err := cache.Invalidate(jobs.VideoSource(videoID).Ref())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al invalidar la caché del video",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Caché del video invalidada",
+		"deleted": deleted,
+	})
 }
 
 // DeleteVideo Elimina un video de la base de datos
 func DeleteVideo(c *fiber.Ctx) error {
 	videoID := c.Params("video_id")
+	ref := jobs.VideoSource(videoID).Ref()
+	// Detener los procesamientos en curso antes de borrar nada
+	jobs.CancelVideo(videoID)
 	tx, _ := db.DB.Begin()
 	// Get all video_status for the video, there can be multiple
-	rows, err := tx.Query("SELECT * FROM video_status WHERE video_id = ?", videoID)
+	rows, err := tx.Query("SELECT id, video_id, resolution, COALESCE(path, ''), status, created_at, updated_at FROM video_status WHERE video_id = ?", videoID)
 	if err != nil {
 		tx.Rollback()
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -191,7 +290,10 @@ func DeleteVideo(c *fiber.Ctx) error {
 	}
 
 	// Delete processed videos
-	_, err = tx.Exec("DELETE FROM video_status WHERE video_id = ?", videoID)
+	_, err = tx.Exec("DELETE FROM video_status_files WHERE video_id = ?", videoID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM video_status WHERE video_id = ?", videoID)
+	}
 	if err != nil {
 		tx.Rollback()
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -199,6 +301,18 @@ func DeleteVideo(c *fiber.Ctx) error {
 			"errorTrace": err.Error(),
 		})
 	}
+	// Quitar el video de las listas de reproducción y borrar sus trabajos
+	_, err = tx.Exec("DELETE FROM playlist_videos WHERE video_id = ?", videoID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM jobs WHERE video_id = ?", videoID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al eliminar los trabajos del video",
+			"errorTrace": err.Error(),
+		})
+	}
 	// Delete video
 	_, err = tx.Exec("DELETE FROM videos WHERE video_id = ?", videoID)
 	if err != nil {
@@ -212,8 +326,13 @@ func DeleteVideo(c *fiber.Ctx) error {
 	// Borrar videos procesados de este usuario
 	if len(processed_videos) != 0 {
 		for _, video := range processed_videos {
+			// Los procesamientos fallidos o cancelados no tienen archivo
+			if video.Path == "" {
+				continue
+			}
 			if _, err := os.Stat(video.Path); err == nil {
-				err := os.Remove(video.Path)
+				// Las variantes por capítulos son una carpeta con una pista por capítulo
+				err := os.RemoveAll(video.Path)
 				if err != nil {
 					tx.Rollback()
 					return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -231,12 +350,18 @@ func DeleteVideo(c *fiber.Ctx) error {
 		}
 	}
 	tx.Commit()
+	if err := os.RemoveAll(thumbnails.Dir(config.LoadConfig().StoragePath, videoID)); err != nil {
+		fmt.Println("Error borrando las miniaturas del video:", err)
+	}
+	if _, err := cache.Invalidate(ref); err != nil {
+		fmt.Println("Error invalidando la caché del video:", err)
+	}
 	return c.JSON(fiber.Map{
 		"message": "Video eliminado correctamente",
 	})
 }
 
-// Obtiene las resoluciones disponibles para un video
+// Obtiene los formatos disponibles para un video (resolución, fps, códecs, HDR, contenedor, bitrate y tamaño)
 func GetVideoFormats(c *fiber.Ctx) error {
 	videoID := c.Params("video_id")
 
@@ -279,10 +404,7 @@ func GetVideoFormats(c *fiber.Ctx) error {
 	}
 
 	// Verificar existencia del video
-	row := db.DB.QueryRow("SELECT id, user_id, video_id, title, requested_by_ip, created_at, updated_at FROM videos WHERE video_id = ?", videoID)
-
-	var video models.Video
-	err := row.Scan(&video.ID, &video.UserID, &video.VideoID, &video.Title, &video.RequestedByIP, &video.CreatedAt, &video.UpdatedAt)
+	video, err := scanVideo(db.DB.QueryRow("SELECT "+videoColumns+" FROM videos WHERE video_id = ?", videoID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -294,24 +416,122 @@ func GetVideoFormats(c *fiber.Ctx) error {
 		})
 	}
 
-	// Obtener resoluciones pasando el path del archivo cookies si existe (vacío si no)
-	resolutions, err := pkg.GetYoutubeVideoResolutions(video.VideoID, cookiesPath)
+	// Con ?refresh=true se descartan los formatos guardados en caché
+	ref := jobs.VideoSource(video.VideoID).Ref()
+	if c.QueryBool("refresh") {
+		if _, err := cache.Invalidate(ref, cache.KindFormats); err != nil {
+			fmt.Println("Error invalidando la caché de formatos:", err)
+		}
+	}
+
+	// Obtener formatos pasando el path del archivo cookies si existe (vacío si no)
+	formats, err := converter.Current.ListFormats(context.Background(), ref, cookiesPath)
+	if errors.Is(err, converter.ErrVideoUnavailable) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	return c.JSON(resolutions)
+	return c.JSON(formats)
+}
+
+// GetTranscodeProfiles obtiene los perfiles de transcodificación que se pueden usar en POST /process
+func GetTranscodeProfiles(c *fiber.Ctx) error {
+	return c.JSON(transcode.List())
+}
+
+// GetVideoSubtitles obtiene los subtítulos disponibles de un video, manuales y automáticos, por idioma
+func GetVideoSubtitles(c *fiber.Ctx) error {
+	videoID := c.Params("video_id")
+
+	// Verificar existencia del video
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM videos WHERE video_id = ?", videoID).Scan(&count); err != nil || count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Video no encontrado",
+		})
+	}
+
+	info, err := converter.Current.Probe(context.Background(), jobs.VideoSource(videoID).Ref(), "")
+	if errors.Is(err, converter.ErrVideoUnavailable) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener los subtítulos del video",
+			"errorTrace": err.Error(),
+		})
+	}
+
+	available := info.Subtitles
+	if available == nil {
+		available = []converter.Subtitle{}
+	}
+	return c.JSON(fiber.Map{
+		"subtitles": available,
+		"formats":   subtitles.Formats(),
+	})
+}
+
+// GetVideoThumbnail sirve la miniatura guardada del video (?type=thumbnail), la hoja de contactos
+// (?type=sheet) o la vista previa animada (?type=preview) en el tamaño de ?size=
+func GetVideoThumbnail(c *fiber.Ctx) error {
+	videoID := c.Params("video_id")
+	kind := c.Query("type", thumbnails.KindThumbnail)
+	size := c.Query("size", thumbnails.SizeLarge)
+
+	var thumbnailURL string
+	err := db.DB.QueryRow("SELECT COALESCE(thumbnail_url, '') FROM videos WHERE video_id = ?", videoID).Scan(&thumbnailURL)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Video no encontrado",
+		})
+	}
+
+	// Los videos agregados antes de guardar las miniaturas o cuya descarga falló la descargan ahora
+	if kind == thumbnails.KindThumbnail {
+		if _, err := jobs.EnsureThumbnail(context.Background(), videoID, thumbnailURL); err != nil {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{
+				"error":      "No se pudo obtener la miniatura del video",
+				"errorTrace": err.Error(),
+			})
+		}
+	}
+
+	path, err := thumbnails.Path(thumbnails.Dir(config.LoadConfig().StoragePath, videoID), kind, size)
+	if errors.Is(err, thumbnails.ErrNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "La imagen no existe, procesa el video con Previews para generar la hoja de contactos y la vista previa",
+		})
+	}
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	return c.SendFile(path)
 }
 
 // Procesa un video de forma asíncrona obteniendo la resolución indicada por POST
 func ProcessVideo(c *fiber.Ctx) error {
 	videoID := c.Params("video_id")
 
-	// Leer los campos de texto del formulario
-	resolution := c.FormValue("Resolution", "720p") // valor por defecto
-	isAudio := c.FormValue("IsAudio", "false") == "true"
+	// Leer y validar las opciones del formulario
+	options, err := parseProcessOptions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
 	// Obtener el archivo cookies.txt (si existe)
 	fileHeader, err := c.FormFile("cookies")
@@ -342,118 +562,132 @@ func ProcessVideo(c *fiber.Ctx) error {
 	row := db.DB.QueryRow("SELECT COUNT(*) FROM videos WHERE video_id = ?", videoID)
 	var count int
 	if err := row.Scan(&count); err != nil || count == 0 {
+		os.Remove(cookiesPath)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "El video no existe en la base de datos",
 		})
 	}
 
-	// Procesar el video en segundo plano
-	go func() {
-		// Limpiar archivo después de usarlo
-		defer os.Remove(cookiesPath)
-		if _, err := ProcessYoutubeVideo(videoID, resolution, isAudio, cookiesPath); err != nil {
-			fmt.Printf("Error procesando video: %v\n", err)
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		os.Remove(cookiesPath)
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+
+	// Un formato concreto se valida ahora y el video se guarda con su descriptor como resolución
+	var format *converter.Format
+	if options.Format != "" {
+		formats, err := converter.Current.ListFormats(context.Background(), jobs.VideoSource(videoID).Ref(), cookiesPath)
+		if err == nil {
+			format, err = converter.SelectFormat(formats, options.Format)
 		}
-		_, err := db.DB.Exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ?", videoID)
 		if err != nil {
-			fmt.Printf("Error actualizando el video: %v\n", err)
+			os.Remove(cookiesPath)
+			status := http.StatusInternalServerError
+			if errors.Is(err, converter.ErrVideoUnavailable) {
+				status = http.StatusNotFound
+			} else if formats != nil {
+				status = http.StatusBadRequest
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
-	}()
-
-	return c.JSON(fiber.Map{
-		"message": "Procesamiento iniciado",
-	})
-}
+		options.Resolution = format.Descriptor
+	}
 
-// Procesa un video de Youtube de forma asíncrona
-func ProcessYoutubeVideo(videoID string, resolution string, isAudio bool, cookiesPath string) (string, error) {
-	// Comprobar si la resolución está disponible solo si se va a descargar video
-	if !isAudio {
-		resolutions, err := pkg.GetYoutubeVideoResolutions(videoID, cookiesPath)
-		if err != nil {
-			return "", fmt.Errorf("error al obtener las resoluciones del video: %v", err)
-		}
-		if !slices.Contains(resolutions, resolution) {
-			return "", fmt.Errorf("la resolución %s no está disponible", resolution)
+	// El fragmento tiene que estar dentro del video si se conoce su duración
+	if options.Clip != nil {
+		var duration float64
+		_ = db.DB.QueryRow("SELECT COALESCE(duration, 0) FROM videos WHERE video_id = ?", videoID).Scan(&duration)
+		if err := options.Clip.Validate(duration); err != nil {
+			os.Remove(cookiesPath)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
-	} else {
-		resolution = "mp3"
 	}
 
-	// Comprobar si ya está procesado con esa resolución
-	var exists int
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM video_status WHERE video_id = ? AND resolution = ? and status = ?)", videoID, resolution, "completed").Scan(&exists)
-	if err != nil {
-		return "", fmt.Errorf("error al verificar si el video ya está procesado: %v", err)
-	}
-	if exists == 1 {
-		_, _ = db.DB.Exec("UPDATE video_status SET updated_at = CURRENT_TIMESTAMP WHERE video_id = ? and resolution = ? and status = ?", videoID, resolution, "completed")
-		return "", fmt.Errorf("el video con id %v y resolución %v ya está procesado", videoID, resolution)
+	resolution := options.key()
+	payload := options.payload()
+	payload.CookiesPath = cookiesPath
+	if format != nil {
+		payload.FormatID = format.ID
 	}
 
-	// Borrar estado fallido previo
-	_, _ = db.DB.Exec("DELETE FROM video_status WHERE video_id = ? AND resolution = ? and status = ?", videoID, resolution, "failed")
-
-	// Insertar nuevo estado: procesando
-	_, err = db.DB.Exec("INSERT INTO video_status (video_id, resolution, status) VALUES (?, ?, ?)", videoID, resolution, "processing")
+	// Encolar el trabajo, los workers lo procesarán en segundo plano
+	jobID, err := jobs.Enqueue(userID, videoID, resolution, payload)
 	if err != nil {
-		return "", fmt.Errorf("error al insertar el estado del video: %v", err)
-	}
-
-	// Construir comando dinámico
-	args := []string{
-		config.LoadConfig().PyConverterPath,
-		videoID,
-	}
-	if isAudio {
-		args = append(args, "audio", config.LoadConfig().StoragePath)
-	} else {
-		args = append(args, "video", config.LoadConfig().StoragePath, "--resolution", resolution)
-	}
-
-	if cookiesPath != "" {
-		args = append(args, "--cookies", cookiesPath)
-		fmt.Println("Usando archivo de cookies en:", cookiesPath)
+		os.Remove(cookiesPath)
+		if errors.Is(err, jobs.ErrAlreadyQueued) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{
+				"error": "Ya hay un procesamiento pendiente para este video y resolución",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al encolar el procesamiento",
+			"errorTrace": err.Error(),
+		})
 	}
 
-	// Mostrar comando por consola
-	fmt.Println("Ejecutando comando:", "/usr/bin/python3", strings.Join(args, " "))
+	return c.JSON(fiber.Map{
+		"message":    "Procesamiento encolado",
+		"jobID":      jobID,
+		"resolution": resolution,
+		"format":     format,
+		"audio":      payload.Audio,
+		"profile":    options.Profile,
+		"clip":       options.Clip,
+		"chapters":   options.Chapters,
+		"tags":       options.Tags,
+		"subtitles":  options.Subtitles,
+		"previews":   options.Previews,
+	})
+}
 
-	// Ejecutar comando
-	cmd := exec.Command("/usr/bin/python3", args...)
-	output, err := cmd.Output()
+// Cancela el procesamiento pendiente de un video con la resolución indicada en ?resolution=
+func CancelVideoProcess(c *fiber.Ctx) error {
+	videoID := c.Params("video_id")
+	resolution, err := variantFromQuery(c)
 	if err != nil {
-		// Fallo: marcar en base de datos
-		_, updateErr := db.DB.Exec("UPDATE video_status SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?", "failed", videoID, resolution)
-		if updateErr != nil {
-			fmt.Printf("Error actualizando estado a failed: %v\n", updateErr)
-		}
-		return "", fmt.Errorf("error al ejecutar el comando: %v, output: %v", err, string(output))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
-
-	// Obtener la última línea del output
-	outputLines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(outputLines) == 0 {
-		return "", fmt.Errorf("no se obtuvo output del comando")
+	if resolution == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Debes indicar la resolución a cancelar",
+		})
 	}
-	videoPath := outputLines[len(outputLines)-1]
 
-	// Si contiene "Error" en el output, se marca como fallido
-	if strings.Contains(videoPath, "Error") || strings.Contains(videoPath, "ERROR") {
-		_, updateErr := db.DB.Exec("UPDATE video_status SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?", "failed", videoID, resolution)
-		if updateErr != nil {
-			fmt.Printf("Error actualizando estado a failed: %v\n", updateErr)
+	job, err := jobs.FindPending(videoID, resolution)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "No hay ningún procesamiento pendiente para este video y resolución",
+			})
 		}
-		return "", fmt.Errorf("error procesando el video")
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error al obtener el procesamiento del video",
+		})
 	}
 
-	// Guardar estado exitoso con la ruta del archivo
-	_, err = db.DB.Exec("UPDATE video_status SET status = ?, path = ?, updated_at = CURRENT_TIMESTAMP WHERE video_id = ? AND resolution = ?", "completed", videoPath, videoID, resolution)
+	// Solo quien lo ha solicitado (o un administrador) puede cancelarlo
+	userID, err := getUserIDFromContext(c)
 	if err != nil {
-		return "", fmt.Errorf("error al actualizar el estado del video: %v", err)
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token inválido",
+		})
+	}
+	if job.UserID != userID && !isAdminContext(c) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "Solo puedes cancelar los procesamientos que has solicitado",
+		})
 	}
 
-	return videoPath, nil
+	return cancelJob(c, job.ID)
 }
 
 // Obtiene el estado del video, pueden haber varias resoluciones por video
@@ -476,54 +710,108 @@ func GetVideoStatus(c *fiber.Ctx) error {
 	}
 
 	// Si existe, obtenemos todos los estados
-	rows, err := db.DB.Query("SELECT id, video_id, resolution, path, status, created_at, updated_at FROM video_status WHERE video_id = ?", videoID)
+	videoStatus, err := getVideoStatuses(videoID)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error al obtener el estado del video",
+			"error":      "Error al leer el estado del video",
+			"errorTrace": err.Error(),
 		})
 	}
+
+	return c.JSON(videoStatus)
+}
+
+// getVideoStatuses obtiene todos los estados de procesamiento de un video
+func getVideoStatuses(videoID string) ([]models.VideoStatus, error) {
+	rows, err := db.DB.Query("SELECT id, video_id, resolution, path, status, COALESCE(format, ''), COALESCE(profile, ''), progress, loudness, created_at, updated_at FROM video_status WHERE video_id = ?", videoID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var videoStatus []models.VideoStatus
 	for rows.Next() {
 		var status models.VideoStatus
-		var path *string // Usamos un puntero para manejar NULL
+		var path *string     // Usamos un puntero para manejar NULL
+		var progress *string // El progreso se guarda como JSON
+		var loudness *string // Las medidas de la normalización también
 		err = rows.Scan(
 			&status.ID,
 			&status.VideoID,
 			&status.Resolution,
 			&path,
 			&status.Status,
+			&status.Format,
+			&status.Profile,
+			&progress,
+			&loudness,
 			&status.CreatedAt,
 			&status.UpdatedAt,
 		)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error":      "Error al leer el estado del video",
-				"errorTrace": err.Error(),
-			})
+			return nil, err
 		}
 		// Si path no es NULL, asignamos su valor
 		if path != nil {
 			status.Path = *path
 		}
+		if progress != nil {
+			status.Progress = &models.Progress{}
+			if err := json.Unmarshal([]byte(*progress), status.Progress); err != nil {
+				status.Progress = nil
+			}
+		}
+		if loudness != nil {
+			status.Loudness = &models.Loudness{}
+			if err := json.Unmarshal([]byte(*loudness), status.Loudness); err != nil {
+				status.Loudness = nil
+			}
+		}
 		videoStatus = append(videoStatus, status)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	if err = rows.Err(); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Error al procesar los resultados",
-		})
+	// Las variantes con varias pistas (capítulos) incluyen sus archivos
+	for i := range videoStatus {
+		videoStatus[i].Files, err = getStatusFiles(videoID, videoStatus[i].Resolution)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return videoStatus, nil
+}
 
-	return c.JSON(videoStatus)
+// getStatusFiles obtiene los archivos de una variante con varias pistas ordenados por posición
+func getStatusFiles(videoID string, resolution string) ([]models.File, error) {
+	rows, err := db.DB.Query("SELECT position, title, path, start_time, end_time FROM video_status_files WHERE video_id = ? AND resolution = ? ORDER BY position", videoID, resolution)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.File
+	for rows.Next() {
+		var file models.File
+		if err := rows.Scan(&file.Position, &file.Title, &file.Path, &file.Start, &file.End); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
 }
 
 // Descarga un video que ya ha sido procesado
 func DownloadVideo(c *fiber.Ctx) error {
 	videoID := c.Params("video_id")
-	// Get resolution from Query Params
-	resolution := c.Query("resolution")
+	// Get resolution from Query Params, con ?start=&end= o ?profile= se descarga el fragmento o la variante recodificada
+	resolution, err := variantFromQuery(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
 	// Comprobar si el video procesado ya existe en la base de datos
 	exists, err := db.DB.Query("SELECT COUNT(*) FROM video_status WHERE video_id = ? AND resolution = ?", videoID, resolution)
@@ -559,8 +847,10 @@ func DownloadVideo(c *fiber.Ctx) error {
 	}
 
 	// Comprobar si el path existe
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
 		// Borrar el estado del video en la base de datos
+		_, _ = db.DB.Exec("DELETE FROM video_status_files WHERE video_id = ? AND resolution = ?", videoID, resolution)
 		_, err = db.DB.Exec("DELETE FROM video_status WHERE video_id = ? AND resolution = ?", videoID, resolution)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -581,7 +871,83 @@ func DownloadVideo(c *fiber.Ctx) error {
 		})
 	}
 
+	// Las variantes por capítulos se descargan como ZIP o una sola pista con ?track=<número>
+	if info != nil && info.IsDir() {
+		return downloadTracks(c, videoID, resolution, title)
+	}
+
 	// Descargar el video
 	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+title+`"`)
 	return c.SendFile(path)
 }
+
+// downloadTracks descarga las pistas de una variante por capítulos, todas en un ZIP o la indicada en ?track=
+func downloadTracks(c *fiber.Ctx, videoID string, resolution string, title string) error {
+	files, err := getStatusFiles(videoID, resolution)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Error al obtener las pistas del video procesado",
+			"errorTrace": err.Error(),
+		})
+	}
+	if len(files) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "El video procesado no tiene pistas",
+		})
+	}
+
+	if c.Query("track") != "" {
+		track := c.QueryInt("track")
+		for _, file := range files {
+			if file.Position == track {
+				c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filepath.Base(file.Path)+`"`)
+				return c.SendFile(file.Path)
+			}
+		}
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "La pista indicada no existe",
+		})
+	}
+
+	// El ZIP se genera al enviarlo, sin comprimir porque el audio ya lo está
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+title+`.zip"`)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		archive := zip.NewWriter(w)
+		for _, file := range files {
+			if err := addToZip(archive, file.Path); err != nil {
+				fmt.Printf("Error al añadir %s al ZIP: %v\n", file.Path, err)
+				return
+			}
+		}
+		if err := archive.Close(); err != nil {
+			fmt.Println("Error al cerrar el ZIP:", err)
+		}
+	})
+	return nil
+}
+
+// addToZip añade un archivo al ZIP con su nombre, sin carpetas
+func addToZip(archive *zip.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Store
+	entry, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
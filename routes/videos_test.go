@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"yt-converter-api/config"
+	"yt-converter-api/db"
+	"yt-converter-api/jobs"
+	"yt-converter-api/pkg/converter"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestApp prepara la base de datos con el administrador 1, el invitado 2 y un video, el backend fake y
+// una aplicación con las rutas de procesamiento. El usuario de cada petición se indica con la cabecera
+// X-Test-User en lugar de un token, la autenticación se prueba en middleware
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	config.SetTestEnv(t, map[string]string{"STORAGE_PATH": t.TempDir()})
+	db.OpenTestDB(t)
+
+	previous := converter.Current
+	converter.Current = converter.NewFake()
+	t.Cleanup(func() { converter.Current = previous })
+
+	_, err := db.DB.Exec(`INSERT INTO users (username, password, role) VALUES ('admin', 'x', 'admin'), ('guest', 'x', 'guest');
+		INSERT INTO videos (user_id, video_id, external_id, title, requested_by_ip) VALUES (2, 'dQw4w9WgXcQ', 'dQw4w9WgXcQ', 'Video', '127.0.0.1')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		role := "guest"
+		if c.Get("X-Test-User") == "1" {
+			role = "admin"
+		}
+		c.Locals("jwt", &jwt.Token{Valid: true, Claims: jwt.MapClaims{"user_id": c.Get("X-Test-User"), "role": role}})
+		return c.Next()
+	})
+	app.Post("/api/videos/:video_id/process", ProcessVideo)
+	app.Delete("/api/videos/:video_id/process", CancelVideoProcess)
+	app.Get("/api/videos/:video_id/status", GetVideoStatus)
+	app.Get("/api/videos/:video_id/download", DownloadVideo)
+	app.Delete("/api/jobs/:job_id", CancelJob)
+	return app
+}
+
+// request hace una petición como el usuario indicado y devuelve el código y el cuerpo de la respuesta
+func request(t *testing.T, app *fiber.App, method string, target string, userID string, form url.Values) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Test-User", userID)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// processVideo encola el procesamiento del video en 720p y devuelve el ID del trabajo
+func processVideo(t *testing.T, app *fiber.App) int64 {
+	t.Helper()
+	code, body := request(t, app, http.MethodPost, "/api/videos/dQw4w9WgXcQ/process", "2", url.Values{"Resolution": {"720p"}})
+	if code != http.StatusOK {
+		t.Fatalf("POST /process = %d %s, se esperaba 200", code, body)
+	}
+	var response struct {
+		JobID int64 `json:"jobID"`
+	}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	return response.JobID
+}
+
+func TestProcessVideo(t *testing.T) {
+	app := newTestApp(t)
+
+	processVideo(t, app)
+	if code, body := request(t, app, http.MethodPost, "/api/videos/dQw4w9WgXcQ/process", "2", url.Values{"Resolution": {"720p"}}); code != http.StatusConflict {
+		t.Errorf("se esperaba 409 al repetir el procesamiento, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodPost, "/api/videos/aaaaaaaaaaa/process", "2", nil); code != http.StatusNotFound {
+		t.Errorf("se esperaba 404 con un video que no existe, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodPost, "/api/videos/dQw4w9WgXcQ/process", "2", url.Values{"Format": {"4320p"}}); code != http.StatusBadRequest {
+		t.Errorf("se esperaba 400 con un formato que no existe, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodPost, "/api/videos/dQw4w9WgXcQ/process", "2", url.Values{"Format": {"720p"}, "IsAudio": {"true"}}); code != http.StatusBadRequest {
+		t.Errorf("se esperaba 400 al combinar Format con IsAudio, se obtuvo %d %s", code, body)
+	}
+}
+
+func TestProcessAudioTagVariants(t *testing.T) {
+	app := newTestApp(t)
+
+	// Las etiquetas cambian el archivo, así que cada combinación es una variante distinta
+	resolutions := map[string]bool{}
+	for _, form := range []url.Values{
+		{"IsAudio": {"true"}},
+		{"IsAudio": {"true"}, "EmbedTags": {"false"}},
+		{"IsAudio": {"true"}, "TagArtist": {"Otro artista"}},
+		{"IsAudio": {"true"}, "TagArtist": {"Otro más"}},
+	} {
+		code, body := request(t, app, http.MethodPost, "/api/videos/dQw4w9WgXcQ/process", "2", form)
+		if code != http.StatusOK {
+			t.Fatalf("POST /process %v = %d %s, se esperaba 200", form, code, body)
+		}
+		var response struct {
+			Resolution string `json:"resolution"`
+		}
+		json.Unmarshal([]byte(body), &response)
+		resolutions[response.Resolution] = true
+	}
+	if len(resolutions) != 4 || !resolutions["mp3"] || !resolutions["mp3~notags"] {
+		t.Errorf("variantes = %v, se esperaban mp3, mp3~notags y dos mp3~tags-<hash>", resolutions)
+	}
+
+	// Las mismas etiquetas son la misma variante
+	code, body := request(t, app, http.MethodPost, "/api/videos/dQw4w9WgXcQ/process", "2", url.Values{"IsAudio": {"true"}, "TagArtist": {"Otro artista"}})
+	if code != http.StatusConflict {
+		t.Errorf("se esperaba 409 al repetir las etiquetas, se obtuvo %d %s", code, body)
+	}
+}
+
+func TestCancelVideoProcess(t *testing.T) {
+	app := newTestApp(t)
+	processVideo(t, app)
+
+	target := "/api/videos/dQw4w9WgXcQ/process?resolution=720p"
+	if code, body := request(t, app, http.MethodDelete, "/api/videos/dQw4w9WgXcQ/process", "2", nil); code != http.StatusBadRequest {
+		t.Errorf("se esperaba 400 sin resolución, se obtuvo %d %s", code, body)
+	}
+	// Otro invitado no puede cancelarlo, quien lo solicitó sí
+	db.DB.Exec("INSERT INTO users (username, password, role) VALUES ('otro', 'x', 'guest')")
+	if code, body := request(t, app, http.MethodDelete, target, "3", nil); code != http.StatusForbidden {
+		t.Errorf("se esperaba 403 para otro usuario, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodDelete, target, "2", nil); code != http.StatusOK {
+		t.Errorf("se esperaba 200, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodDelete, target, "2", nil); code != http.StatusNotFound {
+		t.Errorf("se esperaba 404 sin procesamiento pendiente, se obtuvo %d %s", code, body)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	app := newTestApp(t)
+	jobID := processVideo(t, app)
+	target := "/api/jobs/" + strconv.FormatInt(jobID, 10)
+
+	if code, body := request(t, app, http.MethodDelete, target, "1", nil); code != http.StatusOK {
+		t.Errorf("se esperaba 200, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodDelete, target, "1", nil); code != http.StatusConflict {
+		t.Errorf("se esperaba 409 al cancelar un trabajo terminado, se obtuvo %d %s", code, body)
+	}
+	if code, body := request(t, app, http.MethodDelete, "/api/jobs/999", "1", nil); code != http.StatusNotFound {
+		t.Errorf("se esperaba 404 con un trabajo que no existe, se obtuvo %d %s", code, body)
+	}
+}
+
+func TestStatusAndDownload(t *testing.T) {
+	app := newTestApp(t)
+
+	if code, body := request(t, app, http.MethodGet, "/api/videos/dQw4w9WgXcQ/status", "2", nil); code != http.StatusNotFound {
+		t.Errorf("se esperaba 404 antes de procesar, se obtuvo %d %s", code, body)
+	}
+
+	// El trabajo se procesa como lo haría un worker
+	job, err := jobs.GetJob(processVideo(t, app))
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if _, err := jobs.ProcessYoutubeVideo(context.Background(), job, jobs.Payload{}, t.TempDir()); err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+
+	code, body := request(t, app, http.MethodGet, "/api/videos/dQw4w9WgXcQ/status", "2", nil)
+	if code != http.StatusOK || !strings.Contains(body, `"status":"completed"`) || !strings.Contains(body, `"format":"mp4"`) {
+		t.Errorf("GET /status = %d %s, se esperaba completed en mp4", code, body)
+	}
+	code, body = request(t, app, http.MethodGet, "/api/videos/dQw4w9WgXcQ/download?resolution=720p", "2", nil)
+	if code != http.StatusOK || body != "fake:dQw4w9WgXcQ:720p:audio=false\n" {
+		t.Errorf("GET /download = %d %q, se esperaba el archivo del backend fake", code, body)
+	}
+	if code, body := request(t, app, http.MethodGet, "/api/videos/dQw4w9WgXcQ/download?resolution=1080p", "2", nil); code != http.StatusNotFound {
+		t.Errorf("se esperaba 404 con una resolución sin procesar, se obtuvo %d %s", code, body)
+	}
+}